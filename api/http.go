@@ -15,22 +15,168 @@
 // Package api provides the API endpoints for the distributor.
 package api
 
+import "time"
+
 const (
 	// HTTPGetCheckpointN is the path of the URL to get a checkpoint with
 	// at least N signatures.  The placeholders are:
 	//  * first position is for the logID (an alphanumeric string)
 	//  * second position is the number of signatures required
 	HTTPGetCheckpointN = "/distributor/v0/logs/%s/checkpoint.%s"
+	// HTTPGetCheckpointForPolicy is the path of the URL to get the largest
+	// checkpoint for a log that satisfies a witness policy configured in the
+	// distributor. The placeholders are:
+	//  * first position is for the logID (an alphanumeric string)
+	//  * second position is the name of the policy
+	HTTPGetCheckpointForPolicy = "/distributor/v0/logs/%s/policies/%s/checkpoint"
+	// HTTPGetCheckpointForWitnesses is the path of the URL to get the largest
+	// checkpoint for a log that has been cosigned by a set of witnesses.
+	// The placeholder is for the logID (an alphanumeric string).
+	// The witnesses are specified by repeating the HTTPWitnessParam query
+	// parameter, and HTTPThresholdParam optionally sets how many of them must
+	// have cosigned the checkpoint; by default all of them must.
+	HTTPGetCheckpointForWitnesses = "/distributor/v0/logs/%s/byWitnesses/checkpoint"
+	// HTTPWitnessParam is the query parameter naming a witness ID.
+	HTTPWitnessParam = "witness"
+	// HTTPThresholdParam is the query parameter giving a number of witnesses.
+	HTTPThresholdParam = "k"
+	// HTTPMaxAgeParam is the query parameter giving the maximum age, in seconds,
+	// of the witness cosignatures on a returned checkpoint, which must be at
+	// least 1; leave it out to get a checkpoint of any age. It is supported by
+	// HTTPGetCheckpointN, HTTPCheckpointByWitness and the origin-keyed paths.
+	HTTPMaxAgeParam = "max_age"
 	// HTTPCheckpointByWitness is the path of the URL to the latest checkpoint
 	// for a given log by a given witness. This can take GET requests to fetch
 	// the latest version, and PUT requests to update the latest checkpoint.
+	// A PUT is rejected with status 404 if the distributor does not know the log
+	// or witness, 409 if it has a checkpoint from the witness signed more recently,
+	// 422 if the checkpoint is inconsistent with the latest one from the witness,
+	// and 400 if the checkpoint is otherwise invalid.
 	//  * first position is for the logID (an alphanumeric string)
 	//  * second position is the witness short name (alpha string)
 	HTTPCheckpointByWitness = "/distributor/v0/logs/%s/byWitness/%s/checkpoint"
+	// HTTPGetCheckpointHistory is the path of the URL to get the checkpoints for a
+	// log that have been accepted from a given witness, as a JSON list of the
+	// checkpoints in the order in which the witness signed them. The range of
+	// signing times can be limited with the HTTPSinceParam and HTTPUntilParam
+	// query parameters. History is only kept for as long as the distributor is
+	// configured to retain it.
+	//  * first position is for the logID (an alphanumeric string)
+	//  * second position is the witness short name (alpha string)
+	HTTPGetCheckpointHistory = "/distributor/v0/logs/%s/byWitness/%s/history"
+	// HTTPSinceParam is the query parameter giving the earliest time, in RFC 3339
+	// format, at which a returned checkpoint may have been signed.
+	HTTPSinceParam = "since"
+	// HTTPUntilParam is the query parameter giving the time, in RFC 3339 format,
+	// before which a returned checkpoint must have been signed.
+	HTTPUntilParam = "until"
+	// HTTPDistributeBatch is the path of the URL that a witness can POST the
+	// checkpoints it has cosigned for many logs to in a single request. The
+	// request body is a JSON list of BatchCheckpoint objects, and the response
+	// is a JSON list of BatchResult objects, one for each checkpoint in the
+	// same order. The placeholder is for the witness short name.
+	// The request body may be up to 100 times the server's maximum size of a
+	// single submission, and each checkpoint is held to that maximum, with a
+	// 413 result for any that are larger.
+	// A batch is not atomic: each checkpoint is handled as if it had been
+	// submitted on its own, in order, and is stored as soon as it is accepted.
+	// The rejection of one checkpoint does not affect the others, and if the
+	// request fails part way through, the checkpoints before the failure may
+	// have been stored. Resubmitting a checkpoint that has already been stored
+	// is harmless.
+	HTTPDistributeBatch = "/distributor/v0/witnesses/%s/checkpoints"
+	// HTTPAddCheckpoint is the path of the URL that witnesses can POST cosigned
+	// checkpoints to, following the add-checkpoint endpoint of the C2SP
+	// tlog-witness spec (https://c2sp.org/tlog-witness). The request body is:
+	//
+	//	old <size of the previous checkpoint submitted by the witness>
+	//	<zero or more base64 consistency proof hashes, one per line>
+	//
+	//	<checkpoint, signed by the log and cosigned by the witness>
+	//
+	// The log is identified by the checkpoint origin, and the witness by its
+	// cosignature. If the old size does not match the latest checkpoint stored
+	// for the witness, a 409 response is returned with the stored size as the
+	// body, with content type ContentTypeTLogSize. If the consistency proof from
+	// that checkpoint fails to verify, a 422 response is returned.
+	HTTPAddCheckpoint = "/add-checkpoint"
+	// HTTPOriginLogs is the path of the URL to get the origins of all logs the
+	// distributor is aware of, as text with one origin per line. Unlike
+	// HTTPAddCheckpoint, this and the other origin-keyed read paths are not
+	// defined by any published spec.
+	HTTPOriginLogs = "/logs"
+	// HTTPOriginCheckpoint is the path of the URL to get the freshest cosigned
+	// checkpoint for a log. The placeholder is for the log origin, which must be
+	// percent-encoded. By default the checkpoint is the freshest with at least one
+	// cosignature; the HTTPCosignaturesParam query parameter can require more.
+	HTTPOriginCheckpoint = "/logs/%s/checkpoint"
+	// HTTPOriginCheckpointByWitness is the path of the URL to get the latest
+	// checkpoint for a log cosigned by a given witness. The placeholders are:
+	//  * first position is for the log origin, which must be percent-encoded
+	//  * second position is the witness short name (alpha string)
+	HTTPOriginCheckpointByWitness = "/logs/%s/cosigners/%s/checkpoint"
+	// HTTPCosignaturesParam is the query parameter giving the minimum number of
+	// witness cosignatures on a checkpoint.
+	HTTPCosignaturesParam = "cosignatures"
+	// ContentTypeTLogSize is the content type of a response containing only a
+	// decimal tree size.
+	ContentTypeTLogSize = "text/x.tlog.size"
 	// HTTPGetLogs is the path of the URL to get a list of all logs the
 	// distributor is aware of.
 	HTTPGetLogs = "/distributor/v0/logs"
 	// HTTPGetWitnesses is the path of the URL to get a list of all witnesses
 	// that the distributor is aware of.
 	HTTPGetWitnesses = "/distributor/v0/witnesses"
+	// HTTPGetInconsistencies is the path of the URL to get the evidence of
+	// inconsistency that the distributor has found for a log, as a JSON list
+	// of Inconsistency objects.
+	//  * first position is for the logID (an alphanumeric string)
+	HTTPGetInconsistencies = "/distributor/v0/logs/%s/inconsistencies"
 )
+
+// Inconsistency is evidence that a log has signed two checkpoints that are not
+// consistent with each other: either they are for the same tree size with different
+// root hashes, or a consistency proof between them, fetched from the log, matched
+// the smaller root hash but not the larger one.
+type Inconsistency struct {
+	// TreeSize is the size of the log tree that the first checkpoint commits to.
+	// If the checkpoints are for different tree sizes, this is the smaller size.
+	TreeSize uint64 `json:"treeSize"`
+	// Checkpoints are the two conflicting checkpoints, each signed by the log
+	// and the witness that submitted it.
+	Checkpoints [2]string `json:"checkpoints"`
+	// Proof is the consistency proof from the first checkpoint to the second,
+	// if they are for different tree sizes. Proofs supplied by witnesses are
+	// never used as evidence, as they could have been made up.
+	Proof [][]byte `json:"proof,omitempty"`
+	// Discovered is the time at which the distributor first found the inconsistency.
+	Discovered time.Time `json:"discovered"`
+}
+
+// ConsistencyProof is a proof that a log tree is an extension of the tree with size From,
+// such as the one in an add-checkpoint request.
+type ConsistencyProof struct {
+	// From is the size of the smaller tree.
+	From uint64
+	// Hashes are the hashes that make up the proof.
+	Hashes [][]byte
+}
+
+// BatchCheckpoint is a checkpoint for a log, submitted by a witness as part of a batch.
+type BatchCheckpoint struct {
+	// LogID identifies the log that the checkpoint is for.
+	LogID string `json:"logID"`
+	// Checkpoint is the checkpoint, signed by the log and cosigned by the witness.
+	Checkpoint string `json:"checkpoint"`
+}
+
+// BatchResult is the outcome of submitting one of the checkpoints in a batch.
+type BatchResult struct {
+	// LogID identifies the log that the checkpoint was for.
+	LogID string `json:"logID"`
+	// Status is the HTTP status code that would have been returned if the checkpoint
+	// had been submitted on its own to HTTPCheckpointByWitness.
+	Status int `json:"status"`
+	// Error describes why the checkpoint was not accepted, if it was not.
+	Error string `json:"error,omitempty"`
+}
@@ -12,8 +12,8 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// Package client contains a simple RESTful client that retrieves information from
-// a distributor at a known URL.
+// Package client contains a simple RESTful client that retrieves information from,
+// and submits witnessed checkpoints to, a distributor at a known URL.
 package client
 
 import (
@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/transparency-dev/distributor/api"
@@ -39,7 +40,7 @@ func NewRestDistributor(baseURL string, client *http.Client) *RestDistributor {
 	}
 }
 
-// RestDistributor is a client that fetches data via RESTful HTTP calls.
+// RestDistributor is a client that fetches and submits data via RESTful HTTP calls.
 type RestDistributor struct {
 	baseURL string
 	client  *http.Client
@@ -80,23 +81,102 @@ func (d *RestDistributor) GetWitnesses() ([]string, error) {
 	return r, nil
 }
 
+// CheckpointOption configures optional constraints on the checkpoints returned by
+// GetCheckpointN and GetCheckpointWitness.
+type CheckpointOption func(q url.Values)
+
+// WithMaxAge requires that the witness signatures on a returned checkpoint were all
+// made within the given duration, which is rounded up to whole seconds, and to at
+// least one second, as that is the precision of the distributor's check.
+// Older signatures are not counted, and if there are not enough signatures that are
+// fresh enough then the request fails.
+func WithMaxAge(age time.Duration) CheckpointOption {
+	secs := max((age+time.Second-1)/time.Second, 1)
+	return func(q url.Values) {
+		q.Set(api.HTTPMaxAgeParam, strconv.FormatInt(int64(secs), 10))
+	}
+}
+
 // GetCheckpointN returns the freshest checkpoint for the log that at least N witnesses
 // have provided signatures for.
-func (d *RestDistributor) GetCheckpointN(l LogID, n uint) ([]byte, error) {
+func (d *RestDistributor) GetCheckpointN(l LogID, n uint, opts ...CheckpointOption) ([]byte, error) {
 	u, err := url.Parse(d.baseURL + fmt.Sprintf(api.HTTPGetCheckpointN, l, strconv.Itoa(int(n))))
 	if err != nil {
 		return nil, err
 	}
+	applyCheckpointOptions(u, opts)
 	return d.fetchData(u)
 }
 
 // GetCheckpointWitness returns the latest checkpoint that a named witness has provided
 // for the given log.
-func (d *RestDistributor) GetCheckpointWitness(l LogID, w string) ([]byte, error) {
+func (d *RestDistributor) GetCheckpointWitness(l LogID, w string, opts ...CheckpointOption) ([]byte, error) {
 	u, err := url.Parse(d.baseURL + fmt.Sprintf(api.HTTPCheckpointByWitness, l, w))
 	if err != nil {
 		return nil, err
 	}
+	applyCheckpointOptions(u, opts)
+	return d.fetchData(u)
+}
+
+// GetCheckpointHistory returns the checkpoints for the log that the distributor has accepted
+// from the named witness, and which the witness signed at a time within [since, until), in the
+// order in which they were signed. A zero since or until leaves that end of the range unbounded.
+func (d *RestDistributor) GetCheckpointHistory(l LogID, w string, since, until time.Time) ([][]byte, error) {
+	u, err := url.Parse(d.baseURL + fmt.Sprintf(api.HTTPGetCheckpointHistory, l, w))
+	if err != nil {
+		return nil, err
+	}
+	q := url.Values{}
+	if !since.IsZero() {
+		q.Set(api.HTTPSinceParam, since.Format(time.RFC3339))
+	}
+	if !until.IsZero() {
+		q.Set(api.HTTPUntilParam, until.Format(time.RFC3339))
+	}
+	u.RawQuery = q.Encode()
+	bs, err := d.fetchData(u)
+	if err != nil {
+		return nil, err
+	}
+	var cps []string
+	if err := json.Unmarshal(bs, &cps); err != nil {
+		return nil, err
+	}
+	r := make([][]byte, 0, len(cps))
+	for _, cp := range cps {
+		r = append(r, []byte(cp))
+	}
+	return r, nil
+}
+
+func applyCheckpointOptions(u *url.URL, opts []CheckpointOption) {
+	if len(opts) == 0 {
+		return
+	}
+	q := u.Query()
+	for _, o := range opts {
+		o(q)
+	}
+	u.RawQuery = q.Encode()
+}
+
+// GetCheckpointForWitnesses returns the freshest checkpoint for the log that at least k of
+// the named witnesses have all provided signatures for. If k is zero then all of the witnesses
+// must have signed it.
+func (d *RestDistributor) GetCheckpointForWitnesses(l LogID, ws []string, k uint) ([]byte, error) {
+	u, err := url.Parse(d.baseURL + fmt.Sprintf(api.HTTPGetCheckpointForWitnesses, l))
+	if err != nil {
+		return nil, err
+	}
+	q := url.Values{}
+	for _, w := range ws {
+		q.Add(api.HTTPWitnessParam, w)
+	}
+	if k > 0 {
+		q.Set(api.HTTPThresholdParam, strconv.Itoa(int(k)))
+	}
+	u.RawQuery = q.Encode()
 	return d.fetchData(u)
 }
 
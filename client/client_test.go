@@ -0,0 +1,89 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/transparency-dev/distributor/api"
+	"github.com/transparency-dev/distributor/client"
+)
+
+func TestGetCheckpointHistory(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		since     time.Time
+		until     time.Time
+		wantQuery string
+	}{
+		{
+			desc:      "bounded",
+			since:     time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+			until:     time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC),
+			wantQuery: "since=2024-01-02T00%3A00%3A00Z&until=2024-01-03T00%3A00%3A00Z",
+		},
+		{
+			desc: "unbounded",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			path := fmt.Sprintf(api.HTTPGetCheckpointHistory, "FooLog", "Aardvark")
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != path || r.URL.RawQuery != tC.wantQuery {
+					t.Errorf("got request for %s?%s, want %s?%s", r.URL.Path, r.URL.RawQuery, path, tC.wantQuery)
+				}
+				if err := json.NewEncoder(w).Encode([]string{"one", "two"}); err != nil {
+					t.Errorf("Encode(): %v", err)
+				}
+			}))
+			defer ts.Close()
+
+			got, err := client.NewRestDistributor(ts.URL, ts.Client()).GetCheckpointHistory("FooLog", "Aardvark", tC.since, tC.until)
+			if err != nil {
+				t.Fatalf("GetCheckpointHistory(): %v", err)
+			}
+			if diff := cmp.Diff([][]byte{[]byte("one"), []byte("two")}, got); diff != "" {
+				t.Errorf("unexpected checkpoints (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWithMaxAge(t *testing.T) {
+	for _, tC := range []struct {
+		age  time.Duration
+		want string
+	}{
+		{age: 0, want: "1"},
+		{age: 500 * time.Millisecond, want: "1"},
+		{age: time.Second, want: "1"},
+		{age: 1500 * time.Millisecond, want: "2"},
+		{age: time.Hour, want: "3600"},
+	} {
+		q := url.Values{}
+		client.WithMaxAge(tC.age)(q)
+		if got := q.Get(api.HTTPMaxAgeParam); got != tC.want {
+			t.Errorf("WithMaxAge(%v): got %s=%s, want %s", tC.age, api.HTTPMaxAgeParam, got, tC.want)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/golang/glog"
+	"github.com/transparency-dev/distributor/api"
+)
+
+var (
+	// ErrStale is returned when the distributor already has a checkpoint for the
+	// log from the witness that the witness signed more recently.
+	ErrStale = errors.New("checkpoint is stale")
+	// ErrRejected is returned when the distributor rejects a checkpoint as invalid.
+	// This includes checkpoints that cannot be parsed or verified, and those that
+	// are for a smaller tree than the latest checkpoint from the witness.
+	ErrRejected = errors.New("checkpoint rejected")
+	// ErrInconsistent is returned when the checkpoint is inconsistent with the
+	// latest checkpoint for the log from the witness. The distributor records
+	// evidence of this, as it shows that the log has presented a split view.
+	ErrInconsistent = errors.New("checkpoint is inconsistent")
+	// ErrUnknownLog is returned when the distributor is not configured with the log.
+	ErrUnknownLog = errors.New("unknown log")
+	// ErrUnknownWitness is returned when the distributor is not configured with the witness.
+	ErrUnknownWitness = errors.New("unknown witness")
+)
+
+// StatusError is returned when the distributor rejects a submission. It matches
+// one of the errors above with errors.Is, if the status code has that meaning.
+type StatusError struct {
+	// StatusCode is the HTTP status code returned by the distributor.
+	StatusCode int
+	// Message is the body of the response.
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("bad status response (%d %s): %q", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+func (e *StatusError) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusConflict:
+		return ErrStale
+	case http.StatusBadRequest:
+		return ErrRejected
+	case http.StatusUnprocessableEntity:
+		return ErrInconsistent
+	case http.StatusNotFound:
+		// The distributor says which of the log or witness it does not know.
+		switch {
+		case strings.HasPrefix(e.Message, "unknown log"):
+			return ErrUnknownLog
+		case strings.HasPrefix(e.Message, "unknown witness"):
+			return ErrUnknownWitness
+		}
+	}
+	return nil
+}
+
+// retryable returns whether a submission rejected with this status may succeed
+// if it is made again later.
+func (e *StatusError) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// ResultError returns the error for a checkpoint in a batch, which is nil if it
+// was accepted and a *StatusError otherwise.
+func ResultError(r api.BatchResult) error {
+	if r.Status == http.StatusOK {
+		return nil
+	}
+	return &StatusError{StatusCode: r.Status, Message: r.Error}
+}
+
+// DistributeOption configures how checkpoints are submitted.
+type DistributeOption func(o *distributeOpts)
+
+type distributeOpts struct {
+	initialInterval time.Duration
+	maxElapsed      time.Duration
+}
+
+// WithRetries configures the exponential backoff used to retry submissions that
+// fail because of network errors, rate limiting or server errors. The first retry
+// is made after around initial, and no retries are started after maxElapsed has
+// passed since the first attempt. A maxElapsed of zero disables retries.
+func WithRetries(initial, maxElapsed time.Duration) DistributeOption {
+	return func(o *distributeOpts) {
+		o.initialInterval = initial
+		o.maxElapsed = maxElapsed
+	}
+}
+
+// Distribute submits a checkpoint for the given log, cosigned by the named witness.
+// This is intended for use by witnesses, and anything feeding checkpoints from
+// witnesses to the distributor.
+//
+// Submissions that fail because of network errors, rate limiting or server errors
+// are retried with exponential backoff, which by default gives up after a minute;
+// see WithRetries. Submissions that are rejected return a *StatusError, which
+// matches ErrStale, ErrRejected, ErrInconsistent, ErrUnknownLog or ErrUnknownWitness
+// with errors.Is where the distributor gave that reason.
+func (d *RestDistributor) Distribute(ctx context.Context, l LogID, w string, checkpoint []byte, opts ...DistributeOption) error {
+	u := d.baseURL + fmt.Sprintf(api.HTTPCheckpointByWitness, url.PathEscape(string(l)), url.PathEscape(w))
+	desc := fmt.Sprintf("checkpoint for log %q by witness %q", l, w)
+	_, err := d.submit(ctx, http.MethodPut, u, "", checkpoint, desc, opts)
+	return err
+}
+
+// DistributeBatch submits checkpoints for many logs, all cosigned by the named witness,
+// in a single request. The result for each checkpoint is returned in the same order as
+// the checkpoints, and can be converted to an error with ResultError. An error is only
+// returned if the batch as a whole failed. The batch is retried in the same way as
+// Distribute, but only as a whole, so checkpoints with results that are rate limited
+// or server errors are not resubmitted.
+// The checkpoints are accepted or rejected independently, as described for
+// api.HTTPDistributeBatch, so a batch which is retried after failing part way
+// through resubmits some checkpoints that were already stored, which is harmless.
+func (d *RestDistributor) DistributeBatch(ctx context.Context, w string, cps []api.BatchCheckpoint, opts ...DistributeOption) ([]api.BatchResult, error) {
+	body, err := json.Marshal(cps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal batch: %v", err)
+	}
+	u := d.baseURL + fmt.Sprintf(api.HTTPDistributeBatch, url.PathEscape(w))
+	desc := fmt.Sprintf("batch of %d checkpoints by witness %q", len(cps), w)
+	respBody, err := d.submit(ctx, http.MethodPost, u, "application/json", body, desc, opts)
+	if err != nil {
+		return nil, err
+	}
+	var rs []api.BatchResult
+	if err := json.Unmarshal(respBody, &rs); err != nil {
+		return nil, fmt.Errorf("failed to parse results: %v", err)
+	}
+	if len(rs) != len(cps) {
+		return nil, fmt.Errorf("got %d results for %d checkpoints", len(rs), len(cps))
+	}
+	return rs, nil
+}
+
+// submit sends body to the distributor, retrying transient failures as configured by
+// opts, and returns the body of the successful response. desc describes what is being
+// submitted, for logging.
+func (d *RestDistributor) submit(ctx context.Context, method, u, contentType string, body []byte, desc string, opts []DistributeOption) ([]byte, error) {
+	o := distributeOpts{
+		initialInterval: backoff.DefaultInitialInterval,
+		maxElapsed:      time.Minute,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var b backoff.BackOff = &backoff.StopBackOff{}
+	if o.maxElapsed > 0 {
+		eb := backoff.NewExponentialBackOff()
+		eb.InitialInterval = o.initialInterval
+		eb.MaxElapsedTime = o.maxElapsed
+		b = eb
+	}
+	rb := &retryAfterBackOff{BackOff: b}
+	var respBody []byte
+	op := func() error {
+		var err error
+		respBody, err = d.send(ctx, method, u, contentType, body, rb)
+		var se *StatusError
+		if errors.As(err, &se) && !se.retryable() {
+			return backoff.Permanent(err)
+		}
+		return err
+	}
+	notify := func(err error, next time.Duration) {
+		glog.V(1).Infof("Failed to distribute %s, retrying in %v: %v", desc, next, err)
+	}
+	if err := backoff.RetryNotify(op, backoff.WithContext(rb, ctx), notify); err != nil {
+		return nil, err
+	}
+	return respBody, nil
+}
+
+// send makes a single attempt to submit body, and returns the body of the response.
+// Any Retry-After header on the response is recorded in rb.
+func (d *RestDistributor) send(ctx context.Context, method, u, contentType string, body []byte, rb *retryAfterBackOff) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, backoff.Permanent(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			glog.Errorf("Failed to close body: %v", err)
+		}
+	}()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %v", err)
+	}
+	if resp.StatusCode == http.StatusOK {
+		return respBody, nil
+	}
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+		rb.retryAfter = time.Duration(secs) * time.Second
+	}
+	return nil, &StatusError{StatusCode: resp.StatusCode, Message: string(bytes.TrimSpace(respBody))}
+}
+
+// retryAfterBackOff waits for at least as long as the distributor asked, with a
+// Retry-After header, before the next attempt.
+type retryAfterBackOff struct {
+	backoff.BackOff
+	retryAfter time.Duration
+}
+
+func (b *retryAfterBackOff) NextBackOff() time.Duration {
+	next := b.BackOff.NextBackOff()
+	if next != backoff.Stop && next < b.retryAfter {
+		next = b.retryAfter
+	}
+	b.retryAfter = 0
+	return next
+}
@@ -0,0 +1,257 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/transparency-dev/distributor/api"
+	"github.com/transparency-dev/distributor/client"
+)
+
+func TestDistributeBatch(t *testing.T) {
+	cps := []api.BatchCheckpoint{
+		{LogID: "FooLog", Checkpoint: "foo"},
+		{LogID: "BarLog", Checkpoint: "bar"},
+	}
+	testCases := []struct {
+		desc         string
+		statusCodes  []int
+		results      []api.BatchResult
+		wantAttempts int
+		wantErr      bool
+		wantErrIs    error
+	}{
+		{
+			desc:        "results",
+			statusCodes: []int{200},
+			results: []api.BatchResult{
+				{LogID: "FooLog", Status: 200},
+				{LogID: "BarLog", Status: 409, Error: "stale"},
+			},
+			wantAttempts: 1,
+		},
+		{
+			desc:         "missing results",
+			statusCodes:  []int{200},
+			results:      []api.BatchResult{{LogID: "FooLog", Status: 200}},
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			desc:         "batch rejected",
+			statusCodes:  []int{400},
+			wantAttempts: 1,
+			wantErr:      true,
+			wantErrIs:    client.ErrRejected,
+		},
+		{
+			desc:        "retried until accepted",
+			statusCodes: []int{503, 429, 200},
+			results: []api.BatchResult{
+				{LogID: "FooLog", Status: 200},
+				{LogID: "BarLog", Status: 200},
+			},
+			wantAttempts: 3,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			path := fmt.Sprintf(api.HTTPDistributeBatch, "Aardvark")
+			attempts := 0
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != path {
+					t.Errorf("got request %s %s, want POST %s", r.Method, r.URL.Path, path)
+				}
+				var got []api.BatchCheckpoint
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Errorf("failed to decode batch: %v", err)
+				}
+				if diff := cmp.Diff(cps, got); diff != "" {
+					t.Errorf("unexpected batch (-want +got):\n%s", diff)
+				}
+				w.WriteHeader(tC.statusCodes[attempts])
+				attempts++
+				if err := json.NewEncoder(w).Encode(tC.results); err != nil {
+					t.Errorf("Encode(): %v", err)
+				}
+			}))
+			defer ts.Close()
+
+			got, err := client.NewRestDistributor(ts.URL, ts.Client()).DistributeBatch(context.Background(), "Aardvark", cps, client.WithRetries(time.Millisecond, time.Second))
+			if gotErr := err != nil; gotErr != tC.wantErr {
+				t.Fatalf("DistributeBatch(): got err %v, want err %t", err, tC.wantErr)
+			}
+			if attempts != tC.wantAttempts {
+				t.Errorf("got %d attempts, want %d", attempts, tC.wantAttempts)
+			}
+			if tC.wantErrIs != nil && !errors.Is(err, tC.wantErrIs) {
+				t.Errorf("DistributeBatch(): got err %v, want %v", err, tC.wantErrIs)
+			}
+			if tC.wantErr {
+				return
+			}
+			if diff := cmp.Diff(tC.results, got); diff != "" {
+				t.Errorf("unexpected results (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDistribute(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		statusCodes  []int
+		body         string
+		wantAttempts int
+		wantErr      error
+	}{
+		{
+			desc:         "accepted",
+			statusCodes:  []int{200},
+			wantAttempts: 1,
+		},
+		{
+			desc:         "stale",
+			statusCodes:  []int{409},
+			wantAttempts: 1,
+			wantErr:      client.ErrStale,
+		},
+		{
+			desc:         "rejected",
+			statusCodes:  []int{400},
+			wantAttempts: 1,
+			wantErr:      client.ErrRejected,
+		},
+		{
+			desc:         "inconsistent",
+			statusCodes:  []int{422},
+			wantAttempts: 1,
+			wantErr:      client.ErrInconsistent,
+		},
+		{
+			desc:         "unknown log",
+			statusCodes:  []int{404},
+			body:         `unknown log "FooLog"`,
+			wantAttempts: 1,
+			wantErr:      client.ErrUnknownLog,
+		},
+		{
+			desc:         "unknown witness",
+			statusCodes:  []int{404},
+			body:         `unknown witness "Aardvark"`,
+			wantAttempts: 1,
+			wantErr:      client.ErrUnknownWitness,
+		},
+		{
+			desc:         "retried until accepted",
+			statusCodes:  []int{503, 429, 200},
+			wantAttempts: 3,
+		},
+		{
+			desc:         "retried until rejected",
+			statusCodes:  []int{500, 409},
+			wantAttempts: 2,
+			wantErr:      client.ErrStale,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			path := fmt.Sprintf(api.HTTPCheckpointByWitness, "FooLog", "Aardvark")
+			attempts := 0
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPut || r.URL.Path != path {
+					t.Errorf("got request %s %s, want PUT %s", r.Method, r.URL.Path, path)
+				}
+				if body, err := io.ReadAll(r.Body); err != nil || string(body) != "checkpoint" {
+					t.Errorf("got body %q (%v), want %q", body, err, "checkpoint")
+				}
+				w.WriteHeader(tC.statusCodes[attempts])
+				_, _ = io.WriteString(w, tC.body)
+				attempts++
+			}))
+			defer ts.Close()
+
+			d := client.NewRestDistributor(ts.URL, ts.Client())
+			err := d.Distribute(context.Background(), "FooLog", "Aardvark", []byte("checkpoint"), client.WithRetries(time.Millisecond, time.Second))
+			if !errors.Is(err, tC.wantErr) {
+				t.Errorf("Distribute(): got err %v, want %v", err, tC.wantErr)
+			}
+			if attempts != tC.wantAttempts {
+				t.Errorf("got %d attempts, want %d", attempts, tC.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestDistributeRetryAfter(t *testing.T) {
+	var last time.Time
+	var gap time.Duration
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if last.IsZero() {
+			last = time.Now()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		gap = time.Since(last)
+	}))
+	defer ts.Close()
+
+	d := client.NewRestDistributor(ts.URL, ts.Client())
+	if err := d.Distribute(context.Background(), "FooLog", "Aardvark", []byte("checkpoint"), client.WithRetries(time.Millisecond, 5*time.Second)); err != nil {
+		t.Fatalf("Distribute(): %v", err)
+	}
+	if gap < time.Second {
+		t.Errorf("retried after %v, want at least 1s", gap)
+	}
+}
+
+func TestDistributeNoRetries(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	d := client.NewRestDistributor(ts.URL, ts.Client())
+	err := d.Distribute(context.Background(), "FooLog", "Aardvark", []byte("checkpoint"), client.WithRetries(0, 0))
+	var se *client.StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Distribute(): got err %v, want 503 StatusError", err)
+	}
+	if attempts != 1 {
+		t.Errorf("got %d attempts, want 1", attempts)
+	}
+}
+
+func TestResultError(t *testing.T) {
+	if err := client.ResultError(api.BatchResult{LogID: "FooLog", Status: 200}); err != nil {
+		t.Errorf("ResultError(200): got %v, want nil", err)
+	}
+	if err := client.ResultError(api.BatchResult{LogID: "FooLog", Status: 409, Error: "stale"}); !errors.Is(err, client.ErrStale) {
+		t.Errorf("ResultError(409): got %v, want %v", err, client.ErrStale)
+	}
+}
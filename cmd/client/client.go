@@ -36,12 +36,17 @@ var (
 	baseURL = flag.String("base_url", "https://api.transparency.dev", "The base URL of the distributor")
 	n       = flag.Uint("n", 2, "The desired number of witness signatures for each log")
 	witness = flag.String("w", "", "Show the latest checkpoints for this witness short name")
+	maxAge  = flag.Duration("max_age", 0, "If set, only witness signatures made within this duration are accepted")
 )
 
 func main() {
 	flag.Parse()
 
 	d := client.NewRestDistributor(*baseURL, http.DefaultClient)
+	var opts []client.CheckpointOption
+	if *maxAge > 0 {
+		opts = append(opts, client.WithMaxAge(*maxAge))
+	}
 
 	ls := getLogsOrDie()
 	ws := getWitnessesOrDie(d)
@@ -62,13 +67,13 @@ func main() {
 		var cp []byte
 		var err error
 		if *witness == "" {
-			cp, err = d.GetCheckpointN(l, *n)
+			cp, err = d.GetCheckpointN(l, *n, opts...)
 			if err != nil {
 				fmt.Printf("❌️ Could not get checkpoint.%d: %v\n", *n, err)
 				continue
 			}
 		} else {
-			cp, err = d.GetCheckpointWitness(l, *witness)
+			cp, err = d.GetCheckpointWitness(l, *witness, opts...)
 			if err != nil {
 				fmt.Printf("❌️ Could not get checkpoint: %v\n", err)
 				continue
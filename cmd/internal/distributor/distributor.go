@@ -12,7 +12,7 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// Package distributor contains a DB-backed object that persists witnessed
+// Package distributor contains a storage-backed object that persists witnessed
 // checkpoints of verifiable logs and allows them to be queried to allow
 // efficient lookup by-witness, and by number of signatures.
 package distributor
@@ -20,14 +20,23 @@ package distributor
 import (
 	"bytes"
 	"context"
-	"database/sql"
+	"errors"
 	"fmt"
+	"slices"
 	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/golang/glog"
+	"github.com/transparency-dev/distributor/api"
+	"github.com/transparency-dev/distributor/cmd/internal/storage"
 	"github.com/transparency-dev/distributor/config"
 	"github.com/transparency-dev/distributor/internal/checkpoints"
 	"github.com/transparency-dev/formats/log"
+	f_note "github.com/transparency-dev/formats/note"
+	"github.com/transparency-dev/merkle/proof"
+	"github.com/transparency-dev/merkle/rfc6962"
 	"golang.org/x/mod/sumdb/note"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -36,8 +45,29 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
-// maxSigs is the maximum number of sigs that can be requested.
-const maxSigs = 100
+const (
+	// maxSigs is the maximum number of sigs that can be requested.
+	maxSigs = 100
+	// maxInconsistenciesPerLog bounds the amount of evidence of inconsistency stored for
+	// each log. One piece of evidence is enough to demonstrate a split view, so there is
+	// little value in keeping many, and this stops a misbehaving log from filling the DB.
+	maxInconsistenciesPerLog = 100
+	// maxForkChecks bounds the number of fork detection checks that run at once, so that
+	// a slow ProofSource cannot cause an unbounded number of them to build up.
+	maxForkChecks = 16
+	// forkCheckTimeout bounds how long each fork detection check may take.
+	forkCheckTimeout = time.Minute
+
+	// DefaultMaxNoteSize is the default maximum size, in bytes, of a submitted checkpoint note.
+	DefaultMaxNoteSize = 16 << 10
+	// DefaultMaxSignatureLines is the default maximum number of signature lines on a submitted
+	// checkpoint note.
+	DefaultMaxSignatureLines = 100
+)
+
+// endOfTime is far enough in the future to be after every checkpoint, while not
+// overflowing when converted to a Unix time.
+var endOfTime = time.Unix(1<<62, 0)
 
 var (
 	counterCheckpointUpdateRequests = promauto.NewCounterVec(
@@ -54,6 +84,20 @@ var (
 		},
 		[]string{"witness_id"},
 	)
+	counterCheckpointUpdateCoalesced = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "distributor_update_checkpoint_coalesced",
+			Help: "The total number of successful requests to update a checkpoint that were not written because the same checkpoint was written recently, partitioned by witness ID.",
+		},
+		[]string{"witness_id"},
+	)
+	counterInconsistencies = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "distributor_inconsistent_checkpoints",
+			Help: "The total number of times that inconsistent checkpoints were found, either for the same tree size with different hashes or with a consistency proof from the log that failed to verify, partitioned by log ID.",
+		},
+		[]string{"log_id"},
+	)
 	counterCheckpointGetNRequests = promauto.NewCounter(prometheus.CounterOpts{
 		Name: "distributor_get_checkpoint_n_request",
 		Help: "The total number of requests to GetCheckpointN",
@@ -71,112 +115,628 @@ var (
 		Name: "distributor_get_checkpoint_wit_success",
 		Help: "The total number of successful requests to GetCheckpointWitness",
 	})
+
+	counterForkChecksSkipped = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "distributor_fork_checks_skipped",
+			Help: "The total number of accepted checkpoints that were not checked for forks because too many checks were already running, partitioned by log ID.",
+		},
+		[]string{"log_id"},
+	)
+
+	counterMergedCompacted = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "distributor_merged_checkpoints_compacted",
+			Help: "The total number of merged checkpoints rewritten or removed by compaction, partitioned by log ID.",
+		},
+		[]string{"log_id"},
+	)
+
+	counterConfigReloads = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "distributor_config_reloads",
+		Help: "The total number of times the log and witness configuration has been reloaded",
+	})
+	counterConfigChanges = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "distributor_config_changes",
+			Help: "The total number of logs and witnesses added to or removed from the configuration by reloads, partitioned by kind (log or witness) and change (added or removed).",
+		},
+		[]string{"kind", "change"},
+	)
+	gaugeConfiguredLogs = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "distributor_configured_logs",
+		Help: "The number of logs that the distributor currently accepts checkpoints for",
+	})
+	gaugeConfiguredWitnesses = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "distributor_configured_witnesses",
+		Help: "The number of witnesses that the distributor currently accepts checkpoints from",
+	})
 )
 
 // NewDistributor returns a distributor that will accept checkpoints from
 // the given witnesses, for the given logs, and persist its state in the
-// database provided. Callers must call Init() on the returned distributor.
+// storage provided.
 // `ws` is a map from witness raw verifier string to the note verifier.
 // `ls` is a map from log ID (github.com/transparency-dev/formats/log.ID) to log info.
-func NewDistributor(ws map[string]note.Verifier, ls map[string]config.LogInfo, db *sql.DB) (*Distributor, error) {
+func NewDistributor(ws map[string]note.Verifier, ls map[string]config.LogInfo, s storage.Storage, opts ...Option) (*Distributor, error) {
+	d := &Distributor{
+		s:           s,
+		now:         time.Now,
+		maxNoteSize: DefaultMaxNoteSize,
+		maxSigLines: DefaultMaxSignatureLines,
+		compact:     make(chan struct{}, 1),
+		forkChecks:  make(chan struct{}, maxForkChecks),
+	}
+	cfg := newLogsAndWitnesses(ws, ls)
+	d.cfg.Store(cfg)
+	cfg.updateGauges()
+	for _, o := range opts {
+		o(d)
+	}
+	return d, nil
+}
+
+// Reconfigure atomically replaces the witnesses and logs that the distributor
+// accepts checkpoints for. The arguments are as described for NewDistributor.
+// Requests that are already in flight complete using the previous configuration.
+// Checkpoints already stored for removed logs and witnesses are left in place,
+// but are no longer counted towards merged checkpoints. If witnesses were removed,
+// RunCompaction is asked to remove their signatures from merged checkpoints.
+func (d *Distributor) Reconfigure(ws map[string]note.Verifier, ls map[string]config.LogInfo) {
+	cfg := newLogsAndWitnesses(ws, ls)
+	old := d.cfg.Swap(cfg)
+	counterConfigReloads.Inc()
+	cfg.updateGauges()
+
+	for k := range cfg.rawWs {
+		if _, ok := old.rawWs[k]; !ok {
+			glog.Infof("Witness added: %s", k)
+			counterConfigChanges.WithLabelValues("witness", "added").Inc()
+		}
+	}
+	// Merged checkpoints may have signatures from witnesses that are no longer
+	// accepted, in which case they need to be compacted.
+	needCompaction := false
+	for k := range old.rawWs {
+		if _, ok := cfg.rawWs[k]; !ok {
+			glog.Infof("Witness removed: %s", k)
+			counterConfigChanges.WithLabelValues("witness", "removed").Inc()
+			needCompaction = true
+		}
+	}
+	for id, l := range cfg.ls {
+		oldL, ok := old.ls[id]
+		if !ok {
+			glog.Infof("Log added: %q (%s)", l.Origin, id)
+			counterConfigChanges.WithLabelValues("log", "added").Inc()
+			continue
+		}
+		if !slices.Equal(oldL.AllowedWitnesses, l.AllowedWitnesses) {
+			needCompaction = true
+		}
+	}
+	for id, l := range old.ls {
+		if _, ok := cfg.ls[id]; !ok {
+			glog.Infof("Log removed: %q (%s)", l.Origin, id)
+			counterConfigChanges.WithLabelValues("log", "removed").Inc()
+		}
+	}
+	if needCompaction {
+		d.requestCompaction()
+	}
+}
+
+// logsAndWitnesses is the set of logs and witnesses that the distributor is
+// configured with. It is never modified once created; reconfiguring the
+// distributor replaces it wholesale so that each request sees a consistent view.
+type logsAndWitnesses struct {
+	// ws is a map from witness ID to the note verifier.
+	ws map[string]note.Verifier
+	// rawWs is a map from witness raw verifier string to the note verifier.
+	rawWs map[string]note.Verifier
+	// witKeys are the keys of rawWs, sorted.
+	witKeys []string
+	// ls is a map from log ID to log info.
+	ls map[string]config.LogInfo
+}
+
+func newLogsAndWitnesses(ws map[string]note.Verifier, ls map[string]config.LogInfo) *logsAndWitnesses {
 	witsByID := make(map[string]note.Verifier, len(ws))
+	rawWs := make(map[string]note.Verifier, len(ws))
 	rawVKeys := make([]string, 0, len(ws))
 	for k, v := range ws {
 		rawVKeys = append(rawVKeys, k)
+		rawWs[k] = v
 		witsByID[v.Name()] = v
 	}
 	sort.Strings(rawVKeys)
-	d := &Distributor{
+	logs := make(map[string]config.LogInfo, len(ls))
+	for k, v := range ls {
+		logs[k] = v
+	}
+	return &logsAndWitnesses{
 		ws:      witsByID,
+		rawWs:   rawWs,
 		witKeys: rawVKeys,
-		ls:      ls,
-		db:      db,
+		ls:      logs,
+	}
+}
+
+func (c *logsAndWitnesses) updateGauges() {
+	gaugeConfiguredLogs.Set(float64(len(c.ls)))
+	gaugeConfiguredWitnesses.Set(float64(len(c.ws)))
+}
+
+// ProofSource provides consistency proofs for logs, for example by fetching them from the logs.
+type ProofSource interface {
+	// ConsistencyProof returns the hashes of the consistency proof from the tree of size `from`
+	// for the log to the tree of size `to`.
+	ConsistencyProof(ctx context.Context, logID string, from, to uint64) ([][]byte, error)
+}
+
+// Option configures optional behaviour of a Distributor.
+type Option func(*Distributor)
+
+// WithHistoryRetention sets how long checkpoints are kept in the history of
+// checkpoints accepted from each witness, measured from the witness timestamp.
+// Older checkpoints are not returned by GetCheckpointHistory, and are removed
+// when the witness submits another checkpoint for the log, or by Compact.
+// Zero, which is the default, keeps the history forever.
+func WithHistoryRetention(r time.Duration) Option {
+	return func(d *Distributor) {
+		d.historyRetention = r
+	}
+}
+
+// WithMaxFutureSkew sets how far into the future, relative to the distributor's
+// clock, a witness timestamp may be before the checkpoint is rejected.
+// Zero, which is the default, accepts any timestamp.
+func WithMaxFutureSkew(skew time.Duration) Option {
+	return func(d *Distributor) {
+		d.maxFutureSkew = skew
+	}
+}
+
+// WithMergedSignatureWindow sets how recently a witness must have cosigned a checkpoint
+// for its signature to be included in merged checkpoints. Older signatures are left out
+// when checkpoints are merged, and are removed from merged checkpoints by Compact.
+// Zero, which is the default, includes signatures regardless of their age.
+func WithMergedSignatureWindow(w time.Duration) Option {
+	return func(d *Distributor) {
+		d.mergedWindow = w
+	}
+}
+
+// WithNoteLimits sets the maximum size in bytes of a submitted checkpoint note, and the
+// maximum number of signature lines it may have. Notes exceeding either limit are rejected
+// with status `codes.ResourceExhausted` before they are parsed. Zero leaves the corresponding
+// default, DefaultMaxNoteSize or DefaultMaxSignatureLines, in place.
+func WithNoteLimits(maxSize, maxSigLines int) Option {
+	return func(d *Distributor) {
+		if maxSize > 0 {
+			d.maxNoteSize = maxSize
+		}
+		if maxSigLines > 0 {
+			d.maxSigLines = maxSigLines
+		}
 	}
-	return d, d.init()
+}
+
+// WithSameSizeWriteInterval sets how far the witness timestamp must have advanced
+// since the latest checkpoint stored for a witness before another checkpoint for
+// the same tree size is written. Resubmissions within the interval are accepted
+// but not stored, which reduces writes at the cost of the stored timestamp being
+// up to the interval stale. Zero, which is the default, writes every submission.
+func WithSameSizeWriteInterval(i time.Duration) Option {
+	return func(d *Distributor) {
+		d.sameSizeInterval = i
+	}
+}
+
+// WithProofSource sets where consistency proofs are fetched from when a checkpoint is submitted
+// without one. By default, checkpoints submitted without a proof are not checked for consistency
+// with the previous checkpoint from the same witness unless they are for the same tree size.
+func WithProofSource(ps ProofSource) Option {
+	return func(d *Distributor) {
+		d.proofSource = ps
+	}
+}
+
+// WithForkDetection enables checking each accepted checkpoint against the latest
+// checkpoints from the other witnesses of the same log, using consistency proofs
+// from the ProofSource provided where the checkpoints are for different tree sizes.
+// Any inconsistencies found are reported in the same way as those between
+// checkpoints from the same witness, but the checkpoint is still accepted as it
+// cannot be known which of the witnesses has been shown a fork.
+//
+// The checks run in the background after each checkpoint is accepted, so that
+// submissions are not held up by the ProofSource. A bounded number of checks run
+// at once, and checkpoints accepted while that many are running are not checked;
+// the next checkpoint accepted for the log will be. WaitForForkDetection waits for
+// any checks that are running to finish.
+func WithForkDetection(ps ProofSource) Option {
+	return func(d *Distributor) {
+		d.forkProofs = ps
+	}
+}
+
+// WithPolicies sets the witness policies that can be requested by name
+// from GetCheckpointForPolicy.
+func WithPolicies(ps map[string]*config.Policy) Option {
+	return func(d *Distributor) {
+		d.SetPolicies(ps)
+	}
+}
+
+// SetPolicies atomically replaces the witness policies that can be requested
+// by name from GetCheckpointForPolicy.
+func (d *Distributor) SetPolicies(ps map[string]*config.Policy) {
+	d.policies.Store(&ps)
 }
 
 // Distributor persists witnessed checkpoints and allows querying of them.
 type Distributor struct {
-	ws      map[string]note.Verifier
-	witKeys []string
-	ls      map[string]config.LogInfo
-	db      *sql.DB
+	cfg      atomic.Pointer[logsAndWitnesses]
+	policies atomic.Pointer[map[string]*config.Policy]
+	s        storage.Storage
+	now      func() time.Time
+
+	historyRetention time.Duration
+	maxFutureSkew    time.Duration
+	mergedWindow     time.Duration
+	sameSizeInterval time.Duration
+	maxNoteSize      int
+	maxSigLines      int
+	proofSource      ProofSource
+	forkProofs       ProofSource
+
+	// forkChecks holds a token for each fork detection check that is running.
+	forkChecks chan struct{}
+	// forkWG is used to wait for running fork detection checks to finish.
+	forkWG sync.WaitGroup
+
+	// compact is signalled to request that RunCompaction compacts the merged
+	// checkpoints without waiting for the next interval.
+	compact chan struct{}
 }
 
 // GetLogs returns a list of all log IDs the distributor is aware of, sorted
 // by the ID.
 func (d *Distributor) GetLogs(ctx context.Context) ([]string, error) {
-	r := make([]string, 0, len(d.ls))
-	for k := range d.ls {
+	ls := d.cfg.Load().ls
+	r := make([]string, 0, len(ls))
+	for k := range ls {
 		r = append(r, k)
 	}
 	sort.Strings(r)
 	return r, nil
 }
 
+// GetLogOrigins returns the origins of all logs the distributor is aware of, sorted.
+func (d *Distributor) GetLogOrigins(ctx context.Context) ([]string, error) {
+	ls := d.cfg.Load().ls
+	r := make([]string, 0, len(ls))
+	for _, l := range ls {
+		r = append(r, l.Origin)
+	}
+	sort.Strings(r)
+	return r, nil
+}
+
 // GetLogs returns a list of all witness verifier keys that the distributor is
 // aware of, sorted by the key.
 func (d *Distributor) GetWitnesses(ctx context.Context) ([]string, error) {
-	return d.witKeys, nil
+	return d.cfg.Load().witKeys, nil
 }
 
 // GetCheckpointN gets the largest checkpoint for a given log that has at least `n` signatures.
-func (d *Distributor) GetCheckpointN(ctx context.Context, logID string, n uint32) ([]byte, error) {
+// If several checkpoints are for the largest tree size, the one with the most signatures is returned.
+// If maxAge is non-zero then only witness signatures made within maxAge of the current time are
+// counted, and the returned checkpoint only carries those signatures.
+func (d *Distributor) GetCheckpointN(ctx context.Context, logID string, n uint32, maxAge time.Duration) ([]byte, error) {
 	counterCheckpointGetNRequests.Inc()
 	if n == 0 || n > maxSigs {
 		return nil, status.Errorf(codes.InvalidArgument, "invalid N %d", n)
 	}
-	if _, ok := d.ls[logID]; !ok {
+	if maxAge < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid max age %v", maxAge)
+	}
+	cfg := d.cfg.Load()
+	l, ok := cfg.ls[logID]
+	if !ok {
 		return nil, status.Errorf(codes.InvalidArgument, "unknown log ID %q", logID)
 	}
 
-	tx, err := d.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
-	if err != nil {
-		return nil, fmt.Errorf("failed to begin transaction: %v", err)
-	}
-	row := tx.QueryRowContext(ctx, "SELECT chkpt FROM merged_checkpoints WHERE logID = ? AND sigCount = ?", logID, n)
-	if row.Err() != nil {
-		return nil, fmt.Errorf("QueryRowContext(): %v", err)
+	if maxAge > 0 {
+		// Merged checkpoints don't record when each signature was made, so build
+		// the checkpoint from the sufficiently fresh checkpoints of each witness.
+		p := &config.Policy{
+			Name:      fmt.Sprintf("%d signatures within %v", n, maxAge),
+			Threshold: int(n),
+		}
+		for _, w := range cfg.ws {
+			if l.WitnessAllowed(w) {
+				p.Witnesses = append(p.Witnesses, w)
+			}
+		}
+		cp, err := d.checkpointSatisfying(ctx, cfg, logID, p, d.now().Add(-maxAge))
+		if err != nil {
+			return nil, err
+		}
+		counterCheckpointGetNSuccess.Inc()
+		return cp, nil
 	}
+
 	var cp []byte
-	if err := row.Scan(&cp); err != nil {
-		if err == sql.ErrNoRows {
-			return nil, status.Errorf(codes.NotFound, "no checkpoint with %d signatures found", n)
-		}
-		return nil, fmt.Errorf("Scan(): %v", err)
+	if err := d.s.ReadTransaction(ctx, func(ctx context.Context, tx storage.ReadTx) error {
+		var err error
+		cp, err = tx.GetLatestMergedCheckpoint(ctx, logID, n)
+		return err
+	}); err != nil {
+		return nil, err
 	}
 	counterCheckpointGetNSuccess.Inc()
 	return cp, nil
 }
 
 // GetCheckpointWitness gets the largest checkpoint for the log that was witnessed by the given witness.
-func (d *Distributor) GetCheckpointWitness(ctx context.Context, logID, witID string) ([]byte, error) {
+// If maxAge is non-zero and the witness signed the checkpoint longer ago than that, then an error
+// with status `codes.NotFound` is returned.
+func (d *Distributor) GetCheckpointWitness(ctx context.Context, logID, witID string, maxAge time.Duration) ([]byte, error) {
 	counterCheckpointGetByWitRequests.Inc()
-	tx, err := d.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
-	if err != nil {
-		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	if maxAge < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid max age %v", maxAge)
 	}
-	cp, err := getLatestCheckpoint(ctx, tx, logID, witID)
-	if err == nil {
-		counterCheckpointGetByWitSuccess.Inc()
+	var wcp storage.WitnessCheckpoint
+	if err := d.s.ReadTransaction(ctx, func(ctx context.Context, tx storage.ReadTx) error {
+		var err error
+		wcp, err = tx.GetWitnessCheckpoint(ctx, logID, witID)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if maxAge > 0 && wcp.Timestamp.Before(d.now().Add(-maxAge)) {
+		return nil, status.Errorf(codes.NotFound, "checkpoint for log %q from witness %q was not signed within %v", logID, witID, maxAge)
+	}
+	counterCheckpointGetByWitSuccess.Inc()
+	return wcp.Checkpoint, nil
+}
+
+// GetCheckpointForPolicy returns the checkpoint for the log with the largest tree size
+// that has been cosigned by a set of witnesses satisfying the named policy.
+// The returned checkpoint has the signatures of all of the witnesses that cosigned it,
+// which may be more than are needed to satisfy the policy.
+func (d *Distributor) GetCheckpointForPolicy(ctx context.Context, logID, policy string) ([]byte, error) {
+	cfg := d.cfg.Load()
+	if _, ok := cfg.ls[logID]; !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown log ID %q", logID)
+	}
+	var p *config.Policy
+	if ps := d.policies.Load(); ps != nil {
+		p = (*ps)[policy]
+	}
+	if p == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown policy %q", policy)
+	}
+	return d.checkpointSatisfying(ctx, cfg, logID, p, time.Time{})
+}
+
+// GetCheckpointForWitnesses returns the checkpoint for the log with the largest tree size
+// that at least k of the given witnesses have all cosigned. If k is zero then all of the
+// witnesses must have cosigned it.
+// The returned checkpoint has the signatures of all of the witnesses that cosigned it,
+// which may include witnesses other than those requested.
+func (d *Distributor) GetCheckpointForWitnesses(ctx context.Context, logID string, witIDs []string, k uint32) ([]byte, error) {
+	cfg := d.cfg.Load()
+	if _, ok := cfg.ls[logID]; !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown log ID %q", logID)
+	}
+	if len(witIDs) == 0 || len(witIDs) > maxSigs {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid number of witnesses %d", len(witIDs))
+	}
+	if k == 0 {
+		k = uint32(len(witIDs))
+	}
+	if k > uint32(len(witIDs)) {
+		return nil, status.Errorf(codes.InvalidArgument, "cannot require %d of %d witnesses", k, len(witIDs))
+	}
+	p := &config.Policy{
+		Name:      fmt.Sprintf("%d of %v", k, witIDs),
+		Threshold: int(k),
+	}
+	seen := make(map[string]bool, len(witIDs))
+	for _, id := range witIDs {
+		w, ok := cfg.ws[id]
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown witness ID %q", id)
+		}
+		if seen[id] {
+			return nil, status.Errorf(codes.InvalidArgument, "duplicate witness ID %q", id)
+		}
+		seen[id] = true
+		p.Witnesses = append(p.Witnesses, w)
+	}
+	return d.checkpointSatisfying(ctx, cfg, logID, p, time.Time{})
+}
+
+// checkpointSatisfying returns the checkpoint for the log with the largest tree size
+// whose witness signatures satisfy the policy, built from the latest checkpoint and the
+// history stored for each witness. Searching the history means that witnesses whose
+// latest checkpoints are for different tree sizes can still satisfy the policy with a
+// checkpoint that they have all cosigned. If notBefore is not the zero time, then only
+// witness signatures made at or after that time are considered.
+func (d *Distributor) checkpointSatisfying(ctx context.Context, cfg *logsAndWitnesses, logID string, p *config.Policy, notBefore time.Time) ([]byte, error) {
+	l := cfg.ls[logID]
+	var wcps []storage.WitnessCheckpoint
+	if err := d.s.ReadTransaction(ctx, func(ctx context.Context, tx storage.ReadTx) error {
+		latest, err := tx.GetWitnessCheckpoints(ctx, logID)
+		if err != nil {
+			return err
+		}
+		wcps = latest
+		for _, wcp := range latest {
+			if w, ok := cfg.ws[wcp.WitID]; !ok || !l.WitnessAllowed(w) {
+				continue
+			}
+			hcps, err := tx.GetWitnessCheckpointHistory(ctx, logID, wcp.WitID, notBefore, endOfTime)
+			if err != nil {
+				return err
+			}
+			for _, hcp := range hcps {
+				wcps = append(wcps, storage.WitnessCheckpoint{WitID: wcp.WitID, TreeSize: hcp.TreeSize, Timestamp: hcp.Timestamp, Checkpoint: hcp.Checkpoint})
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// Group the checkpoints by their body, so that witnesses that cosigned different
+	// checkpoints for the same tree size (e.g. during a split view) are never combined.
+	// Each group has at most one checkpoint from each witness, the most recently signed.
+	type group struct {
+		size      uint64
+		cps       [][]byte
+		witnesses []note.Verifier
+		times     []time.Time
+	}
+	var groups []*group
+	byBody := make(map[string]*group)
+	for _, wcp := range wcps {
+		w, ok := cfg.ws[wcp.WitID]
+		if !ok || !l.WitnessAllowed(w) {
+			continue
+		}
+		if !notBefore.IsZero() && wcp.Timestamp.Before(notBefore) {
+			continue
+		}
+		body, _, _ := bytes.Cut(wcp.Checkpoint, []byte("\n\n"))
+		g, ok := byBody[string(body)]
+		if !ok {
+			g = &group{size: wcp.TreeSize}
+			byBody[string(body)] = g
+			groups = append(groups, g)
+		}
+		if i := slices.Index(g.witnesses, w); i >= 0 {
+			if wcp.Timestamp.After(g.times[i]) {
+				g.cps[i], g.times[i] = wcp.Checkpoint, wcp.Timestamp
+			}
+			continue
+		}
+		g.cps = append(g.cps, wcp.Checkpoint)
+		g.witnesses = append(g.witnesses, w)
+		g.times = append(g.times, wcp.Timestamp)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].size > groups[j].size })
+	for _, g := range groups {
+		if !p.SatisfiedBy(g.witnesses) {
+			continue
+		}
+		cp, err := checkpoints.Combine(g.cps, l.Verifier, note.VerifierList(g.witnesses...))
+		if err != nil {
+			glog.Warningf("Failed to combine %d checkpoints: %v", len(g.cps), err)
+			continue
+		}
+		return cp, nil
+	}
+	return nil, status.Errorf(codes.NotFound, "no checkpoint for log %q satisfies policy %q", logID, p.Name)
+}
+
+// GetCheckpointHistory returns all of the checkpoints for the log that were accepted from the
+// given witness, and which the witness signed at a time within [since, until). If until is zero
+// then there is no upper bound. Checkpoints are returned in the order in which they were signed.
+func (d *Distributor) GetCheckpointHistory(ctx context.Context, logID, witID string, since, until time.Time) ([][]byte, error) {
+	if _, ok := d.cfg.Load().ls[logID]; !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown log ID %q", logID)
+	}
+	if until.IsZero() {
+		until = endOfTime
+	}
+	if d.historyRetention > 0 {
+		// History that has expired may not have been pruned yet.
+		if notBefore := d.now().Add(-d.historyRetention); since.Before(notBefore) {
+			since = notBefore
+		}
+	}
+	var r [][]byte
+	if err := d.s.ReadTransaction(ctx, func(ctx context.Context, tx storage.ReadTx) error {
+		hcps, err := tx.GetWitnessCheckpointHistory(ctx, logID, witID, since, until)
+		if err != nil {
+			return err
+		}
+		for _, hcp := range hcps {
+			r = append(r, hcp.Checkpoint)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetInconsistencies returns the evidence of inconsistency that has been found for the log,
+// ordered by tree size.
+func (d *Distributor) GetInconsistencies(ctx context.Context, logID string) ([]api.Inconsistency, error) {
+	if _, ok := d.cfg.Load().ls[logID]; !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown log ID %q", logID)
+	}
+	r := []api.Inconsistency{}
+	if err := d.s.ReadTransaction(ctx, func(ctx context.Context, tx storage.ReadTx) error {
+		incs, err := tx.GetInconsistencies(ctx, logID)
+		if err != nil {
+			return err
+		}
+		for _, inc := range incs {
+			r = append(r, api.Inconsistency{
+				TreeSize:    inc.TreeSize,
+				Checkpoints: [2]string{string(inc.CheckpointA), string(inc.CheckpointB)},
+				Proof:       inc.Proof,
+				Discovered:  inc.Discovered,
+			})
+		}
+		return nil
+	}); err != nil {
+		return nil, err
 	}
-	return cp, err
+	return r, nil
 }
 
 // Distribute adds a new witnessed checkpoint to be distributed. This checkpoint must be signed
 // by both the log and the witness specified, and be larger than any previous checkpoint distributed
-// for this pair.
+// for this pair. If a ProofSource has been configured, then it is used to check that the checkpoint
+// is consistent with the previous checkpoint for this pair. If the checkpoint is found to be inconsistent
+// with the previous one, then evidence of this is stored and an error with status
+// `codes.FailedPrecondition` is returned.
 func (d *Distributor) Distribute(ctx context.Context, logID, witID string, nextRaw []byte) error {
-	l, ok := d.ls[logID]
+	return d.DistributeWithProof(ctx, logID, witID, nextRaw, nil)
+}
+
+// DistributeWithProof is like Distribute, but the checkpoint is accompanied by a proof that it is
+// consistent with the previous checkpoint for this pair. If the proof is nil then one is requested
+// from the ProofSource, if there is one. If the proof provided is not from the size of the previous
+// checkpoint, or does not verify, then an error with status `codes.FailedPrecondition` is returned.
+// If the previous checkpoint changes while a proof is fetched, `codes.Aborted` is returned. As the proof
+// provided is not trusted, a proof which fails to verify is never taken as evidence that the log
+// is inconsistent; evidence is only stored for checkpoints of the same size with different hashes,
+// or where a proof from the ProofSource shows that the checkpoints are inconsistent.
+func (d *Distributor) DistributeWithProof(ctx context.Context, logID, witID string, nextRaw []byte, p *api.ConsistencyProof) error {
+	cfg := d.cfg.Load()
+	l, ok := cfg.ls[logID]
 	if !ok {
 		return status.Errorf(codes.InvalidArgument, "unknown unknown log ID %q", logID)
 	}
-	wv, ok := d.ws[witID]
+	wv, ok := cfg.ws[witID]
 	if !ok {
 		return status.Errorf(codes.InvalidArgument, "unknown witness ID %q", witID)
 	}
+	if !l.WitnessAllowed(wv) {
+		return status.Errorf(codes.PermissionDenied, "witness %q is not permitted to cosign log %q", witID, logID)
+	}
 	counterCheckpointUpdateRequests.WithLabelValues(witID).Inc()
 
+	if err := d.checkNoteLimits(nextRaw); err != nil {
+		return err
+	}
 	newCP, _, n, err := log.ParseCheckpoint(nextRaw, l.Origin, l.Verifier, wv)
 	if err != nil {
 		return status.Errorf(codes.InvalidArgument, "failed to parse checkpoint: %v", err)
@@ -184,23 +744,140 @@ func (d *Distributor) Distribute(ctx context.Context, logID, witID string, nextR
 	if len(n.Sigs) != 2 {
 		return status.Errorf(codes.InvalidArgument, "failed to verify log and witness signatures; only verified: %v", n.Sigs)
 	}
+	witTime, err := witnessTimestamp(n, wv)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "failed to read witness timestamp: %v", err)
+	}
+	if d.maxFutureSkew > 0 {
+		if limit := d.now().Add(d.maxFutureSkew); witTime.After(limit) {
+			return status.Errorf(codes.InvalidArgument, "witness timestamp %v is more than %v in the future", witTime, d.maxFutureSkew)
+		}
+	}
 
 	// This is a valid checkpoint for this log for this witness
 	// Now find the previous checkpoint if one exists.
 
-	tx, err := d.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: false})
+	trusted := false
+	if p == nil && d.proofSource != nil {
+		// This is fetched before starting the transaction below to avoid holding it open
+		// while waiting on the proof source.
+		if p, err = d.fetchProof(ctx, logID, witID, newCP.Size); err != nil {
+			return err
+		}
+		trusted = true
+	}
+	sub := submission{
+		cfg:     cfg,
+		logID:   logID,
+		witID:   witID,
+		log:     l,
+		wit:     wv,
+		cp:      newCP,
+		note:    n,
+		witTime: witTime,
+		proof:   p,
+		trusted: trusted,
+		raw:     nextRaw,
+	}
+	if err := d.s.ReadWriteTransaction(ctx, func(ctx context.Context, tx storage.Tx) error {
+		return d.distribute(ctx, tx, sub)
+	}); err != nil {
+		if errors.Is(err, errUnchanged) {
+			counterCheckpointUpdateCoalesced.WithLabelValues(witID).Inc()
+			counterCheckpointUpdateSuccess.WithLabelValues(witID).Inc()
+			return nil
+		}
+		var ie *inconsistencyError
+		if errors.As(err, &ie) {
+			// The evidence is recorded outside of the transaction above, which has been
+			// rolled back because the submission was rejected.
+			d.reportInconsistency(ctx, logID, ie)
+			return status.Errorf(codes.FailedPrecondition, "%v", ie)
+		}
+		return err
+	}
+	counterCheckpointUpdateSuccess.WithLabelValues(witID).Inc()
+	if d.forkProofs != nil {
+		d.startForkDetection(sub)
+	}
+	return nil
+}
+
+// checkNoteLimits checks that a submitted note is within the configured size limits, so
+// that the cost of parsing it and verifying its signatures is bounded.
+func (d *Distributor) checkNoteLimits(raw []byte) error {
+	if len(raw) > d.maxNoteSize {
+		return status.Errorf(codes.ResourceExhausted, "checkpoint note is %d bytes, more than the limit of %d", len(raw), d.maxNoteSize)
+	}
+	// The signatures follow the last blank line of a note, one per line.
+	i := bytes.LastIndex(raw, []byte("\n\n"))
+	if i < 0 {
+		return status.Error(codes.InvalidArgument, "checkpoint note has no signatures")
+	}
+	if n := bytes.Count(raw[i+2:], []byte("\n")); n > d.maxSigLines {
+		return status.Errorf(codes.ResourceExhausted, "checkpoint note has %d signature lines, more than the limit of %d", n, d.maxSigLines)
+	}
+	return nil
+}
+
+// fetchProof returns a consistency proof from the latest checkpoint stored for the log and witness
+// to the tree size provided, or nil if there is no smaller checkpoint to prove consistency with.
+func (d *Distributor) fetchProof(ctx context.Context, logID, witID string, size uint64) (*api.ConsistencyProof, error) {
+	var old storage.WitnessCheckpoint
+	if err := d.s.ReadTransaction(ctx, func(ctx context.Context, tx storage.ReadTx) error {
+		var err error
+		old, err = tx.GetWitnessCheckpoint(ctx, logID, witID)
+		return err
+	}); err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, nil
+		}
+		return nil, status.Errorf(codes.Internal, "failed to query for latest checkpoint: %v", err)
+	}
+	if old.TreeSize == 0 || old.TreeSize >= size {
+		return nil, nil
+	}
+	hashes, err := d.proofSource.ConsistencyProof(ctx, logID, old.TreeSize, size)
 	if err != nil {
-		return status.Errorf(codes.Internal, "failed to begin transaction: %v", err)
+		return nil, status.Errorf(codes.Unavailable, "failed to get consistency proof from size %d to %d: %v", old.TreeSize, size, err)
 	}
-	oldBs, err := getLatestCheckpoint(ctx, tx, logID, witID)
+	return &api.ConsistencyProof{From: old.TreeSize, Hashes: hashes}, nil
+}
+
+// submission is a checkpoint submitted by a witness, which has been verified
+// as being signed by both the log and the witness.
+type submission struct {
+	// cfg is the configuration that the submission was verified against.
+	cfg          *logsAndWitnesses
+	logID, witID string
+	log          config.LogInfo
+	wit          note.Verifier
+	cp           *log.Checkpoint
+	note         *note.Note
+	// witTime is the timestamp from the witness cosignature.
+	witTime time.Time
+	// proof is the consistency proof from the previous checkpoint from the witness,
+	// or nil if there is none.
+	proof *api.ConsistencyProof
+	// trusted is true if the proof came from the ProofSource rather than the submitter,
+	// and so can be taken as evidence of inconsistency if it does not verify.
+	trusted bool
+	// raw is the checkpoint as submitted.
+	raw []byte
+}
+
+// distribute performs the storage operations for Distribute within the transaction provided.
+func (d *Distributor) distribute(ctx context.Context, tx storage.Tx, sub submission) error {
+	logID, witID, l, newCP := sub.logID, sub.witID, sub.log, sub.cp
+	old, err := tx.GetWitnessCheckpoint(ctx, logID, witID)
 	if err != nil {
 		if status.Code(err) != codes.NotFound {
 			return status.Errorf(codes.Internal, "failed to query for latest checkpoint: %v", err)
 		}
 	}
-	if oldBs != nil {
+	if oldBs := old.Checkpoint; oldBs != nil {
 		// To replace a previous checkpoint from the same witness, check that the new one is fresher
-		oldCP, _, _, err := log.ParseCheckpoint(oldBs, l.Origin, l.Verifier, wv)
+		oldCP, _, _, err := log.ParseCheckpoint(oldBs, l.Origin, l.Verifier, sub.wit)
 		if err != nil {
 			// This really shouldn't ever happen unless the DB is corrupted or the config
 			// for the log or verifier has changed.
@@ -211,18 +888,52 @@ func (d *Distributor) Distribute(ctx context.Context, logID, witID string, nextR
 		}
 		if newCP.Size == oldCP.Size {
 			if !bytes.Equal(newCP.Hash, oldCP.Hash) {
-				reportInconsistency(oldBs, nextRaw)
-				return status.Errorf(codes.Internal, "old checkpoint for tree size %d had hash %x but new one has %x", newCP.Size, oldCP.Hash, newCP.Hash)
+				return &inconsistencyError{
+					oldSize: oldCP.Size,
+					newSize: newCP.Size,
+					oldHash: oldCP.Hash,
+					newHash: newCP.Hash,
+					oldRaw:  oldBs,
+					newRaw:  sub.raw,
+				}
 			}
 			// This used to short-circuit here to avoid writes. However, having the most recently witnessed
-			// timestamp available is beneficial to demonstrate freshness.
-			// If there are too many equivalent writes happening, then consider implementing a throttle here.
+			// timestamp available is beneficial to demonstrate freshness, so writes are only skipped below
+			// if the timestamp has not advanced enough to be worth recording.
+		}
+		// Checkpoints stored before timestamps were recorded have a zero timestamp, and so never block this.
+		if sub.witTime.Before(old.Timestamp) {
+			return status.Errorf(codes.AlreadyExists, "checkpoint for log %q and witness %q was signed at %v, cannot update to one signed at %v", logID, witID, old.Timestamp, sub.witTime)
+		}
+		if newCP.Size == oldCP.Size && d.sameSizeInterval > 0 && !sub.witTime.After(old.Timestamp.Add(d.sameSizeInterval)) {
+			return errUnchanged
+		}
+		if newCP.Size > oldCP.Size && sub.proof != nil {
+			if sub.proof.From != oldCP.Size {
+				if sub.trusted {
+					// Another submission got in while the proof was being fetched.
+					return status.Errorf(codes.Aborted, "latest checkpoint for log %q and witness %q changed to size %d while fetching consistency proof", logID, witID, oldCP.Size)
+				}
+				return status.Errorf(codes.FailedPrecondition, "consistency proof is from size %d, but the latest checkpoint for log %q and witness %q is for size %d", sub.proof.From, logID, witID, oldCP.Size)
+			}
+			if err := verifyConsistency(oldCP, newCP, oldBs, sub.raw, sub.proof.Hashes); err != nil {
+				if !sub.trusted {
+					// Anyone can construct a proof that fails to verify, so this is not evidence
+					// of anything other than a bad submission.
+					return status.Errorf(codes.FailedPrecondition, "invalid consistency proof: %v", err)
+				}
+				var ie *inconsistencyError
+				if errors.As(err, &ie) {
+					return err
+				}
+				return status.Errorf(codes.Unavailable, "invalid consistency proof from proof source: %v", err)
+			}
 		}
 	}
 
 	// Remove any unexpected signatures submitted alongside the log+witness we recognised.
-	n.UnverifiedSigs = nil
-	nextRaw, err = note.Sign(n)
+	sub.note.UnverifiedSigs = nil
+	nextRaw, err := note.Sign(sub.note)
 	if err != nil {
 		return status.Errorf(codes.Internal, "failed to serialise note with filtered sigs: %v", err)
 	}
@@ -232,52 +943,34 @@ func (d *Distributor) Distribute(ctx context.Context, logID, witID string, nextR
 	// this witness. We should now store this, and then attempt to merge with other checkpoints for the same
 	// log size to create the checkpoint.N files.
 
-	if _, err := tx.ExecContext(ctx, `REPLACE INTO checkpoints_by_witness (logID, witID, treeSize, chkpt) VALUES (?, ?, ?, ?)`, logID, witID, newCP.Size, nextRaw); err != nil {
-		return status.Errorf(codes.Internal, "ExecContext(): %v", err)
+	if err := tx.PutWitnessCheckpoint(ctx, logID, witID, newCP.Size, sub.witTime, nextRaw); err != nil {
+		return status.Errorf(codes.Internal, "PutWitnessCheckpoint(): %v", err)
 	}
-
-	// Calculate new checkpoint.N given this new checkpoint.
-	rows, err := tx.QueryContext(ctx, "SELECT witID, chkpt FROM checkpoints_by_witness WHERE logID = ? AND treeSize = ? ORDER BY witID ASC", logID, newCP.Size)
-	if err != nil {
-		return status.Errorf(codes.Internal, "QueryContext(): %v", err)
+	if err := tx.AddWitnessCheckpointHistory(ctx, logID, witID, newCP.Size, sub.witTime, nextRaw); err != nil {
+		return status.Errorf(codes.Internal, "AddWitnessCheckpointHistory(): %v", err)
 	}
-	defer func() {
-		if err := rows.Close(); err != nil {
-			glog.Errorf("rows.Close(): %v", err)
-		}
-	}()
-
-	var witnesses []note.Verifier
-	var allCheckpoints [][]byte
-	for rows.Next() {
-		var witID string
-		var cp []byte
-		if err := rows.Scan(&witID, &cp); err != nil {
-			return status.Errorf(codes.Internal, "failed to scan rows: %v", err)
-		}
-		allCheckpoints = append(allCheckpoints, cp)
-		// If there is no known witness ID, this is probably due to an old witness
-		// having been removed from the config.
-		if w, ok := d.ws[witID]; ok {
-			witnesses = append(witnesses, w)
+	if d.historyRetention > 0 {
+		if err := tx.PruneWitnessCheckpointHistory(ctx, logID, witID, d.now().Add(-d.historyRetention)); err != nil {
+			return status.Errorf(codes.Internal, "PruneWitnessCheckpointHistory(): %v", err)
 		}
 	}
 
-	if err := rows.Err(); err != nil {
-		return status.Errorf(codes.Internal, "rows.Err(): %v", err)
+	// Calculate new checkpoint.N given this new checkpoint.
+	wcps, err := tx.GetCheckpointsAtSize(ctx, logID, newCP.Size)
+	if err != nil {
+		return status.Errorf(codes.Internal, "GetCheckpointsAtSize(): %v", err)
 	}
 
+	allCheckpoints, witnesses := d.mergeable(sub.cfg, l, wcps)
 	sigCount := len(witnesses)
-	row := tx.QueryRowContext(ctx, "SELECT treeSize FROM merged_checkpoints WHERE logID = ? AND sigCount = ?", logID, sigCount)
-	if row.Err() != nil {
-		return status.Errorf(codes.Internal, "QueryRowContext(): %v", err)
+	if sigCount == 0 {
+		// This can only happen if the new checkpoint was signed too long ago to be merged.
+		return nil
 	}
-	var lastTreeSize uint64
-	if err := row.Scan(&lastTreeSize); err != nil {
-		if err != sql.ErrNoRows {
-			return status.Errorf(codes.Internal, "Scan(): %v", err)
-		}
-		// If there are no rows then that's fine, we'll allow lastTreeSize to stay at 0
+	// If there is no merged checkpoint then that's fine, we'll allow lastTreeSize to stay at 0
+	lastTreeSize, _, err := tx.GetMergedCheckpoint(ctx, logID, uint32(sigCount))
+	if err != nil && status.Code(err) != codes.NotFound {
+		return status.Errorf(codes.Internal, "GetMergedCheckpoint(): %v", err)
 	}
 	if newCP.Size >= lastTreeSize {
 		// If the new checkpoint is for a tree larger than the current checkpoint.N for this log, then
@@ -288,69 +981,432 @@ func (d *Distributor) Distribute(ctx context.Context, logID, witID string, nextR
 			// Don't treat this as a critical error or the distributor can't accept the new checkpoint.
 			glog.Warningf("Failed to combine %d checkpoints: %v", sigCount, err)
 		} else {
-			_, err = tx.ExecContext(ctx, `REPLACE INTO merged_checkpoints (logID, sigCount, treeSize, chkpt) VALUES (?, ?, ?, ?)`, logID, sigCount, newCP.Size, mergedCP)
-			if err != nil {
+			if err := tx.PutMergedCheckpoint(ctx, logID, uint32(sigCount), newCP.Size, mergedCP); err != nil {
 				return status.Errorf(codes.Internal, "Failed to update checkpoints.%d: %v", sigCount, err)
 			}
 		}
 	}
+	return nil
+}
 
-	if err := tx.Commit(); err != nil {
+// verifyConsistency verifies the consistency proof from checkpoint a to the larger checkpoint b.
+// If the proof shows that the checkpoints are inconsistent then an *inconsistencyError is
+// returned, and if the proof is otherwise invalid then the verification error is returned.
+func verifyConsistency(a, b *log.Checkpoint, aRaw, bRaw []byte, hashes [][]byte) error {
+	err := proof.VerifyConsistency(rfc6962.DefaultHasher, a.Size, b.Size, hashes, a.Hash, b.Hash)
+	if err == nil {
+		return nil
+	}
+	// Only a proof which reproduces the smaller root hash but not the larger one shows
+	// that the checkpoints are inconsistent. Otherwise the proof is just bad.
+	var rme proof.RootMismatchError
+	if !errors.As(err, &rme) || !bytes.Equal(rme.ExpectedRoot, b.Hash) {
 		return err
 	}
-	counterCheckpointUpdateSuccess.WithLabelValues(witID).Inc()
-	return nil
+	return &inconsistencyError{
+		oldSize: a.Size,
+		newSize: b.Size,
+		oldHash: a.Hash,
+		newHash: b.Hash,
+		oldRaw:  aRaw,
+		newRaw:  bRaw,
+		proof:   hashes,
+		err:     err,
+	}
 }
 
-// init ensures that the database is in good order. This must be called before
-// any other method on this object. It is safe to call on subsequent runs of
-// the application as it is idempotent.
-func (d *Distributor) init() error {
-	if _, err := d.db.Exec(`CREATE TABLE IF NOT EXISTS checkpoints_by_witness (
-		logID VARCHAR(200),
-		witID VARCHAR(200),
-		treeSize INTEGER,
-		chkpt BLOB,
-		PRIMARY KEY (logID, witID)
-		)`); err != nil {
-		return err
+// startForkDetection runs detectForks for the submission in the background, unless
+// maxForkChecks checks are already running.
+func (d *Distributor) startForkDetection(sub submission) {
+	select {
+	case d.forkChecks <- struct{}{}:
+	default:
+		counterForkChecksSkipped.WithLabelValues(sub.logID).Inc()
+		glog.Warningf("Not checking checkpoint for log %q from witness %q for forks, as %d checks are already running", sub.logID, sub.witID, maxForkChecks)
+		return
 	}
-	if _, err := d.db.Exec(`CREATE TABLE IF NOT EXISTS merged_checkpoints (
-		logID VARCHAR(200),
-		sigCount INTEGER,
-		treeSize INTEGER,
-		chkpt BLOB,
-		PRIMARY KEY (logID, sigCount)
-		)`); err != nil {
+	d.forkWG.Add(1)
+	go func() {
+		defer func() {
+			<-d.forkChecks
+			d.forkWG.Done()
+		}()
+		// The submission has already been responded to, so this is not bound to its context.
+		ctx, cancel := context.WithTimeout(context.Background(), forkCheckTimeout)
+		defer cancel()
+		d.detectForks(ctx, sub)
+	}()
+}
+
+// WaitForForkDetection blocks until all of the fork detection checks that have been
+// started have finished.
+func (d *Distributor) WaitForForkDetection() {
+	d.forkWG.Wait()
+}
+
+// detectForks checks the newly accepted checkpoint in the submission against the latest
+// checkpoints from the other witnesses for the same log, and reports any inconsistencies.
+// The submission has already been accepted, so failures are logged rather than returned.
+func (d *Distributor) detectForks(ctx context.Context, sub submission) {
+	var wcps []storage.WitnessCheckpoint
+	if err := d.s.ReadTransaction(ctx, func(ctx context.Context, tx storage.ReadTx) error {
+		var err error
+		wcps, err = tx.GetWitnessCheckpoints(ctx, sub.logID)
 		return err
+	}); err != nil {
+		glog.Warningf("Failed to get checkpoints to check for forks of log %q: %v", sub.logID, err)
+		return
+	}
+	// Many witnesses are likely to have cosigned the same checkpoint, which only needs checking once.
+	checked := make(map[string]bool)
+	for _, wcp := range wcps {
+		if wcp.WitID == sub.witID {
+			continue
+		}
+		w, ok := sub.cfg.ws[wcp.WitID]
+		if !ok || !sub.log.WitnessAllowed(w) {
+			continue
+		}
+		other, _, _, err := log.ParseCheckpoint(wcp.Checkpoint, sub.log.Origin, sub.log.Verifier, w)
+		if err != nil {
+			glog.Warningf("Failed to parse checkpoint for log %q from witness %q: %v", sub.logID, wcp.WitID, err)
+			continue
+		}
+		key := fmt.Sprintf("%d/%x", other.Size, other.Hash)
+		if checked[key] {
+			continue
+		}
+		checked[key] = true
+
+		err = d.checkFork(ctx, sub.logID, other, wcp.Checkpoint, sub.cp, sub.raw)
+		var ie *inconsistencyError
+		switch {
+		case errors.As(err, &ie):
+			d.reportInconsistency(ctx, sub.logID, ie)
+		case err != nil:
+			glog.Warningf("Failed to check checkpoint for log %q from witness %q against witness %q: %v", sub.logID, sub.witID, wcp.WitID, err)
+		}
+	}
+}
+
+// checkFork returns an *inconsistencyError if the two checkpoints for the log are inconsistent
+// with each other. Consistency proofs for checkpoints of different sizes are fetched from the
+// fork detection ProofSource.
+func (d *Distributor) checkFork(ctx context.Context, logID string, a *log.Checkpoint, aRaw []byte, b *log.Checkpoint, bRaw []byte) error {
+	if a.Size > b.Size {
+		a, aRaw, b, bRaw = b, bRaw, a, aRaw
+	}
+	if a.Size == b.Size {
+		if bytes.Equal(a.Hash, b.Hash) {
+			return nil
+		}
+		return &inconsistencyError{
+			oldSize: a.Size,
+			newSize: b.Size,
+			oldHash: a.Hash,
+			newHash: b.Hash,
+			oldRaw:  aRaw,
+			newRaw:  bRaw,
+		}
+	}
+	if a.Size == 0 {
+		// The empty tree is consistent with every other tree.
+		return nil
+	}
+	hashes, err := d.forkProofs.ConsistencyProof(ctx, logID, a.Size, b.Size)
+	if err != nil {
+		return fmt.Errorf("failed to get consistency proof from size %d to %d: %v", a.Size, b.Size, err)
+	}
+	if err := verifyConsistency(a, b, aRaw, bRaw, hashes); err != nil {
+		var ie *inconsistencyError
+		if errors.As(err, &ie) {
+			return err
+		}
+		return fmt.Errorf("invalid consistency proof from size %d to %d: %v", a.Size, b.Size, err)
 	}
 	return nil
 }
 
-// getLatestCheckpoint returns the latest checkpoint for the given log and witness pair.
-// If no checkpoint is found then an error with status `codes.NotFound` will be returned,
-// which allows callers to handle this case separately if needed.
-func getLatestCheckpoint(ctx context.Context, tx *sql.Tx, logID, witID string) ([]byte, error) {
-	row := tx.QueryRowContext(ctx, "SELECT chkpt FROM checkpoints_by_witness WHERE logID = ? AND witID = ?", logID, witID)
-	if err := row.Err(); err != nil {
-		return nil, err
+// mergeable returns those of the per-witness checkpoints provided whose signatures
+// can currently be included in a merged checkpoint, along with the witnesses that
+// signed them.
+func (d *Distributor) mergeable(cfg *logsAndWitnesses, l config.LogInfo, wcps []storage.WitnessCheckpoint) ([][]byte, []note.Verifier) {
+	notBefore := d.mergedNotBefore()
+	var cps [][]byte
+	var witnesses []note.Verifier
+	for _, wcp := range wcps {
+		// If there is no known witness ID, this is probably due to an old witness
+		// having been removed from the config. Witnesses may also have been removed
+		// from the set allowed for this log since their checkpoint was stored.
+		w, ok := cfg.ws[wcp.WitID]
+		if !ok || !l.WitnessAllowed(w) {
+			continue
+		}
+		if !notBefore.IsZero() && wcp.Timestamp.Before(notBefore) {
+			continue
+		}
+		cps = append(cps, wcp.Checkpoint)
+		witnesses = append(witnesses, w)
 	}
-	var chkpt []byte
-	if err := row.Scan(&chkpt); err != nil {
-		if err == sql.ErrNoRows {
-			return nil, status.Errorf(codes.NotFound, "no checkpoint for log %q from witness %q", logID, witID)
+	return cps, witnesses
+}
+
+// mergedNotBefore returns the time before which witness signatures are too old to be
+// included in merged checkpoints, or the zero time if there is no limit.
+func (d *Distributor) mergedNotBefore() time.Time {
+	if d.mergedWindow <= 0 {
+		return time.Time{}
+	}
+	return d.now().Add(-d.mergedWindow)
+}
+
+// requestCompaction asks RunCompaction to compact the merged checkpoints as soon as possible.
+func (d *Distributor) requestCompaction() {
+	select {
+	case d.compact <- struct{}{}:
+	default:
+		// A compaction is already pending.
+	}
+}
+
+// RunCompaction calls Compact every interval, and whenever the configuration changes such
+// that merged checkpoints may contain signatures that are no longer accepted, until the
+// context is done. A zero interval only compacts on configuration changes.
+func (d *Distributor) RunCompaction(ctx context.Context, interval time.Duration) error {
+	var tick <-chan time.Time
+	if interval > 0 {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		tick = t.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick:
+		case <-d.compact:
+		}
+		if err := d.Compact(ctx); err != nil {
+			glog.Warningf("Compaction failed: %v", err)
 		}
-		return nil, err
 	}
-	return chkpt, nil
 }
 
-// reportInconsistency makes a note when two checkpoints are found for the same
-// log tree size, but with different hashes.
-// For now, this simply logs an error, but this could be upgraded to write to a
-// new DB table containing this kind of evidence. Care needs to be taken if this
-// approach is followed to ensure that the DB size stays limited, i.e. don't allow
-// the same/similar inconsistencies to be written indefinitely.
-func reportInconsistency(oldCP, newCP []byte) {
-	glog.Errorf("Found inconsistent checkpoints:\n%v\n\n%v", string(oldCP), string(newCP))
+// Compact rebuilds the merged checkpoints for all logs so that they only carry signatures
+// from witnesses that are currently configured and allowed for the log, and which were made
+// within the window set by WithMergedSignatureWindow. Each merged checkpoint is replaced by
+// the checkpoint with the largest tree size that still has that many signatures, taken from
+// either the existing merged checkpoints or the latest checkpoints from each witness.
+// Checkpoint history older than the retention set by WithHistoryRetention is also removed,
+// including that of witnesses which have stopped submitting checkpoints.
+func (d *Distributor) Compact(ctx context.Context) error {
+	cfg := d.cfg.Load()
+	logIDs := make([]string, 0, len(cfg.ls))
+	for id := range cfg.ls {
+		logIDs = append(logIDs, id)
+	}
+	sort.Strings(logIDs)
+	var errs []error
+	for _, logID := range logIDs {
+		if err := d.s.ReadWriteTransaction(ctx, func(ctx context.Context, tx storage.Tx) error {
+			return d.compactLog(ctx, tx, cfg, logID)
+		}); err != nil {
+			errs = append(errs, fmt.Errorf("failed to compact log %q: %v", logID, err))
+		}
+	}
+	if d.historyRetention > 0 {
+		if err := d.s.ReadWriteTransaction(ctx, func(ctx context.Context, tx storage.Tx) error {
+			return tx.PruneCheckpointHistory(ctx, d.now().Add(-d.historyRetention))
+		}); err != nil {
+			errs = append(errs, fmt.Errorf("failed to prune checkpoint history: %v", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// compactLog performs the storage operations for Compact for a single log within the
+// transaction provided.
+func (d *Distributor) compactLog(ctx context.Context, tx storage.Tx, cfg *logsAndWitnesses, logID string) error {
+	l := cfg.ls[logID]
+	mcps, err := tx.GetMergedCheckpoints(ctx, logID)
+	if err != nil {
+		return fmt.Errorf("GetMergedCheckpoints(): %v", err)
+	}
+	wcps, err := tx.GetWitnessCheckpoints(ctx, logID)
+	if err != nil {
+		return fmt.Errorf("GetWitnessCheckpoints(): %v", err)
+	}
+
+	// best is the checkpoint with the largest tree size found for each signature count.
+	// Existing merged checkpoints are considered first so that they are kept in
+	// preference to equivalent ones built from the per-witness checkpoints.
+	best := make(map[uint32]storage.MergedCheckpoint)
+	consider := func(mcp storage.MergedCheckpoint) {
+		if mcp.SigCount == 0 {
+			return
+		}
+		if b, ok := best[mcp.SigCount]; !ok || mcp.TreeSize > b.TreeSize {
+			best[mcp.SigCount] = mcp
+		}
+	}
+	for _, mcp := range mcps {
+		cp, sigCount, err := d.filterSignatures(cfg, l, mcp.Checkpoint)
+		if err != nil {
+			glog.Warningf("Dropping merged checkpoint for log %q with %d signatures: %v", logID, mcp.SigCount, err)
+			continue
+		}
+		consider(storage.MergedCheckpoint{SigCount: sigCount, TreeSize: mcp.TreeSize, Checkpoint: cp})
+	}
+	// The per-witness checkpoints are ordered by tree size, so merge each run of the same size.
+	for i := 0; i < len(wcps); {
+		j := i
+		for j < len(wcps) && wcps[j].TreeSize == wcps[i].TreeSize {
+			j++
+		}
+		cps, witnesses := d.mergeable(cfg, l, wcps[i:j])
+		if len(witnesses) > 0 {
+			cp, err := checkpoints.Combine(cps, l.Verifier, note.VerifierList(witnesses...))
+			if err != nil {
+				glog.Warningf("Failed to combine %d checkpoints: %v", len(cps), err)
+			} else {
+				consider(storage.MergedCheckpoint{SigCount: uint32(len(witnesses)), TreeSize: wcps[i].TreeSize, Checkpoint: cp})
+			}
+		}
+		i = j
+	}
+
+	for _, mcp := range mcps {
+		if _, ok := best[mcp.SigCount]; !ok {
+			if err := tx.DeleteMergedCheckpoint(ctx, logID, mcp.SigCount); err != nil {
+				return fmt.Errorf("DeleteMergedCheckpoint(): %v", err)
+			}
+			counterMergedCompacted.WithLabelValues(logID).Inc()
+		}
+	}
+	old := make(map[uint32][]byte, len(mcps))
+	for _, mcp := range mcps {
+		old[mcp.SigCount] = mcp.Checkpoint
+	}
+	for sigCount, mcp := range best {
+		if bytes.Equal(old[sigCount], mcp.Checkpoint) {
+			continue
+		}
+		if err := tx.PutMergedCheckpoint(ctx, logID, sigCount, mcp.TreeSize, mcp.Checkpoint); err != nil {
+			return fmt.Errorf("PutMergedCheckpoint(): %v", err)
+		}
+		counterMergedCompacted.WithLabelValues(logID).Inc()
+	}
+	return nil
+}
+
+// filterSignatures removes the signatures from a merged checkpoint that cannot currently
+// be included in merged checkpoints, returning the resulting checkpoint along with the
+// number of witness signatures that remain on it.
+func (d *Distributor) filterSignatures(cfg *logsAndWitnesses, l config.LogInfo, raw []byte) ([]byte, uint32, error) {
+	vs := []note.Verifier{l.Verifier}
+	for _, w := range cfg.ws {
+		if l.WitnessAllowed(w) {
+			vs = append(vs, w)
+		}
+	}
+	n, err := note.Open(raw, note.VerifierList(vs...))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open checkpoint: %v", err)
+	}
+	notBefore := d.mergedNotBefore()
+	sigs := make([]note.Signature, 0, len(n.Sigs))
+	var sigCount uint32
+	for _, sig := range n.Sigs {
+		if sig.Hash == l.Verifier.KeyHash() {
+			sigs = append(sigs, sig)
+			continue
+		}
+		if !notBefore.IsZero() {
+			t, err := f_note.CoSigV1Timestamp(sig)
+			if err != nil || t.Before(notBefore) {
+				continue
+			}
+		}
+		sigs = append(sigs, sig)
+		sigCount++
+	}
+	// Signatures from unknown witnesses are dropped.
+	n.Sigs, n.UnverifiedSigs = sigs, nil
+	cp, err := note.Sign(n)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to serialise note with filtered sigs: %v", err)
+	}
+	return cp, sigCount, nil
+}
+
+// witnessTimestamp returns the time at which the witness cosigned the note.
+func witnessTimestamp(n *note.Note, wv note.Verifier) (time.Time, error) {
+	for _, sig := range n.Sigs {
+		if sig.Hash == wv.KeyHash() {
+			return f_note.CoSigV1Timestamp(sig)
+		}
+	}
+	return time.Time{}, fmt.Errorf("no signature from witness %q", wv.Name())
+}
+
+// errUnchanged is returned by distribute when the submission is accepted, but is not written
+// because a checkpoint for the same tree size was recently written for the witness.
+var errUnchanged = errors.New("checkpoint unchanged")
+
+// inconsistencyError is returned when two checkpoints are found for the same
+// log tree size, but with different hashes, or when the consistency proof from
+// an old checkpoint to a new, larger, one fails to verify. When comparing the
+// checkpoints of different witnesses, the old checkpoint is the smaller one.
+type inconsistencyError struct {
+	oldSize, newSize uint64
+	oldHash, newHash []byte
+	oldRaw, newRaw   []byte
+	// proof is the consistency proof between the checkpoints, if their sizes differ.
+	proof [][]byte
+	// err is the error from verifying the proof, if their sizes differ.
+	err error
+}
+
+func (e *inconsistencyError) Error() string {
+	if e.oldSize != e.newSize {
+		return fmt.Sprintf("checkpoint for tree size %d with hash %x is not consistent with old checkpoint for tree size %d with hash %x: %v", e.newSize, e.newHash, e.oldSize, e.oldHash, e.err)
+	}
+	return fmt.Sprintf("old checkpoint for tree size %d had hash %x but new one has %x", e.oldSize, e.oldHash, e.newHash)
+}
+
+// reportInconsistency makes a note when two checkpoints are found to be inconsistent.
+// The evidence is stored so that it can be served to clients, but only once for
+// each pair of hashes, and only up to maxInconsistenciesPerLog entries for a log.
+// Failure to store the evidence is logged rather than returned as the caller is
+// already failing the request.
+func (d *Distributor) reportInconsistency(ctx context.Context, logID string, e *inconsistencyError) {
+	glog.Errorf("Found inconsistent checkpoints:\n%v\n\n%v", string(e.oldRaw), string(e.newRaw))
+	counterInconsistencies.WithLabelValues(logID).Inc()
+
+	inc := storage.Inconsistency{
+		TreeSize:    e.oldSize,
+		TreeSizeB:   e.newSize,
+		HashA:       e.oldHash,
+		HashB:       e.newHash,
+		CheckpointA: e.oldRaw,
+		CheckpointB: e.newRaw,
+		Proof:       e.proof,
+		Discovered:  d.now(),
+	}
+	if inc.TreeSize == inc.TreeSizeB && bytes.Compare(inc.HashA, inc.HashB) > 0 {
+		inc.HashA, inc.HashB = inc.HashB, inc.HashA
+		inc.CheckpointA, inc.CheckpointB = inc.CheckpointB, inc.CheckpointA
+	}
+	var added bool
+	if err := d.s.ReadWriteTransaction(ctx, func(ctx context.Context, tx storage.Tx) error {
+		var err error
+		added, err = tx.AddInconsistency(ctx, logID, inc, maxInconsistenciesPerLog)
+		return err
+	}); err != nil {
+		glog.Errorf("Failed to store evidence of inconsistency for log %q: %v", logID, err)
+		return
+	}
+	if !added {
+		glog.V(1).Infof("Evidence of inconsistency for log %q at size %d was not stored as it is a duplicate or the limit has been reached", logID, e.oldSize)
+	}
 }
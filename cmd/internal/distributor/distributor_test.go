@@ -14,24 +14,42 @@
 package distributor_test
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
 	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/cenkalti/backoff"
 	"github.com/golang/glog"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/ory/dockertest/v3"
+	"github.com/transparency-dev/distributor/api"
 	"github.com/transparency-dev/distributor/cmd/internal/distributor"
+	"github.com/transparency-dev/distributor/cmd/internal/storage"
+	"github.com/transparency-dev/distributor/cmd/internal/storage/memory"
+	"github.com/transparency-dev/distributor/cmd/internal/storage/mysql"
+	"github.com/transparency-dev/distributor/cmd/internal/storage/postgres"
+	"github.com/transparency-dev/distributor/cmd/internal/storage/sqlite"
 	"github.com/transparency-dev/distributor/config"
 	docktest "github.com/transparency-dev/distributor/internal/testonly/docker"
 	"github.com/transparency-dev/formats/log"
 	f_note "github.com/transparency-dev/formats/note"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/merkle/testonly"
 	"golang.org/x/mod/sumdb/note"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -61,17 +79,93 @@ var (
 	witAardvark = fakeWitness{
 		verifier: witnessVerifierOrDie(aardvarkVKey),
 		signer:   witnessSignerOrDie("PRIVATE+KEY+Aardvark+871d50e2+Ad/vysEZw5Etl39nPqMjSyJ74QPxkj6W5aBEpLiJWAf2"),
+		skey:     "PRIVATE+KEY+Aardvark+871d50e2+Ad/vysEZw5Etl39nPqMjSyJ74QPxkj6W5aBEpLiJWAf2",
 	}
 	witBadger = fakeWitness{
 		verifier: witnessVerifierOrDie(badgerVKey),
 		signer:   witnessSignerOrDie("PRIVATE+KEY+Badger+63e95ca6+AcHsxVBBvaa3ACdsuqc6qfqsAkk977TlUZhnG9lOHBly"),
+		skey:     "PRIVATE+KEY+Badger+63e95ca6+AcHsxVBBvaa3ACdsuqc6qfqsAkk977TlUZhnG9lOHBly",
 	}
 	witChameleon = fakeWitness{
 		verifier: witnessVerifierOrDie(chameleonVKey),
 		signer:   witnessSignerOrDie("PRIVATE+KEY+Chameleon+186bccfa+AbA2/ZLbaJDLieWGoz/UbVXlrE6ZaBBCWykVnFo5/pYM"),
+		skey:     "PRIVATE+KEY+Chameleon+186bccfa+AbA2/ZLbaJDLieWGoz/UbVXlrE6ZaBBCWykVnFo5/pYM",
 	}
 )
 
+// storageFactory creates a new, empty, storage instance. The testName is used
+// to keep the state of different tests isolated where the backend is shared.
+type storageFactory func(ctx context.Context, testName string) (storage.Storage, error)
+
+// storageImpl is a storage implementation that the tests in this file are run against.
+type storageImpl struct {
+	name string
+	// needsDocker is true if the implementation relies on a database hosted in docker.
+	needsDocker bool
+	create      storageFactory
+}
+
+// storageImpls lists all of the storage implementations that the tests in this
+// file are run against.
+var storageImpls = []storageImpl{
+	{
+		name:        "memory",
+		needsDocker: false,
+		create: func(ctx context.Context, testName string) (storage.Storage, error) {
+			return memory.New(), nil
+		},
+	},
+	{
+		name:        "mysql",
+		needsDocker: true,
+		create: func(ctx context.Context, testName string) (storage.Storage, error) {
+			db, err := helper.create(testName)
+			if err != nil {
+				return nil, err
+			}
+			return mysql.New(ctx, db)
+		},
+	},
+	{
+		name:        "postgres",
+		needsDocker: true,
+		create: func(ctx context.Context, testName string) (storage.Storage, error) {
+			db, err := pgHelper.create(testName)
+			if err != nil {
+				return nil, err
+			}
+			return postgres.New(ctx, db)
+		},
+	},
+	{
+		name:        "sqlite",
+		needsDocker: false,
+		create: func(ctx context.Context, testName string) (storage.Storage, error) {
+			db, err := sqlite.Open(filepath.Join(sqliteDir, fmt.Sprintf("%s_%d.db", testName, nextSQLiteDB.Add(1))))
+			if err != nil {
+				return nil, err
+			}
+			return sqlite.New(ctx, db)
+		},
+	},
+}
+
+var (
+	// sqliteDir is a temporary directory in which all SQLite test DBs are created.
+	sqliteDir    string
+	nextSQLiteDB atomic.Uint32
+)
+
+// forEachStorage runs f as a subtest against each of the storage implementations.
+func forEachStorage(t *testing.T, f func(t *testing.T, newStorage storageFactory)) {
+	t.Helper()
+	for _, impl := range storageImpls {
+		t.Run(impl.name, func(t *testing.T) {
+			f(t, impl.create)
+		})
+	}
+}
+
 var helper dbHelper
 
 type dbHelper struct {
@@ -104,847 +198,2595 @@ func (h *dbHelper) create(testName string) (*sql.DB, error) {
 	return sql.Open("mysql", connectString)
 }
 
+var pgHelper postgresHelper
+
+type postgresHelper struct {
+	address string
+	nextDB  uint32
+}
+
+func (h *postgresHelper) connect() (*sql.DB, error) {
+	return postgres.Open(fmt.Sprintf("postgres://postgres:secret@%s/postgres?sslmode=disable", h.address))
+}
+
+func (h *postgresHelper) create(testName string) (*sql.DB, error) {
+	db, err := h.connect()
+	if err != nil {
+		return db, err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			glog.Errorf("db.Close(): %v", err)
+		}
+	}()
+	// Unquoted identifiers are folded to lower case by PostgreSQL.
+	dbName := strings.ToLower(fmt.Sprintf("%s_%d", testName, h.nextDB))
+	h.nextDB++
+	_, err = db.Exec(fmt.Sprintf("CREATE DATABASE %s", dbName))
+	if err != nil {
+		return nil, err
+	}
+	return postgres.Open(fmt.Sprintf("postgres://postgres:secret@%s/%s?sslmode=disable", h.address, dbName))
+}
+
 func TestMain(m *testing.M) {
 	flag.Parse()
+
+	var err error
+	sqliteDir, err = os.MkdirTemp("", "distributor_test")
+	if err != nil {
+		glog.Errorf("Could not create SQLite directory: %s", err)
+		os.Exit(1)
+	}
+
+	purge, err := startDockerDatabases()
+	if err != nil {
+		// Docker isn't available in all environments, so only skip the implementations that need it.
+		glog.Warningf("MySQL and PostgreSQL tests skipped: %v", err)
+		impls := make([]storageImpl, 0, len(storageImpls))
+		for _, impl := range storageImpls {
+			if !impl.needsDocker {
+				impls = append(impls, impl)
+			}
+		}
+		storageImpls = impls
+	}
+
+	code := m.Run()
+
+	// You can't defer this because os.Exit doesn't care for defer
+	if purge != nil {
+		purge()
+	}
+	if err := os.RemoveAll(sqliteDir); err != nil {
+		glog.Errorf("Could not remove SQLite directory: %s", err)
+	}
+
+	os.Exit(code)
+}
+
+// startDockerDatabases starts the MySQL and PostgreSQL instances used by the tests,
+// and configures the helpers to connect to them. The returned function must be
+// called to clean up the resources once the tests are complete.
+func startDockerDatabases() (func(), error) {
 	// uses a sensible default on windows (tcp/http) and linux/osx (socket)
 	pool, err := dockertest.NewPool("")
 	if err != nil {
-		glog.Errorf("Distributor Tests skipped: Could not construct pool: %s", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("could not construct pool: %s", err)
 	}
 
 	// uses pool to try to connect to Docker
 	if err := pool.Client.Ping(); err != nil {
 		// These tests rely on the host machine running docker to host the database instance.
-		glog.Errorf("Distributor Tests skipped: Could not connect to Docker: %s", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("could not connect to Docker: %s", err)
 	}
-	// pulls an image, creates a container based on it and runs it
-	resource, err := pool.RunWithOptions(
-		&dockertest.RunOptions{
-			Repository: "mysql",
-			Tag:        "8.0",
-			Env:        []string{"MYSQL_ROOT_PASSWORD=secret"},
-		},
-		docktest.ConfigureHost)
+	var resources []*dockertest.Resource
+	purge := func() {
+		for _, r := range resources {
+			if err := pool.Purge(r); err != nil {
+				glog.Errorf("Could not purge resource: %s", err)
+			}
+		}
+	}
+	run := func(opts *dockertest.RunOptions) (*dockertest.Resource, error) {
+		// pulls an image, creates a container based on it and runs it
+		r, err := pool.RunWithOptions(opts, docktest.ConfigureHost)
+		if err != nil {
+			return nil, fmt.Errorf("could not start resource: %s", err)
+		}
+		resources = append(resources, r)
+		// Tell docker to hard kill the container in 180 seconds
+		if err := r.Expire(180); err != nil {
+			glog.Errorf("resource.Expire(): %v", err)
+		}
+		return r, nil
+	}
+
+	mysqlResource, err := run(&dockertest.RunOptions{
+		Repository: "mysql",
+		Tag:        "8.0",
+		Env:        []string{"MYSQL_ROOT_PASSWORD=secret"},
+	})
 	if err != nil {
-		glog.Errorf("Distributor Tests skipped: Could not start resource: %s", err)
-		os.Exit(1)
+		purge()
+		return nil, err
 	}
-	// Tell docker to hard kill the container in 180 seconds
-	if err := resource.Expire(180); err != nil {
-		glog.Errorf("resource.Expire(): %v", err)
+	pgResource, err := run(&dockertest.RunOptions{
+		Repository: "postgres",
+		Tag:        "16",
+		Env:        []string{"POSTGRES_PASSWORD=secret"},
+	})
+	if err != nil {
+		purge()
+		return nil, err
 	}
 
 	helper = dbHelper{
-		address: docktest.GetAddress(resource),
+		address: docktest.GetAddress(mysqlResource),
+	}
+	pgHelper = postgresHelper{
+		address: docktest.GetAddressForPort(pgResource, "5432"),
+	}
+	// exponential backoff-retry, because the application in the container might not be ready to accept connections yet
+	for _, connect := range []func() (*sql.DB, error){helper.connect, pgHelper.connect} {
+		if err := retry(func() error {
+			db, err := connect()
+			if err != nil {
+				return err
+			}
+			return db.Ping()
+		}); err != nil {
+			purge()
+			return nil, fmt.Errorf("could not connect to database: %s", err)
+		}
+	}
+	return purge, nil
+}
+
+func retry(op func() error) error {
+	bo := backoff.NewExponentialBackOff()
+	bo.MaxInterval = time.Second * 5
+	bo.MaxElapsedTime = time.Minute
+	if err := backoff.Retry(op, bo); err != nil {
+		if bo.NextBackOff() == backoff.Stop {
+			return fmt.Errorf("reached retry deadline (last error: %v)", err)
+		}
+
+		return err
+	}
+	return nil
+}
+
+func TestGetLogs(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, newStorage storageFactory) {
+		ws := map[string]note.Verifier{}
+		testCases := []struct {
+			desc        string
+			logs        map[string]config.LogInfo
+			want        []string
+			wantOrigins []string
+		}{
+			{
+				desc:        "No logs",
+				logs:        map[string]config.LogInfo{},
+				want:        []string{},
+				wantOrigins: []string{},
+			},
+			{
+				desc: "One log",
+				logs: map[string]config.LogInfo{
+					"FooLog": logFoo.LogInfo,
+				},
+				want:        []string{"FooLog"},
+				wantOrigins: []string{"from foo"},
+			},
+			{
+				desc: "Two logs",
+				logs: map[string]config.LogInfo{
+					"FooLog": logFoo.LogInfo,
+					"BarLog": logBar.LogInfo,
+				},
+				want:        []string{"BarLog", "FooLog"},
+				wantOrigins: []string{"from bar", "from foo"},
+			},
+		}
+		for _, tC := range testCases {
+			t.Run(tC.desc, func(t *testing.T) {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				s, err := newStorage(ctx, "TestGetLogs")
+				if err != nil {
+					t.Fatalf("newStorage(): %v", err)
+				}
+				d, err := distributor.NewDistributor(ws, tC.logs, s)
+				if err != nil {
+					t.Fatalf("NewDistributor(): %v", err)
+				}
+				got, err := d.GetLogs(ctx)
+				if err != nil {
+					t.Errorf("GetLogs(): %v", err)
+				}
+				if !cmp.Equal(got, tC.want) {
+					t.Errorf("got %q, want %q", got, tC.want)
+				}
+				gotOrigins, err := d.GetLogOrigins(ctx)
+				if err != nil {
+					t.Errorf("GetLogOrigins(): %v", err)
+				}
+				if !cmp.Equal(gotOrigins, tC.wantOrigins) {
+					t.Errorf("got origins %q, want %q", gotOrigins, tC.wantOrigins)
+				}
+			})
+		}
+	})
+}
+
+func TestDistributeLogAndWitnessMustMatchCheckpoint(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, newStorage storageFactory) {
+		ws := map[string]note.Verifier{
+			aardvarkVKey: witAardvark.verifier,
+			badgerVKey:   witBadger.verifier,
+		}
+		ls := map[string]config.LogInfo{
+			"FooLog": logFoo.LogInfo,
+			"BarLog": logBar.LogInfo,
+		}
+		testCases := []struct {
+			desc     string
+			reqLogID string
+			reqWitID string
+			log      fakeLog
+			wit      fakeWitness
+			wantErr  bool
+		}{
+			{
+				desc:     "Correct log and witness: foo and aardvark",
+				reqLogID: "FooLog",
+				reqWitID: "Aardvark",
+				log:      logFoo,
+				wit:      witAardvark,
+				wantErr:  false,
+			},
+			{
+				desc:     "Correct log and witness: bar and badger",
+				reqLogID: "BarLog",
+				reqWitID: "Badger",
+				log:      logBar,
+				wit:      witBadger,
+				wantErr:  false,
+			},
+			{
+				desc:     "Correct log wrong witness",
+				reqLogID: "FooLog",
+				reqWitID: "Aardvark",
+				log:      logFoo,
+				wit:      witBadger,
+				wantErr:  true,
+			},
+			{
+				desc:     "Wrong log correct witness",
+				reqLogID: "BarLog",
+				reqWitID: "Aardvark",
+				log:      logFoo,
+				wit:      witAardvark,
+				wantErr:  true,
+			},
+			{
+				desc:     "Wrong log wrong witness",
+				reqLogID: "BarLog",
+				reqWitID: "Aardvark",
+				log:      logFoo,
+				wit:      witBadger,
+				wantErr:  true,
+			},
+			{
+				desc:     "Unknown log known witness",
+				reqLogID: "DogNotLog",
+				reqWitID: "Badger",
+				log:      logFoo,
+				wit:      witBadger,
+				wantErr:  true,
+			},
+			{
+				desc:     "Correct log unknown witness",
+				reqLogID: "FooLog",
+				reqWitID: "WhatAWally",
+				log:      logFoo,
+				wit:      witBadger,
+				wantErr:  true,
+			},
+		}
+		for _, tC := range testCases {
+			t.Run(tC.desc, func(t *testing.T) {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				s, err := newStorage(ctx, "TestDistributeLogAndWitnessMustMatchCheckpoint")
+				if err != nil {
+					t.Fatalf("newStorage(): %v", err)
+				}
+				d, err := distributor.NewDistributor(ws, ls, s)
+				if err != nil {
+					t.Fatalf("NewDistributor(): %v", err)
+				}
+
+				logCP16 := tC.log.checkpoint(16, "16", tC.wit.signer)
+				err = d.Distribute(ctx, tC.reqLogID, tC.reqWitID, logCP16)
+				if (err != nil) != tC.wantErr {
+					t.Errorf("unexpected error output (wantErr: %t): %v", tC.wantErr, err)
+				}
+			})
+		}
+	})
+}
+
+func TestDistributeEvolution(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, newStorage storageFactory) {
+		// The base case for this test is that a single checkpoint has already
+		// been registered for log foo, by aardvark, at tree size 16, with root hash H("16").
+		ws := map[string]note.Verifier{
+			aardvarkVKey: witAardvark.verifier,
+			badgerVKey:   witBadger.verifier,
+		}
+		ls := map[string]config.LogInfo{
+			"FooLog": logFoo.LogInfo,
+			"BarLog": logBar.LogInfo,
+		}
+		testCases := []struct {
+			desc     string
+			log      fakeLog
+			wit      fakeWitness
+			size     uint64
+			hashSeed string
+			wantErr  bool
+		}{
+			{
+				desc:     "aardvark a bit bigger",
+				log:      logFoo,
+				wit:      witAardvark,
+				size:     18,
+				hashSeed: "18",
+				wantErr:  false,
+			},
+			{
+				desc:     "aardvark smaller",
+				log:      logFoo,
+				wit:      witAardvark,
+				size:     11,
+				hashSeed: "11",
+				wantErr:  true,
+			},
+			{
+				desc:     "aardvark same",
+				log:      logFoo,
+				wit:      witAardvark,
+				size:     16,
+				hashSeed: "16",
+				wantErr:  false,
+			},
+			{
+				desc:     "aardvark same size but different hash",
+				log:      logFoo,
+				wit:      witAardvark,
+				size:     16,
+				hashSeed: "not 16",
+				wantErr:  true,
+			},
+			{
+				desc:     "aardvark smaller different log",
+				log:      logBar,
+				wit:      witAardvark,
+				size:     11,
+				hashSeed: "11",
+				wantErr:  false,
+			},
+			{
+				desc:     "badger smaller",
+				log:      logFoo,
+				wit:      witBadger,
+				size:     11,
+				hashSeed: "11",
+				wantErr:  false,
+			},
+			{
+				desc:     "badger same size",
+				log:      logFoo,
+				wit:      witBadger,
+				size:     16,
+				hashSeed: "16",
+				wantErr:  false,
+			},
+			{
+				desc:     "badger same size but different hash",
+				log:      logFoo,
+				wit:      witBadger,
+				size:     16,
+				hashSeed: "not 16",
+				wantErr:  false, // We don't check consistency with all witnesses on write
+			},
+		}
+		for _, tC := range testCases {
+			t.Run(tC.desc, func(t *testing.T) {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				s, err := newStorage(ctx, "TestDistributeEvolution")
+				if err != nil {
+					t.Fatalf("newStorage(): %v", err)
+				}
+				d, err := distributor.NewDistributor(ws, ls, s)
+				if err != nil {
+					t.Fatalf("NewDistributor(): %v", err)
+				}
+				err = d.Distribute(ctx, "FooLog", "Aardvark", logFoo.checkpoint(16, "16", witAardvark.signer))
+				if err != nil {
+					t.Fatalf("Distribute(): %v", err)
+				}
+
+				err = d.Distribute(ctx, tC.log.Verifier.Name(), tC.wit.verifier.Name(), tC.log.checkpoint(tC.size, tC.hashSeed, tC.wit.signer))
+				if (err != nil) != tC.wantErr {
+					t.Errorf("unexpected error output (wantErr: %t): %v", tC.wantErr, err)
+				}
+			})
+		}
+	})
+}
+
+func TestGetCheckpointWitness(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, newStorage storageFactory) {
+		// The base case for this test is that a single checkpoint has already
+		// been registered for log foo, by aardvark, at tree size 16, with root hash H("16").
+		ws := map[string]note.Verifier{
+			aardvarkVKey: witAardvark.verifier,
+			badgerVKey:   witBadger.verifier,
+		}
+		ls := map[string]config.LogInfo{
+			"FooLog": logFoo.LogInfo,
+			"BarLog": logBar.LogInfo,
+		}
+		testCases := []struct {
+			desc    string
+			log     fakeLog
+			wit     fakeWitness
+			wantErr bool
+		}{
+			{
+				desc:    "read back same cp",
+				log:     logFoo,
+				wit:     witAardvark,
+				wantErr: false,
+			},
+			{
+				desc:    "same log, different witness",
+				log:     logFoo,
+				wit:     witBadger,
+				wantErr: true,
+			},
+			{
+				desc:    "different log, same witness",
+				log:     logBar,
+				wit:     witAardvark,
+				wantErr: true,
+			},
+			{
+				desc:    "different log, different witness",
+				log:     logBar,
+				wit:     witBadger,
+				wantErr: true,
+			},
+		}
+		for _, tC := range testCases {
+			t.Run(tC.desc, func(t *testing.T) {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				s, err := newStorage(ctx, "TestGetCheckpointWitness")
+				if err != nil {
+					t.Fatalf("newStorage(): %v", err)
+				}
+				d, err := distributor.NewDistributor(ws, ls, s)
+				if err != nil {
+					t.Fatalf("NewDistributor(): %v", err)
+				}
+				writeCP := logFoo.checkpoint(16, "16", witAardvark.signer)
+				err = d.Distribute(ctx, "FooLog", "Aardvark", writeCP)
+				if err != nil {
+					t.Fatalf("Distribute(): %v", err)
+				}
+
+				readCP, err := d.GetCheckpointWitness(ctx, tC.log.Verifier.Name(), tC.wit.verifier.Name(), 0)
+				if (err != nil) != tC.wantErr {
+					t.Errorf("unexpected error output (wantErr: %t): %v", tC.wantErr, err)
+				}
+				if !tC.wantErr {
+					if !cmp.Equal(readCP, writeCP) {
+						t.Errorf("Written checkpoint != read checkpoint. Read\n%v\n\nWrote:\n%v", readCP, writeCP)
+					}
+				}
+			})
+		}
+	})
+}
+
+func TestFiltersUnknownSignatures(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, newStorage storageFactory) {
+		ws := map[string]note.Verifier{
+			aardvarkVKey: witAardvark.verifier,
+		}
+		ls := map[string]config.LogInfo{
+			"FooLog": logFoo.LogInfo,
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s, err := newStorage(ctx, "TestFiltersUnknownSignatures")
+		if err != nil {
+			t.Fatalf("newStorage(): %v", err)
+		}
+		d, err := distributor.NewDistributor(ws, ls, s)
+		if err != nil {
+			t.Fatalf("NewDistributor(): %v", err)
+		}
+		writeCP := logFoo.checkpoint(16, "16", witAardvark.signer, witChameleon.signer)
+
+		// Assert there we're starting with a surplus of signatures
+		wN, err := note.Open(writeCP, note.VerifierList([]note.Verifier{logFoo.Verifier, witAardvark.verifier, witChameleon.verifier}...))
+		if err != nil {
+			t.Fatalf("Open(writeCP): %v", err)
+		}
+		if got, want := len(wN.Sigs), 3; got != want {
+			t.Errorf("Sanity failure, want 1 log + 2 witness sigs on submitted checkpoint, got %d", got)
+		}
+
+		// Send checkpoint with "unknown" witness signature to distro
+		err = d.Distribute(ctx, "FooLog", "Aardvark", writeCP)
+		if err != nil {
+			t.Fatalf("Distribute(): %v", err)
+		}
+
+		// Assert that we get back a checkpoint with only signatures from the log and exptected witness
+		readCP, err := d.GetCheckpointWitness(ctx, logFoo.Verifier.Name(), witAardvark.verifier.Name(), 0)
+		if err != nil {
+			t.Errorf("GetCheckpointWitness: %v", err)
+		}
+		rN, err := note.Open(readCP, note.VerifierList([]note.Verifier{logFoo.Verifier, witAardvark.verifier, witChameleon.verifier}...))
+		if err != nil {
+			t.Fatalf("Open(readCP): %v", err)
+		}
+		if gotSig, wantSig, gotUnverified, wantUnverified := len(rN.Sigs), 2, len(rN.UnverifiedSigs), 0; gotSig != wantSig || gotUnverified != wantUnverified {
+			t.Errorf("got %d sigs want %d, got %d unverified sigs want %d:\n%v", gotSig, wantSig, gotUnverified, wantUnverified, string(readCP))
+		}
+	})
+}
+
+func TestDisappearingWitness(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, newStorage storageFactory) {
+		ws := map[string]note.Verifier{
+			aardvarkVKey: witAardvark.verifier,
+			badgerVKey:   witBadger.verifier,
+		}
+		ls := map[string]config.LogInfo{
+			"FooLog": logFoo.LogInfo,
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s, err := newStorage(ctx, "TestDisappearingWitness")
+		if err != nil {
+			t.Fatalf("newStorage(): %v", err)
+		}
+
+		// Put a checkpoint in sigs from a known witness.
+		{
+			d, err := distributor.NewDistributor(ws, ls, s)
+			if err != nil {
+				t.Fatalf("NewDistributor(): %v", err)
+			}
+
+			writeCP := logFoo.checkpoint(16, "16", witAardvark.signer)
+			err = d.Distribute(ctx, "FooLog", "Aardvark", writeCP)
+			if err != nil {
+				t.Fatalf("Distribute(): %v", err)
+			}
+		}
+
+		// Now remove one of the witnesses; it was a bad aardvark.
+		ws = map[string]note.Verifier{
+			badgerVKey:    witBadger.verifier,
+			chameleonVKey: witChameleon.verifier,
+		}
+
+		// Now recreate the distributor instance to represent re-deploying after the config update, and
+		// try to update the checkpoint with a new signature from another known witness.
+		{
+			d, err := distributor.NewDistributor(ws, ls, s)
+			if err != nil {
+				t.Fatalf("NewDistributor(): %v", err)
+			}
+
+			writeCP := logFoo.checkpoint(16, "16", witBadger.signer)
+			err = d.Distribute(ctx, "FooLog", "Badger", writeCP)
+			if err != nil {
+				t.Fatalf("Distribute(): %v", err)
+			}
+		}
+	})
+}
+
+func TestGetCheckpointN(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, newStorage storageFactory) {
+		// The base case for this test is that 2 checkpoints have already been written:
+		//  - aardvark, at tree size 16
+		//  - chameleon, at tree size 14
+		ws := map[string]note.Verifier{
+			aardvarkVKey: witAardvark.verifier,
+			badgerVKey:   witBadger.verifier,
+			"Chameleon":  witChameleon.verifier,
+		}
+		ls := map[string]config.LogInfo{
+			"FooLog": logFoo.LogInfo,
+			"BarLog": logBar.LogInfo,
+		}
+		testCases := []struct {
+			desc        string
+			distWit     fakeWitness
+			distLog     fakeLog
+			distSize    uint64
+			reqLog      string
+			reqN        uint32
+			wantErr     bool
+			wantErrCode codes.Code
+			wantSize    uint64
+			wantWits    []note.Verifier
+		}{
+			{
+				desc:        "unknown log is error",
+				distWit:     witBadger,
+				distLog:     logFoo,
+				distSize:    10,
+				reqLog:      "ThisIsNotTheLogYouAreLookingFor",
+				reqN:        1,
+				wantErr:     true,
+				wantErrCode: codes.InvalidArgument,
+			},
+			{
+				desc:     "smaller checkpoint doesn't win",
+				distWit:  witBadger,
+				distLog:  logFoo,
+				distSize: 10,
+				reqLog:   "FooLog",
+				reqN:     1,
+				wantErr:  false,
+				wantSize: 16,
+				wantWits: []note.Verifier{witAardvark.verifier},
+			},
+			{
+				desc:     "larger checkpoint wins",
+				distWit:  witBadger,
+				distLog:  logFoo,
+				distSize: 20,
+				reqLog:   "FooLog",
+				reqN:     1,
+				wantErr:  false,
+				wantSize: 20,
+				wantWits: []note.Verifier{witBadger.verifier},
+			},
+			{
+				desc:     "same size checkpoint merges",
+				distWit:  witBadger,
+				distLog:  logFoo,
+				distSize: 16,
+				reqLog:   "FooLog",
+				reqN:     2,
+				wantErr:  false,
+				wantSize: 16,
+				wantWits: []note.Verifier{witBadger.verifier, witAardvark.verifier},
+			},
+			{
+				desc:     "merge with smaller checkpoint",
+				distWit:  witBadger,
+				distLog:  logFoo,
+				distSize: 14,
+				reqLog:   "FooLog",
+				reqN:     2,
+				wantErr:  false,
+				wantSize: 14,
+				wantWits: []note.Verifier{witBadger.verifier, witChameleon.verifier},
+			},
+			{
+				desc:        "error returned if not enough sigs",
+				distWit:     witBadger,
+				distLog:     logFoo,
+				distSize:    16,
+				reqLog:      "FooLog",
+				reqN:        3,
+				wantErr:     true,
+				wantErrCode: codes.NotFound,
+			},
+			{
+				desc:        "zero invalid",
+				distWit:     witBadger,
+				distLog:     logFoo,
+				distSize:    16,
+				reqLog:      "FooLog",
+				reqN:        0,
+				wantErr:     true,
+				wantErrCode: codes.InvalidArgument,
+			},
+			{
+				desc:        "huge number invalid",
+				distWit:     witBadger,
+				distLog:     logFoo,
+				distSize:    16,
+				reqLog:      "FooLog",
+				reqN:        999,
+				wantErr:     true,
+				wantErrCode: codes.InvalidArgument,
+			},
+		}
+		for _, tC := range testCases {
+			t.Run(tC.desc, func(t *testing.T) {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				s, err := newStorage(ctx, "TestGetCheckpointN")
+				if err != nil {
+					t.Fatalf("newStorage(): %v", err)
+				}
+				d, err := distributor.NewDistributor(ws, ls, s)
+				if err != nil {
+					t.Fatalf("NewDistributor(): %v", err)
+				}
+				if err := d.Distribute(ctx, "FooLog", "Aardvark", logFoo.checkpoint(16, "16", witAardvark.signer)); err != nil {
+					t.Fatal(err)
+				}
+				if err := d.Distribute(ctx, "FooLog", "Chameleon", logFoo.checkpoint(14, "14", witChameleon.signer)); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := d.Distribute(ctx, tC.distLog.Verifier.Name(), tC.distWit.verifier.Name(), tC.distLog.checkpoint(tC.distSize, fmt.Sprintf("%d", tC.distSize), tC.distWit.signer)); err != nil {
+					t.Fatal(err)
+				}
+
+				cpRaw, err := d.GetCheckpointN(ctx, tC.reqLog, tC.reqN, 0)
+				if (err != nil) != tC.wantErr {
+					t.Fatalf("unexpected error output (wantErr: %t): %v", tC.wantErr, err)
+				}
+				if !tC.wantErr {
+					cp, _, n, err := log.ParseCheckpoint(cpRaw, tC.distLog.Origin, tC.distLog.Verifier, tC.wantWits...)
+					if err != nil {
+						t.Error(err)
+					}
+					if got, want := len(n.Sigs), 1+len(tC.wantWits); got != want {
+						t.Errorf("expected %d sigs, got %d", want, got)
+					}
+					if cp.Size != tC.wantSize {
+						t.Errorf("expected tree size of %d but got %d", tC.wantSize, cp.Size)
+					}
+				} else {
+					if got, want := status.Code(err), tC.wantErrCode; got != want {
+						t.Errorf("error code got != want: %v != %v", got, want)
+					}
+				}
+			})
+		}
+	})
+}
+
+func TestGetCheckpointNHistoric(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, newStorage storageFactory) {
+		ws := map[string]note.Verifier{
+			aardvarkVKey: witAardvark.verifier,
+			badgerVKey:   witBadger.verifier,
+			"Chameleon":  witChameleon.verifier,
+		}
+		ls := map[string]config.LogInfo{
+			"FooLog": logFoo.LogInfo,
+		}
+		type witnessAndSize struct {
+			wit  fakeWitness
+			size uint64
+		}
+		testCases := []struct {
+			desc        string
+			order       []witnessAndSize
+			reqN        uint32
+			wantErr     bool
+			wantErrCode codes.Code
+			wantSize    uint64
+			wantWits    []note.Verifier
+		}{
+			{
+				desc: "N=1 gets latest version",
+				order: []witnessAndSize{
+					{
+						witChameleon,
+						10,
+					},
+					{
+						witBadger,
+						10,
+					},
+					{
+						witChameleon,
+						22,
+					},
+				},
+				reqN:     1,
+				wantErr:  false,
+				wantSize: 22,
+			},
+			{
+				desc: "N=2 can get historic version where both were in sync together",
+				order: []witnessAndSize{
+					{
+						witChameleon,
+						10,
+					},
+					{
+						witBadger,
+						10,
+					},
+					{
+						witChameleon,
+						22,
+					},
+				},
+				reqN:     2,
+				wantErr:  false,
+				wantSize: 10,
+			},
+			{
+				desc: "TODO: N=2 can get historic version where both have been seen but not at same time",
+				order: []witnessAndSize{
+					{
+						witChameleon,
+						10,
+					},
+					{
+						witChameleon,
+						22,
+					},
+					{
+						witBadger,
+						10,
+					},
+				},
+				reqN:        2,
+				wantErr:     true,
+				wantErrCode: codes.NotFound,
+				// TODO(#103): this case should work with the following assertions
+				// wantErr: false,
+				// wantSize: 10,
+			},
+		}
+		for _, tC := range testCases {
+			t.Run(tC.desc, func(t *testing.T) {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				s, err := newStorage(ctx, "TestGetCheckpointN")
+				if err != nil {
+					t.Fatalf("newStorage(): %v", err)
+				}
+				d, err := distributor.NewDistributor(ws, ls, s)
+				if err != nil {
+					t.Fatalf("NewDistributor(): %v", err)
+				}
+				for _, was := range tC.order {
+					if err := d.Distribute(ctx, "FooLog", was.wit.verifier.Name(), logFoo.checkpoint(was.size, fmt.Sprintf("%d", was.size), was.wit.signer)); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				cpRaw, err := d.GetCheckpointN(ctx, "FooLog", tC.reqN, 0)
+				if (err != nil) != tC.wantErr {
+					t.Fatalf("unexpected error output (wantErr: %t): %v", tC.wantErr, err)
+				}
+				if !tC.wantErr {
+					cp, _, n, err := log.ParseCheckpoint(cpRaw, logFoo.Origin, logFoo.Verifier, tC.wantWits...)
+					if err != nil {
+						t.Error(err)
+					}
+					if got, want := len(n.Sigs), 1+len(tC.wantWits); got != want {
+						t.Errorf("expected %d sigs, got %d", want, got)
+					}
+					if cp.Size != tC.wantSize {
+						t.Errorf("expected tree size of %d but got %d", tC.wantSize, cp.Size)
+					}
+				} else {
+					if got, want := status.Code(err), tC.wantErrCode; got != want {
+						t.Errorf("error code got != want: %v != %v", got, want)
+					}
+				}
+			})
+		}
+	})
+}
+
+func TestGetCheckpointNAtLeastN(t *testing.T) {
+	ws := map[string]note.Verifier{
+		aardvarkVKey: witAardvark.verifier,
+		badgerVKey:   witBadger.verifier,
+		"Chameleon":  witChameleon.verifier,
+	}
+	ls := map[string]config.LogInfo{
+		"FooLog": logFoo.LogInfo,
+	}
+	type witnessAndSize struct {
+		wit  fakeWitness
+		size uint64
+	}
+	testCases := []struct {
+		desc  string
+		order []witnessAndSize
+		// seed3 is written directly to storage as the merged checkpoint with
+		// 3 signatures, if non-zero. This allows a fresher merge with more
+		// signatures to exist than any merge with fewer signatures.
+		seed3    uint64
+		reqN     uint32
+		wantSize uint64
+		wantWits []note.Verifier
+	}{
+		{
+			desc: "fresher merge with more sigs wins",
+			order: []witnessAndSize{
+				{witAardvark, 16},
+				{witBadger, 16},
+			},
+			seed3:    20,
+			reqN:     2,
+			wantSize: 20,
+			wantWits: []note.Verifier{witAardvark.verifier, witBadger.verifier, witChameleon.verifier},
+		},
+		{
+			desc: "fresher merge with more sigs wins for N=1",
+			order: []witnessAndSize{
+				{witAardvark, 16},
+			},
+			seed3:    20,
+			reqN:     1,
+			wantSize: 20,
+			wantWits: []note.Verifier{witAardvark.verifier, witBadger.verifier, witChameleon.verifier},
+		},
+		{
+			desc: "staler merge with more sigs loses",
+			order: []witnessAndSize{
+				{witAardvark, 22},
+				{witBadger, 22},
+			},
+			seed3:    20,
+			reqN:     2,
+			wantSize: 22,
+			wantWits: []note.Verifier{witAardvark.verifier, witBadger.verifier},
+		},
+		{
+			desc: "same size prefers most sigs",
+			order: []witnessAndSize{
+				{witAardvark, 20},
+				{witBadger, 20},
+				{witChameleon, 20},
+			},
+			reqN:     1,
+			wantSize: 20,
+			wantWits: []note.Verifier{witAardvark.verifier, witBadger.verifier, witChameleon.verifier},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			forEachStorage(t, func(t *testing.T, newStorage storageFactory) {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				s, err := newStorage(ctx, "TestGetCheckpointNAtLeastN")
+				if err != nil {
+					t.Fatalf("newStorage(): %v", err)
+				}
+				d, err := distributor.NewDistributor(ws, ls, s)
+				if err != nil {
+					t.Fatalf("NewDistributor(): %v", err)
+				}
+				for _, was := range tC.order {
+					if err := d.Distribute(ctx, "FooLog", was.wit.verifier.Name(), logFoo.checkpoint(was.size, fmt.Sprintf("%d", was.size), was.wit.signer)); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if tC.seed3 > 0 {
+					cp := logFoo.checkpoint(tC.seed3, fmt.Sprintf("%d", tC.seed3), witAardvark.signer, witBadger.signer, witChameleon.signer)
+					if err := s.ReadWriteTransaction(ctx, func(ctx context.Context, tx storage.Tx) error {
+						return tx.PutMergedCheckpoint(ctx, "FooLog", 3, tC.seed3, cp)
+					}); err != nil {
+						t.Fatalf("PutMergedCheckpoint(): %v", err)
+					}
+				}
+
+				cpRaw, err := d.GetCheckpointN(ctx, "FooLog", tC.reqN, 0)
+				if err != nil {
+					t.Fatalf("GetCheckpointN(): %v", err)
+				}
+				cp, _, n, err := log.ParseCheckpoint(cpRaw, logFoo.Origin, logFoo.Verifier, tC.wantWits...)
+				if err != nil {
+					t.Fatalf("ParseCheckpoint(): %v", err)
+				}
+				if got, want := len(n.Sigs), 1+len(tC.wantWits); got != want {
+					t.Errorf("expected %d sigs, got %d", want, got)
+				}
+				if cp.Size != tC.wantSize {
+					t.Errorf("expected tree size of %d but got %d", tC.wantSize, cp.Size)
+				}
+			})
+		})
+	}
+}
+
+func logVerifierOrDie(vkey string) note.Verifier {
+	v, err := note.NewVerifier(vkey)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func logSignerOrDie(skey string) note.Signer {
+	s, err := note.NewSigner(skey)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func witnessVerifierOrDie(vkey string) note.Verifier {
+	v, err := f_note.NewVerifierForCosignatureV1(vkey)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func witnessSignerOrDie(skey string) note.Signer {
+	s, err := f_note.NewSignerForCosignatureV1(skey)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+type fakeLog struct {
+	config.LogInfo
+	signer note.Signer
+}
+
+func (l fakeLog) checkpoint(size uint64, hashSeed string, wit ...note.Signer) []byte {
+	hbs := sha256.Sum256([]byte(hashSeed))
+	return l.checkpointWithHash(size, hbs[:], wit...)
+}
+
+func (l fakeLog) checkpointWithHash(size uint64, hash []byte, wit ...note.Signer) []byte {
+	rawCP := log.Checkpoint{
+		Origin: l.Origin,
+		Size:   size,
+		Hash:   hash,
+	}.Marshal()
+	n := note.Note{}
+	n.Text = string(rawCP)
+	bs, err := note.Sign(&n, append([]note.Signer{l.signer}, wit...)...)
+	if err != nil {
+		panic(err)
+	}
+	return bs
+}
+
+type fakeWitness struct {
+	verifier note.Verifier
+	signer   note.Signer
+	skey     string
+}
+
+// signerAt returns a signer for the witness which produces cosignature/v1
+// signatures with the given timestamp, rather than the current time.
+func (w fakeWitness) signerAt(t time.Time) note.Signer {
+	parts := strings.Split(w.skey, "+")
+	key, err := base64.StdEncoding.DecodeString(parts[4])
+	if err != nil {
+		panic(err)
+	}
+	return &timedSigner{
+		name: w.signer.Name(),
+		hash: w.signer.KeyHash(),
+		key:  ed25519.NewKeyFromSeed(key[1:]),
+		t:    t,
+	}
+}
+
+// timedSigner creates Ed25519 cosignature/v1 signatures with a fixed timestamp.
+type timedSigner struct {
+	name string
+	hash uint32
+	key  ed25519.PrivateKey
+	t    time.Time
+}
+
+func (s *timedSigner) Name() string    { return s.name }
+func (s *timedSigner) KeyHash() uint32 { return s.hash }
+func (s *timedSigner) Sign(msg []byte) ([]byte, error) {
+	ts := uint64(s.t.Unix())
+	m := fmt.Sprintf("cosignature/v1\ntime %d\n%s", ts, msg)
+	return append(binary.BigEndian.AppendUint64(nil, ts), ed25519.Sign(s.key, []byte(m))...), nil
+}
+
+func TestCheckpointHistory(t *testing.T) {
+	ws := map[string]note.Verifier{
+		aardvarkVKey: witAardvark.verifier,
+		badgerVKey:   witBadger.verifier,
+	}
+	ls := map[string]config.LogInfo{
+		"FooLog": logFoo.LogInfo,
+	}
+	now := time.Now().Truncate(time.Second)
+	testCases := []struct {
+		desc         string
+		retention    time.Duration
+		since, until time.Time
+		wantSizes    []uint64
+	}{
+		{
+			desc:      "all history kept by default",
+			since:     now.Add(-24 * time.Hour),
+			until:     now.Add(time.Hour),
+			wantSizes: []uint64{16, 16, 18, 20},
+		},
+		{
+			desc:      "time range is respected",
+			since:     now.Add(-2 * time.Hour),
+			until:     now,
+			wantSizes: []uint64{16, 18},
+		},
+		{
+			desc:      "unbounded time range",
+			wantSizes: []uint64{16, 16, 18, 20},
+		},
+		{
+			desc:      "old history pruned",
+			retention: 90 * time.Minute,
+			since:     now.Add(-24 * time.Hour),
+			until:     now.Add(time.Hour),
+			wantSizes: []uint64{18, 20},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			forEachStorage(t, func(t *testing.T, newStorage storageFactory) {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				s, err := newStorage(ctx, "TestCheckpointHistory")
+				if err != nil {
+					t.Fatalf("newStorage(): %v", err)
+				}
+				d, err := distributor.NewDistributor(ws, ls, s, distributor.WithHistoryRetention(tC.retention))
+				if err != nil {
+					t.Fatalf("NewDistributor(): %v", err)
+				}
+				for _, c := range []struct {
+					size uint64
+					at   time.Time
+				}{
+					{16, now.Add(-3 * time.Hour)},
+					{16, now.Add(-2 * time.Hour)},
+					{18, now.Add(-time.Hour)},
+					{20, now},
+				} {
+					if err := d.Distribute(ctx, "FooLog", "Aardvark", logFoo.checkpoint(c.size, fmt.Sprintf("%d", c.size), witAardvark.signerAt(c.at))); err != nil {
+						t.Fatalf("Distribute(): %v", err)
+					}
+				}
+				// History for other witnesses must not be affected.
+				if err := d.Distribute(ctx, "FooLog", "Badger", logFoo.checkpoint(20, "20", witBadger.signer)); err != nil {
+					t.Fatalf("Distribute(): %v", err)
+				}
+
+				cps, err := d.GetCheckpointHistory(ctx, "FooLog", "Aardvark", tC.since, tC.until)
+				if err != nil {
+					t.Fatalf("GetCheckpointHistory(): %v", err)
+				}
+				var gotSizes []uint64
+				for _, cpRaw := range cps {
+					cp, _, _, err := log.ParseCheckpoint(cpRaw, logFoo.Origin, logFoo.Verifier, witAardvark.verifier)
+					if err != nil {
+						t.Fatalf("ParseCheckpoint(): %v", err)
+					}
+					gotSizes = append(gotSizes, cp.Size)
+				}
+				if !cmp.Equal(gotSizes, tC.wantSizes) {
+					t.Errorf("got sizes %v, want %v", gotSizes, tC.wantSizes)
+				}
+			})
+		})
+	}
+}
+
+func TestCheckpointHistoryPruning(t *testing.T) {
+	ws := map[string]note.Verifier{
+		aardvarkVKey: witAardvark.verifier,
+		badgerVKey:   witBadger.verifier,
+	}
+	ls := map[string]config.LogInfo{
+		"FooLog": logFoo.LogInfo,
+	}
+	now := time.Now().Truncate(time.Second)
+	forEachStorage(t, func(t *testing.T, newStorage storageFactory) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s, err := newStorage(ctx, "TestCheckpointHistoryPruning")
+		if err != nil {
+			t.Fatalf("newStorage(): %v", err)
+		}
+		// Aardvark goes quiet after submitting some checkpoints, while history is kept
+		// forever, so its old history is never pruned when it submits again.
+		d, err := distributor.NewDistributor(ws, ls, s)
+		if err != nil {
+			t.Fatalf("NewDistributor(): %v", err)
+		}
+		for _, c := range []struct {
+			size uint64
+			at   time.Time
+		}{
+			{16, now.Add(-3 * time.Hour)},
+			{18, now.Add(-2 * time.Hour)},
+		} {
+			if err := d.Distribute(ctx, "FooLog", "Aardvark", logFoo.checkpoint(c.size, fmt.Sprintf("%d", c.size), witAardvark.signerAt(c.at))); err != nil {
+				t.Fatalf("Distribute(): %v", err)
+			}
+		}
+		if err := d.Distribute(ctx, "FooLog", "Badger", logFoo.checkpoint(18, "18", witBadger.signer)); err != nil {
+			t.Fatalf("Distribute(): %v", err)
+		}
+
+		d, err = distributor.NewDistributor(ws, ls, s, distributor.WithHistoryRetention(90*time.Minute))
+		if err != nil {
+			t.Fatalf("NewDistributor(): %v", err)
+		}
+		cps, err := d.GetCheckpointHistory(ctx, "FooLog", "Aardvark", time.Time{}, time.Time{})
+		if err != nil {
+			t.Fatalf("GetCheckpointHistory(): %v", err)
+		}
+		if len(cps) != 0 {
+			t.Errorf("got %d checkpoints from expired history, want none", len(cps))
+		}
+
+		if err := d.Compact(ctx); err != nil {
+			t.Fatalf("Compact(): %v", err)
+		}
+		for _, c := range []struct {
+			witID string
+			want  int
+		}{
+			{"Aardvark", 0},
+			{"Badger", 1},
+		} {
+			if err := s.ReadTransaction(ctx, func(ctx context.Context, tx storage.ReadTx) error {
+				hcps, err := tx.GetWitnessCheckpointHistory(ctx, "FooLog", c.witID, time.Time{}, now.Add(time.Hour))
+				if err != nil {
+					return err
+				}
+				if len(hcps) != c.want {
+					t.Errorf("got %d stored checkpoints from %s after Compact(), want %d", len(hcps), c.witID, c.want)
+				}
+				return nil
+			}); err != nil {
+				t.Fatalf("ReadTransaction(): %v", err)
+			}
+		}
+	})
+}
+
+func TestWitnessTimestampFreshness(t *testing.T) {
+	ws := map[string]note.Verifier{
+		aardvarkVKey: witAardvark.verifier,
+		badgerVKey:   witBadger.verifier,
+	}
+	ls := map[string]config.LogInfo{
+		"FooLog": logFoo.LogInfo,
+	}
+	now := time.Now().Truncate(time.Second)
+	testCases := []struct {
+		desc     string
+		witID    string
+		size     uint64
+		at       time.Time
+		wantCode codes.Code
+	}{
+		{
+			desc:  "newer timestamp same size",
+			witID: "Aardvark",
+			size:  16,
+			at:    now.Add(-time.Minute),
+		},
+		{
+			desc:  "newer timestamp larger size",
+			witID: "Aardvark",
+			size:  18,
+			at:    now,
+		},
+		{
+			desc:  "small clock skew tolerated",
+			witID: "Aardvark",
+			size:  16,
+			at:    now.Add(time.Minute),
+		},
+		{
+			desc:     "too far in the future",
+			witID:    "Aardvark",
+			size:     18,
+			at:       now.Add(time.Hour),
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			desc:     "older timestamp same size",
+			witID:    "Aardvark",
+			size:     16,
+			at:       now.Add(-2 * time.Hour),
+			wantCode: codes.AlreadyExists,
+		},
+		{
+			desc:     "older timestamp larger size",
+			witID:    "Aardvark",
+			size:     18,
+			at:       now.Add(-2 * time.Hour),
+			wantCode: codes.AlreadyExists,
+		},
+		{
+			desc:  "older timestamp from another witness",
+			witID: "Badger",
+			size:  16,
+			at:    now.Add(-2 * time.Hour),
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			forEachStorage(t, func(t *testing.T, newStorage storageFactory) {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				s, err := newStorage(ctx, "TestWitnessTimestampFreshness")
+				if err != nil {
+					t.Fatalf("newStorage(): %v", err)
+				}
+				d, err := distributor.NewDistributor(ws, ls, s, distributor.WithMaxFutureSkew(5*time.Minute))
+				if err != nil {
+					t.Fatalf("NewDistributor(): %v", err)
+				}
+				if err := d.Distribute(ctx, "FooLog", "Aardvark", logFoo.checkpoint(16, "16", witAardvark.signerAt(now.Add(-time.Hour)))); err != nil {
+					t.Fatalf("Distribute(): %v", err)
+				}
+
+				w := witAardvark
+				if tC.witID == "Badger" {
+					w = witBadger
+				}
+				err = d.Distribute(ctx, "FooLog", tC.witID, logFoo.checkpoint(tC.size, fmt.Sprintf("%d", tC.size), w.signerAt(tC.at)))
+				if got := status.Code(err); got != tC.wantCode {
+					t.Fatalf("Distribute(): got code %v (%v), want %v", got, err, tC.wantCode)
+				}
+				if tC.wantCode != codes.OK {
+					return
+				}
+				cp, err := d.GetCheckpointWitness(ctx, "FooLog", tC.witID, 0)
+				if err != nil {
+					t.Fatalf("GetCheckpointWitness(): %v", err)
+				}
+				_, _, n, err := log.ParseCheckpoint(cp, logFoo.Origin, logFoo.Verifier, w.verifier)
+				if err != nil {
+					t.Fatalf("ParseCheckpoint(): %v", err)
+				}
+				gotTime, err := f_note.CoSigV1Timestamp(n.Sigs[1])
+				if err != nil {
+					t.Fatalf("CoSigV1Timestamp(): %v", err)
+				}
+				if !gotTime.Equal(tC.at) {
+					t.Errorf("got witness timestamp %v, want %v", gotTime, tC.at)
+				}
+			})
+		})
+	}
+}
+
+func TestSameSizeWriteInterval(t *testing.T) {
+	ws := map[string]note.Verifier{
+		aardvarkVKey: witAardvark.verifier,
+	}
+	ls := map[string]config.LogInfo{
+		"FooLog": logFoo.LogInfo,
+	}
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	testCases := []struct {
+		desc      string
+		next      []byte
+		wantStore bool
+	}{
+		{
+			desc: "same size within interval",
+			next: logFoo.checkpoint(16, "16", witAardvark.signerAt(start.Add(time.Minute))),
+		},
+		{
+			desc: "same size at interval",
+			next: logFoo.checkpoint(16, "16", witAardvark.signerAt(start.Add(10*time.Minute))),
+		},
+		{
+			desc:      "same size after interval",
+			next:      logFoo.checkpoint(16, "16", witAardvark.signerAt(start.Add(11*time.Minute))),
+			wantStore: true,
+		},
+		{
+			desc:      "larger size within interval",
+			next:      logFoo.checkpoint(18, "18", witAardvark.signerAt(start.Add(time.Minute))),
+			wantStore: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			forEachStorage(t, func(t *testing.T, newStorage storageFactory) {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				s, err := newStorage(ctx, "TestSameSizeWriteInterval")
+				if err != nil {
+					t.Fatalf("newStorage(): %v", err)
+				}
+				d, err := distributor.NewDistributor(ws, ls, s, distributor.WithSameSizeWriteInterval(10*time.Minute))
+				if err != nil {
+					t.Fatalf("NewDistributor(): %v", err)
+				}
+				first := logFoo.checkpoint(16, "16", witAardvark.signerAt(start))
+				if err := d.Distribute(ctx, "FooLog", "Aardvark", first); err != nil {
+					t.Fatalf("Distribute(): %v", err)
+				}
+				if err := d.Distribute(ctx, "FooLog", "Aardvark", tC.next); err != nil {
+					t.Fatalf("Distribute(): %v", err)
+				}
+				want := first
+				if tC.wantStore {
+					want = tC.next
+				}
+				got, err := d.GetCheckpointWitness(ctx, "FooLog", "Aardvark", 0)
+				if err != nil {
+					t.Fatalf("GetCheckpointWitness(): %v", err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("GetCheckpointWitness(): got %q, want %q", got, want)
+				}
+			})
+		})
+	}
+}
+
+func TestNoteLimits(t *testing.T) {
+	ws := map[string]note.Verifier{
+		aardvarkVKey: witAardvark.verifier,
+	}
+	ls := map[string]config.LogInfo{
+		"FooLog": logFoo.LogInfo,
+	}
+	// This has 4 signature lines, only 2 of which are from the log and witness.
+	cp := logFoo.checkpoint(16, "16", witAardvark.signer, witBadger.signer, witChameleon.signer)
+	testCases := []struct {
+		desc        string
+		maxSize     int
+		maxSigLines int
+		cp          []byte
+		wantCode    codes.Code
+	}{
+		{
+			desc: "defaults",
+			cp:   cp,
+		},
+		{
+			desc:        "within limits",
+			maxSize:     len(cp),
+			maxSigLines: 4,
+			cp:          cp,
+		},
+		{
+			desc:     "too large",
+			maxSize:  len(cp) - 1,
+			cp:       cp,
+			wantCode: codes.ResourceExhausted,
+		},
+		{
+			desc:        "too many signature lines",
+			maxSigLines: 3,
+			cp:          cp,
+			wantCode:    codes.ResourceExhausted,
+		},
+		{
+			desc:     "no signatures",
+			cp:       []byte("from foo\n16\n"),
+			wantCode: codes.InvalidArgument,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			d, err := distributor.NewDistributor(ws, ls, memory.New(), distributor.WithNoteLimits(tC.maxSize, tC.maxSigLines))
+			if err != nil {
+				t.Fatalf("NewDistributor(): %v", err)
+			}
+			err = d.Distribute(ctx, "FooLog", "Aardvark", tC.cp)
+			if got := status.Code(err); got != tC.wantCode {
+				t.Errorf("Distribute(): got code %v (%v), want %v", got, err, tC.wantCode)
+			}
+		})
+	}
+}
+
+func TestInconsistencyEvidence(t *testing.T) {
+	ws := map[string]note.Verifier{
+		aardvarkVKey: witAardvark.verifier,
+		badgerVKey:   witBadger.verifier,
+	}
+	ls := map[string]config.LogInfo{
+		"FooLog": logFoo.LogInfo,
+	}
+	forEachStorage(t, func(t *testing.T, newStorage storageFactory) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s, err := newStorage(ctx, "TestInconsistencyEvidence")
+		if err != nil {
+			t.Fatalf("newStorage(): %v", err)
+		}
+		d, err := distributor.NewDistributor(ws, ls, s)
+		if err != nil {
+			t.Fatalf("NewDistributor(): %v", err)
+		}
+		incs, err := d.GetInconsistencies(ctx, "FooLog")
+		if err != nil {
+			t.Fatalf("GetInconsistencies(): %v", err)
+		}
+		if len(incs) != 0 {
+			t.Fatalf("got %d inconsistencies before any were reported", len(incs))
+		}
+
+		good := logFoo.checkpoint(16, "good", witAardvark.signer)
+		evil := logFoo.checkpoint(16, "evil", witAardvark.signer)
+		if err := d.Distribute(ctx, "FooLog", "Aardvark", good); err != nil {
+			t.Fatalf("Distribute(): %v", err)
+		}
+		// Reporting the same inconsistency repeatedly must only store it once.
+		for i := 0; i < 3; i++ {
+			if err := d.Distribute(ctx, "FooLog", "Aardvark", evil); status.Code(err) != codes.FailedPrecondition {
+				t.Fatalf("Distribute() of inconsistent checkpoint: got err %v, want code FailedPrecondition", err)
+			}
+		}
+		// The inconsistent checkpoint must not have been accepted.
+		cp, err := d.GetCheckpointWitness(ctx, "FooLog", "Aardvark", 0)
+		if err != nil {
+			t.Fatalf("GetCheckpointWitness(): %v", err)
+		}
+		if !bytes.Equal(cp, good) {
+			t.Errorf("GetCheckpointWitness(): got %q, want %q", cp, good)
+		}
+
+		incs, err = d.GetInconsistencies(ctx, "FooLog")
+		if err != nil {
+			t.Fatalf("GetInconsistencies(): %v", err)
+		}
+		if len(incs) != 1 {
+			t.Fatalf("got %d inconsistencies, want 1", len(incs))
+		}
+		if got, want := incs[0].TreeSize, uint64(16); got != want {
+			t.Errorf("got tree size %d, want %d", got, want)
+		}
+		gotCPs := []string{incs[0].Checkpoints[0], incs[0].Checkpoints[1]}
+		sort.Strings(gotCPs)
+		wantCPs := []string{string(good), string(evil)}
+		sort.Strings(wantCPs)
+		if diff := cmp.Diff(wantCPs, gotCPs); diff != "" {
+			t.Errorf("unexpected checkpoints (-want +got):\n%s", diff)
+		}
+
+		if _, err := d.GetInconsistencies(ctx, "BarLog"); err == nil {
+			t.Error("GetInconsistencies() for unknown log succeeded")
+		}
+	})
+}
+
+func TestReconfigure(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, newStorage storageFactory) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s, err := newStorage(ctx, "TestReconfigure")
+		if err != nil {
+			t.Fatalf("newStorage(): %v", err)
+		}
+		d, err := distributor.NewDistributor(
+			map[string]note.Verifier{aardvarkVKey: witAardvark.verifier},
+			map[string]config.LogInfo{"FooLog": logFoo.LogInfo},
+			s)
+		if err != nil {
+			t.Fatalf("NewDistributor(): %v", err)
+		}
+		if err := d.Distribute(ctx, "FooLog", "Aardvark", logFoo.checkpoint(16, "16", witAardvark.signer)); err != nil {
+			t.Fatalf("Distribute(): %v", err)
+		}
+		if err := d.Distribute(ctx, "BarLog", "Badger", logBar.checkpoint(16, "16", witBadger.signer)); status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Distribute() before reconfiguring: got err %v, want InvalidArgument", err)
+		}
+
+		d.Reconfigure(
+			map[string]note.Verifier{badgerVKey: witBadger.verifier},
+			map[string]config.LogInfo{"FooLog": logFoo.LogInfo, "BarLog": logBar.LogInfo})
+
+		if err := d.Distribute(ctx, "BarLog", "Badger", logBar.checkpoint(16, "16", witBadger.signer)); err != nil {
+			t.Fatalf("Distribute() of added log and witness: %v", err)
+		}
+		if err := d.Distribute(ctx, "FooLog", "Aardvark", logFoo.checkpoint(18, "18", witAardvark.signer)); status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Distribute() from removed witness: got err %v, want InvalidArgument", err)
+		}
+		logs, err := d.GetLogs(ctx)
+		if err != nil {
+			t.Fatalf("GetLogs(): %v", err)
+		}
+		if diff := cmp.Diff([]string{"BarLog", "FooLog"}, logs); diff != "" {
+			t.Errorf("unexpected logs (-want +got):\n%s", diff)
+		}
+		wits, err := d.GetWitnesses(ctx)
+		if err != nil {
+			t.Fatalf("GetWitnesses(): %v", err)
+		}
+		if diff := cmp.Diff([]string{badgerVKey}, wits); diff != "" {
+			t.Errorf("unexpected witnesses (-want +got):\n%s", diff)
+		}
+		// The removed witness must no longer count towards merged checkpoints.
+		if err := d.Distribute(ctx, "FooLog", "Badger", logFoo.checkpoint(16, "16", witBadger.signer)); err != nil {
+			t.Fatalf("Distribute(): %v", err)
+		}
+		if _, err := d.GetCheckpointN(ctx, "FooLog", 2, 0); status.Code(err) != codes.NotFound {
+			t.Errorf("GetCheckpointN(2): got err %v, want NotFound", err)
+		}
+	})
+}
+
+func TestAllowedWitnesses(t *testing.T) {
+	ws := map[string]note.Verifier{
+		aardvarkVKey: witAardvark.verifier,
+		badgerVKey:   witBadger.verifier,
+		"Chameleon":  witChameleon.verifier,
 	}
-	// exponential backoff-retry, because the application in the container might not be ready to accept connections yet
-	if err := retry(func() error {
-		var err error
-		db, err := helper.connect()
+	restricted := logFoo.LogInfo
+	restricted.AllowedWitnesses = []string{
+		witAardvark.verifier.Name(),
+		fmt.Sprintf("%08x", witBadger.verifier.KeyHash()),
+	}
+	forEachStorage(t, func(t *testing.T, newStorage storageFactory) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s, err := newStorage(ctx, "TestAllowedWitnesses")
 		if err != nil {
-			return err
+			t.Fatalf("newStorage(): %v", err)
+		}
+		d, err := distributor.NewDistributor(ws, map[string]config.LogInfo{"FooLog": logFoo.LogInfo}, s)
+		if err != nil {
+			t.Fatalf("NewDistributor(): %v", err)
+		}
+		for _, w := range []fakeWitness{witAardvark, witChameleon} {
+			if err := d.Distribute(ctx, "FooLog", w.verifier.Name(), logFoo.checkpoint(16, "16", w.signer)); err != nil {
+				t.Fatalf("Distribute(): %v", err)
+			}
 		}
-		return db.Ping()
-	}); err != nil {
-		glog.Errorf("Could not connect to database: %s", err)
-		os.Exit(1)
-	}
-
-	code := m.Run()
-
-	// You can't defer this because os.Exit doesn't care for defer
-	if err := pool.Purge(resource); err != nil {
-		glog.Errorf("Could not purge resource: %s", err)
-	}
 
-	os.Exit(code)
-}
+		d.Reconfigure(ws, map[string]config.LogInfo{"FooLog": restricted})
 
-func retry(op func() error) error {
-	bo := backoff.NewExponentialBackOff()
-	bo.MaxInterval = time.Second * 5
-	bo.MaxElapsedTime = time.Minute
-	if err := backoff.Retry(op, bo); err != nil {
-		if bo.NextBackOff() == backoff.Stop {
-			return fmt.Errorf("reached retry deadline (last error: %v)", err)
+		if err := d.Distribute(ctx, "FooLog", "Chameleon", logFoo.checkpoint(18, "18", witChameleon.signer)); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("Distribute() from disallowed witness: got err %v, want PermissionDenied", err)
+		}
+		if err := d.Distribute(ctx, "FooLog", "Badger", logFoo.checkpoint(16, "16", witBadger.signer)); err != nil {
+			t.Fatalf("Distribute() from witness allowed by key hash: %v", err)
 		}
 
-		return err
-	}
-	return nil
-}
-
-func TestGetLogs(t *testing.T) {
-	ws := map[string]note.Verifier{}
-	testCases := []struct {
-		desc string
-		logs map[string]config.LogInfo
-		want []string
-	}{
-		{
-			desc: "No logs",
-			logs: map[string]config.LogInfo{},
-			want: []string{},
-		},
-		{
-			desc: "One log",
-			logs: map[string]config.LogInfo{
-				"FooLog": logFoo.LogInfo,
-			},
-			want: []string{"FooLog"},
-		},
-		{
-			desc: "Two logs",
-			logs: map[string]config.LogInfo{
-				"FooLog": logFoo.LogInfo,
-				"BarLog": logBar.LogInfo,
-			},
-			want: []string{"BarLog", "FooLog"},
-		},
-	}
-	for _, tC := range testCases {
-		t.Run(tC.desc, func(t *testing.T) {
-			ctx, cancel := context.WithCancel(context.Background())
-			defer cancel()
-			db, err := helper.create("TestGetLogs")
-			if err != nil {
-				t.Fatalf("helper.create(): %v", err)
-			}
-			d, err := distributor.NewDistributor(ws, tC.logs, db)
-			if err != nil {
-				t.Fatalf("NewDistributor(): %v", err)
-			}
-			got, err := d.GetLogs(ctx)
-			if err != nil {
-				t.Errorf("GetLogs(): %v", err)
-			}
-			if !cmp.Equal(got, tC.want) {
-				t.Errorf("got %q, want %q", got, tC.want)
-			}
-		})
-	}
+		// The checkpoint stored for Chameleon before the restriction must not be merged.
+		cpRaw, err := d.GetCheckpointN(ctx, "FooLog", 2, 0)
+		if err != nil {
+			t.Fatalf("GetCheckpointN(): %v", err)
+		}
+		_, _, n, err := log.ParseCheckpoint(cpRaw, logFoo.Origin, logFoo.Verifier, witAardvark.verifier, witBadger.verifier, witChameleon.verifier)
+		if err != nil {
+			t.Fatalf("ParseCheckpoint(): %v", err)
+		}
+		var gotWits []string
+		for _, sig := range n.Sigs[1:] {
+			gotWits = append(gotWits, sig.Name)
+		}
+		sort.Strings(gotWits)
+		if diff := cmp.Diff([]string{"Aardvark", "Badger"}, gotWits); diff != "" {
+			t.Errorf("unexpected witness signatures (-want +got):\n%s", diff)
+		}
+	})
 }
 
-func TestDistributeLogAndWitnessMustMatchCheckpoint(t *testing.T) {
+func TestGetCheckpointForPolicy(t *testing.T) {
 	ws := map[string]note.Verifier{
 		aardvarkVKey: witAardvark.verifier,
 		badgerVKey:   witBadger.verifier,
+		"Chameleon":  witChameleon.verifier,
 	}
 	ls := map[string]config.LogInfo{
 		"FooLog": logFoo.LogInfo,
-		"BarLog": logBar.LogInfo,
+	}
+	ps := map[string]*config.Policy{
+		"ab": {
+			Name:      "ab",
+			Threshold: 2,
+			Witnesses: []note.Verifier{witAardvark.verifier, witBadger.verifier},
+		},
+		"c": {
+			Name:      "c",
+			Threshold: 1,
+			Witnesses: []note.Verifier{witChameleon.verifier},
+		},
+	}
+	type witnessAndSize struct {
+		wit  fakeWitness
+		size uint64
 	}
 	testCases := []struct {
-		desc     string
-		reqLogID string
-		reqWitID string
-		log      fakeLog
-		wit      fakeWitness
-		wantErr  bool
+		desc        string
+		order       []witnessAndSize
+		policy      string
+		wantErrCode codes.Code
+		wantSize    uint64
+		wantWits    []string
 	}{
 		{
-			desc:     "Correct log and witness: foo and aardvark",
-			reqLogID: "FooLog",
-			reqWitID: "Aardvark",
-			log:      logFoo,
-			wit:      witAardvark,
-			wantErr:  false,
-		},
-		{
-			desc:     "Correct log and witness: bar and badger",
-			reqLogID: "BarLog",
-			reqWitID: "Badger",
-			log:      logBar,
-			wit:      witBadger,
-			wantErr:  false,
+			desc: "policy satisfied by older checkpoint",
+			order: []witnessAndSize{
+				{witAardvark, 16},
+				{witBadger, 16},
+				{witChameleon, 20},
+			},
+			policy:   "ab",
+			wantSize: 16,
+			wantWits: []string{"Aardvark", "Badger"},
 		},
 		{
-			desc:     "Correct log wrong witness",
-			reqLogID: "FooLog",
-			reqWitID: "Aardvark",
-			log:      logFoo,
-			wit:      witBadger,
-			wantErr:  true,
+			desc: "freshest checkpoint satisfying other policy",
+			order: []witnessAndSize{
+				{witAardvark, 16},
+				{witBadger, 16},
+				{witChameleon, 20},
+			},
+			policy:   "c",
+			wantSize: 20,
+			wantWits: []string{"Chameleon"},
 		},
 		{
-			desc:     "Wrong log correct witness",
-			reqLogID: "BarLog",
-			reqWitID: "Aardvark",
-			log:      logFoo,
-			wit:      witAardvark,
-			wantErr:  true,
+			desc: "witnesses not in sync",
+			order: []witnessAndSize{
+				{witAardvark, 16},
+				{witBadger, 16},
+				{witAardvark, 20},
+			},
+			policy:   "ab",
+			wantSize: 16,
+			wantWits: []string{"Aardvark", "Badger"},
 		},
 		{
-			desc:     "Wrong log wrong witness",
-			reqLogID: "BarLog",
-			reqWitID: "Aardvark",
-			log:      logFoo,
-			wit:      witBadger,
-			wantErr:  true,
+			desc: "no checkpoint cosigned by both",
+			order: []witnessAndSize{
+				{witAardvark, 16},
+				{witBadger, 18},
+				{witAardvark, 20},
+			},
+			policy:      "ab",
+			wantErrCode: codes.NotFound,
 		},
 		{
-			desc:     "Unknown log known witness",
-			reqLogID: "DogNotLog",
-			reqWitID: "Badger",
-			log:      logFoo,
-			wit:      witBadger,
-			wantErr:  true,
+			desc: "all signatures included",
+			order: []witnessAndSize{
+				{witAardvark, 20},
+				{witChameleon, 20},
+				{witBadger, 20},
+			},
+			policy:   "ab",
+			wantSize: 20,
+			wantWits: []string{"Aardvark", "Badger", "Chameleon"},
 		},
 		{
-			desc:     "Correct log unknown witness",
-			reqLogID: "FooLog",
-			reqWitID: "WhatAWally",
-			log:      logFoo,
-			wit:      witBadger,
-			wantErr:  true,
+			desc:        "unknown policy",
+			policy:      "nope",
+			wantErrCode: codes.InvalidArgument,
 		},
 	}
 	for _, tC := range testCases {
 		t.Run(tC.desc, func(t *testing.T) {
-			ctx, cancel := context.WithCancel(context.Background())
-			defer cancel()
-			db, err := helper.create("TestDistributeLogAndWitnessMustMatchCheckpoint")
-			if err != nil {
-				t.Fatalf("helper.create(): %v", err)
-			}
-			d, err := distributor.NewDistributor(ws, ls, db)
-			if err != nil {
-				t.Fatalf("NewDistributor(): %v", err)
-			}
+			forEachStorage(t, func(t *testing.T, newStorage storageFactory) {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				s, err := newStorage(ctx, "TestGetCheckpointForPolicy")
+				if err != nil {
+					t.Fatalf("newStorage(): %v", err)
+				}
+				d, err := distributor.NewDistributor(ws, ls, s, distributor.WithPolicies(ps))
+				if err != nil {
+					t.Fatalf("NewDistributor(): %v", err)
+				}
+				for _, was := range tC.order {
+					if err := d.Distribute(ctx, "FooLog", was.wit.verifier.Name(), logFoo.checkpoint(was.size, fmt.Sprintf("%d", was.size), was.wit.signer)); err != nil {
+						t.Fatal(err)
+					}
+				}
 
-			logCP16 := tC.log.checkpoint(16, "16", tC.wit.signer)
-			err = d.Distribute(ctx, tC.reqLogID, tC.reqWitID, logCP16)
-			if (err != nil) != tC.wantErr {
-				t.Errorf("unexpected error output (wantErr: %t): %v", tC.wantErr, err)
-			}
+				cpRaw, err := d.GetCheckpointForPolicy(ctx, "FooLog", tC.policy)
+				if got, want := status.Code(err), tC.wantErrCode; got != want {
+					t.Fatalf("GetCheckpointForPolicy(): got err %v, want code %v", err, want)
+				}
+				if err != nil {
+					return
+				}
+				cp, _, n, err := log.ParseCheckpoint(cpRaw, logFoo.Origin, logFoo.Verifier, witAardvark.verifier, witBadger.verifier, witChameleon.verifier)
+				if err != nil {
+					t.Fatalf("ParseCheckpoint(): %v", err)
+				}
+				if cp.Size != tC.wantSize {
+					t.Errorf("expected tree size of %d but got %d", tC.wantSize, cp.Size)
+				}
+				var gotWits []string
+				for _, sig := range n.Sigs[1:] {
+					gotWits = append(gotWits, sig.Name)
+				}
+				sort.Strings(gotWits)
+				if diff := cmp.Diff(tC.wantWits, gotWits); diff != "" {
+					t.Errorf("unexpected witness signatures (-want +got):\n%s", diff)
+				}
+			})
 		})
 	}
 }
 
-func TestDistributeEvolution(t *testing.T) {
-	// The base case for this test is that a single checkpoint has already
-	// been registered for log foo, by aardvark, at tree size 16, with root hash H("16").
+func TestGetCheckpointForWitnesses(t *testing.T) {
 	ws := map[string]note.Verifier{
 		aardvarkVKey: witAardvark.verifier,
 		badgerVKey:   witBadger.verifier,
+		"Chameleon":  witChameleon.verifier,
 	}
 	ls := map[string]config.LogInfo{
 		"FooLog": logFoo.LogInfo,
-		"BarLog": logBar.LogInfo,
+	}
+	type witnessAndSize struct {
+		wit  fakeWitness
+		size uint64
+	}
+	// Aardvark and Badger agree on 16, while Badger and Chameleon have both
+	// moved on to 20, but Aardvark has not.
+	order := []witnessAndSize{
+		{witAardvark, 16},
+		{witBadger, 20},
+		{witChameleon, 20},
 	}
 	testCases := []struct {
-		desc     string
-		log      fakeLog
-		wit      fakeWitness
-		size     uint64
-		hashSeed string
-		wantErr  bool
+		desc        string
+		witIDs      []string
+		k           uint32
+		wantErrCode codes.Code
+		wantSize    uint64
 	}{
 		{
-			desc:     "aardvark a bit bigger",
-			log:      logFoo,
-			wit:      witAardvark,
-			size:     18,
-			hashSeed: "18",
-			wantErr:  false,
+			desc:     "all of a subset",
+			witIDs:   []string{"Badger", "Chameleon"},
+			wantSize: 20,
 		},
 		{
-			desc:     "aardvark smaller",
-			log:      logFoo,
-			wit:      witAardvark,
-			size:     11,
-			hashSeed: "11",
-			wantErr:  true,
+			desc:        "all witnesses never in sync",
+			witIDs:      []string{"Aardvark", "Badger", "Chameleon"},
+			wantErrCode: codes.NotFound,
 		},
 		{
-			desc:     "aardvark same",
-			log:      logFoo,
-			wit:      witAardvark,
-			size:     16,
-			hashSeed: "16",
-			wantErr:  false,
+			desc:     "k of n",
+			witIDs:   []string{"Aardvark", "Badger", "Chameleon"},
+			k:        2,
+			wantSize: 20,
 		},
 		{
-			desc:     "aardvark same size but different hash",
-			log:      logFoo,
-			wit:      witAardvark,
-			size:     16,
-			hashSeed: "not 16",
-			wantErr:  true,
+			desc:     "1 of n",
+			witIDs:   []string{"Aardvark"},
+			k:        1,
+			wantSize: 16,
 		},
 		{
-			desc:     "aardvark smaller different log",
-			log:      logBar,
-			wit:      witAardvark,
-			size:     11,
-			hashSeed: "11",
-			wantErr:  false,
+			desc:        "k too large",
+			witIDs:      []string{"Aardvark", "Badger"},
+			k:           3,
+			wantErrCode: codes.InvalidArgument,
 		},
 		{
-			desc:     "badger smaller",
-			log:      logFoo,
-			wit:      witBadger,
-			size:     11,
-			hashSeed: "11",
-			wantErr:  false,
+			desc:        "unknown witness",
+			witIDs:      []string{"Aardvark", "Dingo"},
+			wantErrCode: codes.InvalidArgument,
 		},
 		{
-			desc:     "badger same size",
-			log:      logFoo,
-			wit:      witBadger,
-			size:     16,
-			hashSeed: "16",
-			wantErr:  false,
+			desc:        "duplicate witness",
+			witIDs:      []string{"Aardvark", "Aardvark"},
+			wantErrCode: codes.InvalidArgument,
 		},
 		{
-			desc:     "badger same size but different hash",
-			log:      logFoo,
-			wit:      witBadger,
-			size:     16,
-			hashSeed: "not 16",
-			wantErr:  false, // We don't check consistency with all witnesses on write
+			desc:        "no witnesses",
+			wantErrCode: codes.InvalidArgument,
 		},
 	}
-	for _, tC := range testCases {
-		t.Run(tC.desc, func(t *testing.T) {
-			ctx, cancel := context.WithCancel(context.Background())
-			defer cancel()
-			db, err := helper.create("TestDistributeEvolution")
-			if err != nil {
-				t.Fatalf("helper.create(): %v", err)
-			}
-			d, err := distributor.NewDistributor(ws, ls, db)
-			if err != nil {
-				t.Fatalf("NewDistributor(): %v", err)
-			}
-			err = d.Distribute(ctx, "FooLog", "Aardvark", logFoo.checkpoint(16, "16", witAardvark.signer))
-			if err != nil {
-				t.Fatalf("Distribute(): %v", err)
-			}
-
-			err = d.Distribute(ctx, tC.log.Verifier.Name(), tC.wit.verifier.Name(), tC.log.checkpoint(tC.size, tC.hashSeed, tC.wit.signer))
-			if (err != nil) != tC.wantErr {
-				t.Errorf("unexpected error output (wantErr: %t): %v", tC.wantErr, err)
+	forEachStorage(t, func(t *testing.T, newStorage storageFactory) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s, err := newStorage(ctx, "TestGetCheckpointForWitnesses")
+		if err != nil {
+			t.Fatalf("newStorage(): %v", err)
+		}
+		d, err := distributor.NewDistributor(ws, ls, s)
+		if err != nil {
+			t.Fatalf("NewDistributor(): %v", err)
+		}
+		for _, was := range order {
+			if err := d.Distribute(ctx, "FooLog", was.wit.verifier.Name(), logFoo.checkpoint(was.size, fmt.Sprintf("%d", was.size), was.wit.signer)); err != nil {
+				t.Fatal(err)
 			}
-		})
-	}
+		}
+		for _, tC := range testCases {
+			t.Run(tC.desc, func(t *testing.T) {
+				cpRaw, err := d.GetCheckpointForWitnesses(ctx, "FooLog", tC.witIDs, tC.k)
+				if got, want := status.Code(err), tC.wantErrCode; got != want {
+					t.Fatalf("GetCheckpointForWitnesses(): got err %v, want code %v", err, want)
+				}
+				if err != nil {
+					return
+				}
+				cp, _, _, err := log.ParseCheckpoint(cpRaw, logFoo.Origin, logFoo.Verifier)
+				if err != nil {
+					t.Fatalf("ParseCheckpoint(): %v", err)
+				}
+				if cp.Size != tC.wantSize {
+					t.Errorf("expected tree size of %d but got %d", tC.wantSize, cp.Size)
+				}
+			})
+		}
+	})
 }
 
-func TestGetCheckpointWitness(t *testing.T) {
-	// The base case for this test is that a single checkpoint has already
-	// been registered for log foo, by aardvark, at tree size 16, with root hash H("16").
+func TestGetCheckpointMaxAge(t *testing.T) {
 	ws := map[string]note.Verifier{
-		aardvarkVKey: witAardvark.verifier,
-		badgerVKey:   witBadger.verifier,
+		aardvarkVKey:  witAardvark.verifier,
+		badgerVKey:    witBadger.verifier,
+		chameleonVKey: witChameleon.verifier,
 	}
 	ls := map[string]config.LogInfo{
 		"FooLog": logFoo.LogInfo,
-		"BarLog": logBar.LogInfo,
+	}
+	now := time.Now().Truncate(time.Second)
+	// Aardvark and Badger agree on 18, but Aardvark signed it a long time ago.
+	// Chameleon recently signed 16.
+	order := []struct {
+		wit  fakeWitness
+		size uint64
+		at   time.Time
+	}{
+		{witAardvark, 18, now.Add(-2 * time.Hour)},
+		{witBadger, 18, now.Add(-10 * time.Minute)},
+		{witChameleon, 16, now.Add(-5 * time.Minute)},
 	}
 	testCases := []struct {
-		desc    string
-		log     fakeLog
-		wit     fakeWitness
-		wantErr bool
+		desc        string
+		n           uint32
+		maxAge      time.Duration
+		wantErrCode codes.Code
+		wantSize    uint64
+		wantWits    []string
 	}{
 		{
-			desc:    "read back same cp",
-			log:     logFoo,
-			wit:     witAardvark,
-			wantErr: false,
+			desc:     "no max age",
+			n:        2,
+			wantSize: 18,
+			wantWits: []string{"Aardvark", "Badger"},
+		},
+		{
+			desc:     "old signature dropped",
+			n:        1,
+			maxAge:   time.Hour,
+			wantSize: 18,
+			wantWits: []string{"Badger"},
+		},
+		{
+			desc:     "old signature within max age",
+			n:        2,
+			maxAge:   3 * time.Hour,
+			wantSize: 18,
+			wantWits: []string{"Aardvark", "Badger"},
 		},
 		{
-			desc:    "same log, different witness",
-			log:     logFoo,
-			wit:     witBadger,
-			wantErr: true,
+			desc:        "not enough fresh signatures",
+			n:           2,
+			maxAge:      time.Hour,
+			wantErrCode: codes.NotFound,
 		},
 		{
-			desc:    "different log, same witness",
-			log:     logBar,
-			wit:     witAardvark,
-			wantErr: true,
+			desc:     "smaller checkpoint is fresher",
+			n:        1,
+			maxAge:   7 * time.Minute,
+			wantSize: 16,
+			wantWits: []string{"Chameleon"},
 		},
 		{
-			desc:    "different log, different witness",
-			log:     logBar,
-			wit:     witBadger,
-			wantErr: true,
+			desc:        "negative max age",
+			n:           1,
+			maxAge:      -time.Hour,
+			wantErrCode: codes.InvalidArgument,
 		},
 	}
-	for _, tC := range testCases {
-		t.Run(tC.desc, func(t *testing.T) {
-			ctx, cancel := context.WithCancel(context.Background())
-			defer cancel()
-			db, err := helper.create("TestGetCheckpointWitness")
-			if err != nil {
-				t.Fatalf("helper.create(): %v", err)
-			}
-			d, err := distributor.NewDistributor(ws, ls, db)
-			if err != nil {
-				t.Fatalf("NewDistributor(): %v", err)
-			}
-			writeCP := logFoo.checkpoint(16, "16", witAardvark.signer)
-			err = d.Distribute(ctx, "FooLog", "Aardvark", writeCP)
-			if err != nil {
-				t.Fatalf("Distribute(): %v", err)
-			}
-
-			readCP, err := d.GetCheckpointWitness(ctx, tC.log.Verifier.Name(), tC.wit.verifier.Name())
-			if (err != nil) != tC.wantErr {
-				t.Errorf("unexpected error output (wantErr: %t): %v", tC.wantErr, err)
+	forEachStorage(t, func(t *testing.T, newStorage storageFactory) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s, err := newStorage(ctx, "TestGetCheckpointMaxAge")
+		if err != nil {
+			t.Fatalf("newStorage(): %v", err)
+		}
+		d, err := distributor.NewDistributor(ws, ls, s)
+		if err != nil {
+			t.Fatalf("NewDistributor(): %v", err)
+		}
+		for _, o := range order {
+			if err := d.Distribute(ctx, "FooLog", o.wit.verifier.Name(), logFoo.checkpoint(o.size, fmt.Sprintf("%d", o.size), o.wit.signerAt(o.at))); err != nil {
+				t.Fatal(err)
 			}
-			if !tC.wantErr {
-				if !cmp.Equal(readCP, writeCP) {
-					t.Errorf("Written checkpoint != read checkpoint. Read\n%v\n\nWrote:\n%v", readCP, writeCP)
+		}
+		for _, tC := range testCases {
+			t.Run(tC.desc, func(t *testing.T) {
+				cpRaw, err := d.GetCheckpointN(ctx, "FooLog", tC.n, tC.maxAge)
+				if got, want := status.Code(err), tC.wantErrCode; got != want {
+					t.Fatalf("GetCheckpointN(): got err %v, want code %v", err, want)
 				}
-			}
-		})
-	}
+				if err != nil {
+					return
+				}
+				cp, _, n, err := log.ParseCheckpoint(cpRaw, logFoo.Origin, logFoo.Verifier, witAardvark.verifier, witBadger.verifier, witChameleon.verifier)
+				if err != nil {
+					t.Fatalf("ParseCheckpoint(): %v", err)
+				}
+				if cp.Size != tC.wantSize {
+					t.Errorf("expected tree size of %d but got %d", tC.wantSize, cp.Size)
+				}
+				var gotWits []string
+				for _, sig := range n.Sigs[1:] {
+					gotWits = append(gotWits, sig.Name)
+				}
+				sort.Strings(gotWits)
+				if diff := cmp.Diff(tC.wantWits, gotWits); diff != "" {
+					t.Errorf("unexpected witness signatures (-want +got):\n%s", diff)
+				}
+			})
+		}
+
+		if _, err := d.GetCheckpointWitness(ctx, "FooLog", "Aardvark", 3*time.Hour); err != nil {
+			t.Errorf("GetCheckpointWitness(): %v", err)
+		}
+		if _, err := d.GetCheckpointWitness(ctx, "FooLog", "Aardvark", time.Hour); status.Code(err) != codes.NotFound {
+			t.Errorf("GetCheckpointWitness(): got err %v, want NotFound", err)
+		}
+	})
 }
 
-func TestFiltersUnknownSignatures(t *testing.T) {
+func TestGetCheckpointFromHistory(t *testing.T) {
 	ws := map[string]note.Verifier{
 		aardvarkVKey: witAardvark.verifier,
+		badgerVKey:   witBadger.verifier,
 	}
 	ls := map[string]config.LogInfo{
 		"FooLog": logFoo.LogInfo,
 	}
-
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	db, err := helper.create("TestFiltersUnknownSignatures")
-	if err != nil {
-		t.Fatalf("helper.create(): %v", err)
-	}
-	d, err := distributor.NewDistributor(ws, ls, db)
-	if err != nil {
-		t.Fatalf("NewDistributor(): %v", err)
-	}
-	writeCP := logFoo.checkpoint(16, "16", witAardvark.signer, witChameleon.signer)
-
-	// Assert there we're starting with a surplus of signatures
-	wN, err := note.Open(writeCP, note.VerifierList([]note.Verifier{logFoo.Verifier, witAardvark.verifier, witChameleon.verifier}...))
-	if err != nil {
-		t.Fatalf("Open(writeCP): %v", err)
-	}
-	if got, want := len(wN.Sigs), 3; got != want {
-		t.Errorf("Sanity failure, want 1 log + 2 witness sigs on submitted checkpoint, got %d", got)
-	}
-
-	// Send checkpoint with "unknown" witness signature to distro
-	err = d.Distribute(ctx, "FooLog", "Aardvark", writeCP)
-	if err != nil {
-		t.Fatalf("Distribute(): %v", err)
-	}
-
-	// Assert that we get back a checkpoint with only signatures from the log and exptected witness
-	readCP, err := d.GetCheckpointWitness(ctx, logFoo.Verifier.Name(), witAardvark.verifier.Name())
-	if err != nil {
-		t.Errorf("GetCheckpointWitness: %v", err)
-	}
-	rN, err := note.Open(readCP, note.VerifierList([]note.Verifier{logFoo.Verifier, witAardvark.verifier, witChameleon.verifier}...))
-	if err != nil {
-		t.Fatalf("Open(readCP): %v", err)
-	}
-	if gotSig, wantSig, gotUnverified, wantUnverified := len(rN.Sigs), 2, len(rN.UnverifiedSigs), 0; gotSig != wantSig || gotUnverified != wantUnverified {
-		t.Errorf("got %d sigs want %d, got %d unverified sigs want %d:\n%v", gotSig, wantSig, gotUnverified, wantUnverified, string(readCP))
-	}
+	now := time.Now().Truncate(time.Second)
+	forEachStorage(t, func(t *testing.T, newStorage storageFactory) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s, err := newStorage(ctx, "TestGetCheckpointFromHistory")
+		if err != nil {
+			t.Fatalf("newStorage(): %v", err)
+		}
+		d, err := distributor.NewDistributor(ws, ls, s)
+		if err != nil {
+			t.Fatalf("NewDistributor(): %v", err)
+		}
+		// Both witnesses cosigned 16, but only Aardvark has moved on to 20, so the
+		// latest checkpoints of the witnesses are for different tree sizes.
+		for _, o := range []struct {
+			wit  fakeWitness
+			size uint64
+			at   time.Time
+		}{
+			{witAardvark, 16, now.Add(-3 * time.Minute)},
+			{witBadger, 16, now.Add(-2 * time.Minute)},
+			{witAardvark, 20, now.Add(-time.Minute)},
+		} {
+			if err := d.Distribute(ctx, "FooLog", o.wit.verifier.Name(), logFoo.checkpoint(o.size, fmt.Sprintf("%d", o.size), o.wit.signerAt(o.at))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, c := range []struct {
+			desc string
+			get  func() ([]byte, error)
+		}{
+			{"GetCheckpointForWitnesses", func() ([]byte, error) {
+				return d.GetCheckpointForWitnesses(ctx, "FooLog", []string{"Aardvark", "Badger"}, 0)
+			}},
+			{"GetCheckpointN", func() ([]byte, error) {
+				return d.GetCheckpointN(ctx, "FooLog", 2, time.Hour)
+			}},
+		} {
+			t.Run(c.desc, func(t *testing.T) {
+				cpRaw, err := c.get()
+				if err != nil {
+					t.Fatalf("%s(): %v", c.desc, err)
+				}
+				cp, _, n, err := log.ParseCheckpoint(cpRaw, logFoo.Origin, logFoo.Verifier, witAardvark.verifier, witBadger.verifier)
+				if err != nil {
+					t.Fatalf("ParseCheckpoint(): %v", err)
+				}
+				if cp.Size != 16 {
+					t.Errorf("expected tree size of 16 but got %d", cp.Size)
+				}
+				if len(n.Sigs) != 3 {
+					t.Errorf("got %d signatures, want the log's and both witnesses'", len(n.Sigs))
+				}
+			})
+		}
+	})
 }
 
-func TestDisappearingWitness(t *testing.T) {
+func TestCompact(t *testing.T) {
 	ws := map[string]note.Verifier{
-		aardvarkVKey: witAardvark.verifier,
-		badgerVKey:   witBadger.verifier,
+		aardvarkVKey:  witAardvark.verifier,
+		badgerVKey:    witBadger.verifier,
+		chameleonVKey: witChameleon.verifier,
 	}
 	ls := map[string]config.LogInfo{
 		"FooLog": logFoo.LogInfo,
 	}
-
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	db, err := helper.create("TestDisappearingWitness")
-	if err != nil {
-		t.Fatalf("helper.create(): %v", err)
-	}
-
-	// Put a checkpoint in sigs from a known witness.
-	{
-		d, err := distributor.NewDistributor(ws, ls, db)
+	now := time.Now().Truncate(time.Second)
+	forEachStorage(t, func(t *testing.T, newStorage storageFactory) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s, err := newStorage(ctx, "TestCompact")
+		if err != nil {
+			t.Fatalf("newStorage(): %v", err)
+		}
+		// All of the signatures are merged by a distributor without a window.
+		d, err := distributor.NewDistributor(ws, ls, s)
 		if err != nil {
 			t.Fatalf("NewDistributor(): %v", err)
 		}
+		for _, o := range []struct {
+			wit  fakeWitness
+			size uint64
+			at   time.Time
+		}{
+			{witAardvark, 16, now.Add(-3 * time.Hour)},
+			{witBadger, 16, now.Add(-10 * time.Minute)},
+			{witChameleon, 16, now.Add(-5 * time.Minute)},
+			{witAardvark, 18, now.Add(-2 * time.Hour)},
+		} {
+			if err := d.Distribute(ctx, "FooLog", o.wit.verifier.Name(), logFoo.checkpoint(o.size, fmt.Sprintf("%d", o.size), o.wit.signerAt(o.at))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := d.GetCheckpointN(ctx, "FooLog", 3, 0); err != nil {
+			t.Fatalf("GetCheckpointN(3): %v", err)
+		}
 
-		writeCP := logFoo.checkpoint(16, "16", witAardvark.signer)
-		err = d.Distribute(ctx, "FooLog", "Aardvark", writeCP)
+		d, err = distributor.NewDistributor(ws, ls, s, distributor.WithMergedSignatureWindow(time.Hour))
 		if err != nil {
-			t.Fatalf("Distribute(): %v", err)
+			t.Fatalf("NewDistributor(): %v", err)
 		}
-	}
+		if err := d.Compact(ctx); err != nil {
+			t.Fatalf("Compact(): %v", err)
+		}
+		// Aardvark's signatures are too old, so only Badger and Chameleon's remain.
+		if _, err := d.GetCheckpointN(ctx, "FooLog", 3, 0); status.Code(err) != codes.NotFound {
+			t.Errorf("GetCheckpointN(3): got err %v, want NotFound", err)
+		}
+		for _, n := range []uint32{1, 2} {
+			cpRaw, err := d.GetCheckpointN(ctx, "FooLog", n, 0)
+			if err != nil {
+				t.Fatalf("GetCheckpointN(%d): %v", n, err)
+			}
+			cp, _, cpN, err := log.ParseCheckpoint(cpRaw, logFoo.Origin, logFoo.Verifier, witAardvark.verifier, witBadger.verifier, witChameleon.verifier)
+			if err != nil {
+				t.Fatalf("ParseCheckpoint(): %v", err)
+			}
+			if got, want := cp.Size, uint64(16); got != want {
+				t.Errorf("GetCheckpointN(%d): got size %d, want %d", n, got, want)
+			}
+			var gotWits []string
+			for _, sig := range cpN.Sigs[1:] {
+				gotWits = append(gotWits, sig.Name)
+			}
+			sort.Strings(gotWits)
+			if diff := cmp.Diff([]string{"Badger", "Chameleon"}, gotWits); diff != "" {
+				t.Errorf("GetCheckpointN(%d): unexpected witness signatures (-want +got):\n%s", n, diff)
+			}
+		}
+	})
+}
 
-	// Now remove one of the witnesses; it was a bad aardvark.
-	ws = map[string]note.Verifier{
+func TestCompactOnReconfigure(t *testing.T) {
+	ws := map[string]note.Verifier{
+		aardvarkVKey:  witAardvark.verifier,
 		badgerVKey:    witBadger.verifier,
 		chameleonVKey: witChameleon.verifier,
 	}
-
-	// Now recreate the distributor instance to represent re-deploying after the config update, and
-	// try to update the checkpoint with a new signature from another known witness.
-	{
-		d, err := distributor.NewDistributor(ws, ls, db)
+	ls := map[string]config.LogInfo{
+		"FooLog": logFoo.LogInfo,
+	}
+	forEachStorage(t, func(t *testing.T, newStorage storageFactory) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s, err := newStorage(ctx, "TestCompactOnReconfigure")
+		if err != nil {
+			t.Fatalf("newStorage(): %v", err)
+		}
+		d, err := distributor.NewDistributor(ws, ls, s)
 		if err != nil {
 			t.Fatalf("NewDistributor(): %v", err)
 		}
+		for _, w := range []fakeWitness{witAardvark, witBadger, witChameleon} {
+			if err := d.Distribute(ctx, "FooLog", w.verifier.Name(), logFoo.checkpoint(16, "16", w.signer)); err != nil {
+				t.Fatal(err)
+			}
+		}
 
-		writeCP := logFoo.checkpoint(16, "16", witBadger.signer)
-		err = d.Distribute(ctx, "FooLog", "Badger", writeCP)
+		done := make(chan error, 1)
+		go func() {
+			done <- d.RunCompaction(ctx, 0)
+		}()
+		d.Reconfigure(map[string]note.Verifier{
+			aardvarkVKey: witAardvark.verifier,
+			badgerVKey:   witBadger.verifier,
+		}, ls)
+
+		// The merged checkpoint with Chameleon's signature is removed in the background.
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			_, err := d.GetCheckpointN(ctx, "FooLog", 3, 0)
+			if status.Code(err) == codes.NotFound {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("GetCheckpointN(3): got err %v, want NotFound", err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		cpRaw, err := d.GetCheckpointN(ctx, "FooLog", 2, 0)
 		if err != nil {
-			t.Fatalf("Distribute(): %v", err)
+			t.Fatalf("GetCheckpointN(2): %v", err)
 		}
-	}
+		if _, _, _, err := log.ParseCheckpoint(cpRaw, logFoo.Origin, logFoo.Verifier, witAardvark.verifier, witBadger.verifier); err != nil {
+			t.Errorf("ParseCheckpoint(): %v", err)
+		}
+		if bytes.Contains(cpRaw, []byte("Chameleon")) {
+			t.Errorf("merged checkpoint still has Chameleon's signature:\n%s", cpRaw)
+		}
+
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("RunCompaction(): %v", err)
+		}
+	})
 }
 
-func TestGetCheckpointN(t *testing.T) {
-	// The base case for this test is that 2 checkpoints have already been written:
-	//  - aardvark, at tree size 16
-	//  - chameleon, at tree size 14
+// fakeProofSource serves consistency proofs from a single tree, whatever the log.
+type fakeProofSource struct {
+	tree *testonly.Tree
+}
+
+func (f fakeProofSource) ConsistencyProof(ctx context.Context, logID string, from, to uint64) ([][]byte, error) {
+	return f.tree.ConsistencyProof(from, to)
+}
+
+func TestConsistencyProofs(t *testing.T) {
 	ws := map[string]note.Verifier{
 		aardvarkVKey: witAardvark.verifier,
-		badgerVKey:   witBadger.verifier,
-		"Chameleon":  witChameleon.verifier,
 	}
 	ls := map[string]config.LogInfo{
 		"FooLog": logFoo.LogInfo,
-		"BarLog": logBar.LogInfo,
 	}
+	// fork has the same first 10 leaves as honest, but differs after that.
+	// other shares no leaves with honest.
+	honest, fork, other := testonly.New(rfc6962.DefaultHasher), testonly.New(rfc6962.DefaultHasher), testonly.New(rfc6962.DefaultHasher)
+	for i := 0; i < 20; i++ {
+		honest.AppendData([]byte(fmt.Sprintf("leaf %d", i)))
+		other.AppendData([]byte(fmt.Sprintf("other %d", i)))
+		if i < 10 {
+			fork.AppendData([]byte(fmt.Sprintf("leaf %d", i)))
+		} else {
+			fork.AppendData([]byte(fmt.Sprintf("evil %d", i)))
+		}
+	}
+	mustProof := func(tree *testonly.Tree, from, to uint64) [][]byte {
+		p, err := tree.ConsistencyProof(from, to)
+		if err != nil {
+			t.Fatalf("ConsistencyProof(): %v", err)
+		}
+		return p
+	}
+
 	testCases := []struct {
-		desc        string
-		distWit     fakeWitness
-		distLog     fakeLog
-		distSize    uint64
-		reqLog      string
-		reqN        uint32
-		wantErr     bool
-		wantErrCode codes.Code
-		wantSize    uint64
-		wantWits    []note.Verifier
+		desc             string
+		source           distributor.ProofSource
+		nextHash         []byte
+		proof            *api.ConsistencyProof
+		wantErrCode      codes.Code
+		wantInconsistent bool
 	}{
 		{
-			desc:        "unknown log is error",
-			distWit:     witBadger,
-			distLog:     logFoo,
-			distSize:    10,
-			reqLog:      "ThisIsNotTheLogYouAreLookingFor",
-			reqN:        1,
-			wantErr:     true,
-			wantErrCode: codes.InvalidArgument,
+			desc:     "no proof",
+			nextHash: fork.HashAt(20),
 		},
 		{
-			desc:     "smaller checkpoint doesn't win",
-			distWit:  witBadger,
-			distLog:  logFoo,
-			distSize: 10,
-			reqLog:   "FooLog",
-			reqN:     1,
-			wantErr:  false,
-			wantSize: 16,
-			wantWits: []note.Verifier{witAardvark.verifier},
+			desc:     "valid proof",
+			nextHash: honest.HashAt(20),
+			proof:    &api.ConsistencyProof{From: 10, Hashes: mustProof(honest, 10, 20)},
 		},
 		{
-			desc:     "larger checkpoint wins",
-			distWit:  witBadger,
-			distLog:  logFoo,
-			distSize: 20,
-			reqLog:   "FooLog",
-			reqN:     1,
-			wantErr:  false,
-			wantSize: 20,
-			wantWits: []note.Verifier{witBadger.verifier},
+			desc:        "proof from wrong size",
+			nextHash:    honest.HashAt(20),
+			proof:       &api.ConsistencyProof{From: 8, Hashes: mustProof(honest, 8, 20)},
+			wantErrCode: codes.FailedPrecondition,
 		},
 		{
-			desc:     "same size checkpoint merges",
-			distWit:  witBadger,
-			distLog:  logFoo,
-			distSize: 16,
-			reqLog:   "FooLog",
-			reqN:     2,
-			wantErr:  false,
-			wantSize: 16,
-			wantWits: []note.Verifier{witBadger.verifier, witAardvark.verifier},
+			desc:        "malformed proof",
+			nextHash:    honest.HashAt(20),
+			proof:       &api.ConsistencyProof{From: 10},
+			wantErrCode: codes.FailedPrecondition,
 		},
 		{
-			desc:     "merge with smaller checkpoint",
-			distWit:  witBadger,
-			distLog:  logFoo,
-			distSize: 14,
-			reqLog:   "FooLog",
-			reqN:     2,
-			wantErr:  false,
-			wantSize: 14,
-			wantWits: []note.Verifier{witBadger.verifier, witChameleon.verifier},
-		},
-		{
-			desc:        "error returned if not enough sigs",
-			distWit:     witBadger,
-			distLog:     logFoo,
-			distSize:    16,
-			reqLog:      "FooLog",
-			reqN:        3,
-			wantErr:     true,
-			wantErrCode: codes.NotFound,
+			desc:        "proof does not match old checkpoint",
+			nextHash:    honest.HashAt(20),
+			proof:       &api.ConsistencyProof{From: 10, Hashes: mustProof(honest, 9, 20)},
+			wantErrCode: codes.FailedPrecondition,
 		},
 		{
-			desc:        "zero invalid",
-			distWit:     witBadger,
-			distLog:     logFoo,
-			distSize:    16,
-			reqLog:      "FooLog",
-			reqN:        0,
-			wantErr:     true,
-			wantErrCode: codes.InvalidArgument,
+			// A proof from the submitter is never evidence of a fork, as it could have been made up.
+			desc:        "proof does not match new checkpoint",
+			nextHash:    fork.HashAt(20),
+			proof:       &api.ConsistencyProof{From: 10, Hashes: mustProof(honest, 10, 20)},
+			wantErrCode: codes.FailedPrecondition,
 		},
 		{
-			desc:        "huge number invalid",
-			distWit:     witBadger,
-			distLog:     logFoo,
-			distSize:    16,
-			reqLog:      "FooLog",
-			reqN:        999,
-			wantErr:     true,
-			wantErrCode: codes.InvalidArgument,
+			desc:     "valid proof from source",
+			source:   fakeProofSource{tree: honest},
+			nextHash: honest.HashAt(20),
+		},
+		{
+			desc:             "source shows fork",
+			source:           fakeProofSource{tree: honest},
+			nextHash:         fork.HashAt(20),
+			wantErrCode:      codes.FailedPrecondition,
+			wantInconsistent: true,
+		},
+		{
+			desc:        "source proof does not match old checkpoint",
+			source:      fakeProofSource{tree: other},
+			nextHash:    honest.HashAt(20),
+			wantErrCode: codes.Unavailable,
 		},
 	}
 	for _, tC := range testCases {
 		t.Run(tC.desc, func(t *testing.T) {
-			ctx, cancel := context.WithCancel(context.Background())
-			defer cancel()
-			db, err := helper.create("TestGetCheckpointN")
-			if err != nil {
-				t.Fatalf("helper.create(): %v", err)
-			}
-			d, err := distributor.NewDistributor(ws, ls, db)
-			if err != nil {
-				t.Fatalf("NewDistributor(): %v", err)
-			}
-			if err := d.Distribute(ctx, "FooLog", "Aardvark", logFoo.checkpoint(16, "16", witAardvark.signer)); err != nil {
-				t.Fatal(err)
-			}
-			if err := d.Distribute(ctx, "FooLog", "Chameleon", logFoo.checkpoint(14, "14", witChameleon.signer)); err != nil {
-				t.Fatal(err)
-			}
-
-			if err := d.Distribute(ctx, tC.distLog.Verifier.Name(), tC.distWit.verifier.Name(), tC.distLog.checkpoint(tC.distSize, fmt.Sprintf("%d", tC.distSize), tC.distWit.signer)); err != nil {
-				t.Fatal(err)
-			}
+			forEachStorage(t, func(t *testing.T, newStorage storageFactory) {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				s, err := newStorage(ctx, "TestConsistencyProofs")
+				if err != nil {
+					t.Fatalf("newStorage(): %v", err)
+				}
+				var opts []distributor.Option
+				if tC.source != nil {
+					opts = append(opts, distributor.WithProofSource(tC.source))
+				}
+				d, err := distributor.NewDistributor(ws, ls, s, opts...)
+				if err != nil {
+					t.Fatalf("NewDistributor(): %v", err)
+				}
+				old := logFoo.checkpointWithHash(10, honest.HashAt(10), witAardvark.signer)
+				if err := d.Distribute(ctx, "FooLog", "Aardvark", old); err != nil {
+					t.Fatalf("Distribute(): %v", err)
+				}
 
-			cpRaw, err := d.GetCheckpointN(ctx, tC.reqLog, tC.reqN)
-			if (err != nil) != tC.wantErr {
-				t.Fatalf("unexpected error output (wantErr: %t): %v", tC.wantErr, err)
-			}
-			if !tC.wantErr {
-				cp, _, n, err := log.ParseCheckpoint(cpRaw, tC.distLog.Origin, tC.distLog.Verifier, tC.wantWits...)
+				// Sign the new checkpoint after the old one, so it is never older.
+				next := logFoo.checkpointWithHash(20, tC.nextHash, witAardvark.signer)
+				err = d.DistributeWithProof(ctx, "FooLog", "Aardvark", next, tC.proof)
+				if got := status.Code(err); got != tC.wantErrCode {
+					t.Fatalf("DistributeWithProof(): got err %v, want code %v", err, tC.wantErrCode)
+				}
+				incs, err := d.GetInconsistencies(ctx, "FooLog")
 				if err != nil {
-					t.Error(err)
+					t.Fatalf("GetInconsistencies(): %v", err)
 				}
-				if got, want := len(n.Sigs), 1+len(tC.wantWits); got != want {
-					t.Errorf("expected %d sigs, got %d", want, got)
+				if !tC.wantInconsistent {
+					if len(incs) != 0 {
+						t.Errorf("got %d inconsistencies, want none", len(incs))
+					}
+					return
 				}
-				if cp.Size != tC.wantSize {
-					t.Errorf("expected tree size of %d but got %d", tC.wantSize, cp.Size)
+				if len(incs) != 1 {
+					t.Fatalf("got %d inconsistencies, want 1", len(incs))
 				}
-			} else {
-				if got, want := status.Code(err), tC.wantErrCode; got != want {
-					t.Errorf("error code got != want: %v != %v", got, want)
+				want := api.Inconsistency{
+					TreeSize:    10,
+					Checkpoints: [2]string{string(old), string(next)},
+					Proof:       mustProof(honest, 10, 20),
 				}
-			}
+				if diff := cmp.Diff(want, incs[0], cmpopts.IgnoreFields(api.Inconsistency{}, "Discovered")); diff != "" {
+					t.Errorf("unexpected inconsistency (-want +got):\n%s", diff)
+				}
+			})
 		})
 	}
 }
 
-func TestGetCheckpointNHistoric(t *testing.T) {
+// blockingProofSource blocks until release is closed, and then fails.
+type blockingProofSource struct {
+	release chan struct{}
+}
+
+func (b blockingProofSource) ConsistencyProof(ctx context.Context, logID string, from, to uint64) ([][]byte, error) {
+	<-b.release
+	return nil, errors.New("unavailable")
+}
+
+// failingProofSource fails to provide any consistency proofs.
+type failingProofSource struct{}
+
+func (failingProofSource) ConsistencyProof(ctx context.Context, logID string, from, to uint64) ([][]byte, error) {
+	return nil, errors.New("unavailable")
+}
+
+func TestForkDetection(t *testing.T) {
 	ws := map[string]note.Verifier{
-		aardvarkVKey: witAardvark.verifier,
-		badgerVKey:   witBadger.verifier,
-		"Chameleon":  witChameleon.verifier,
+		aardvarkVKey:  witAardvark.verifier,
+		badgerVKey:    witBadger.verifier,
+		chameleonVKey: witChameleon.verifier,
 	}
 	ls := map[string]config.LogInfo{
 		"FooLog": logFoo.LogInfo,
 	}
-	type witnessAndSize struct {
-		wit  fakeWitness
-		size uint64
+	// fork has the same first 10 leaves as honest, but differs after that.
+	honest, fork := testonly.New(rfc6962.DefaultHasher), testonly.New(rfc6962.DefaultHasher)
+	for i := 0; i < 20; i++ {
+		honest.AppendData([]byte(fmt.Sprintf("leaf %d", i)))
+		if i < 10 {
+			fork.AppendData([]byte(fmt.Sprintf("leaf %d", i)))
+		} else {
+			fork.AppendData([]byte(fmt.Sprintf("evil %d", i)))
+		}
+	}
+	mustProof := func(tree *testonly.Tree, from, to uint64) [][]byte {
+		p, err := tree.ConsistencyProof(from, to)
+		if err != nil {
+			t.Fatalf("ConsistencyProof(): %v", err)
+		}
+		return p
 	}
+	honest10 := logFoo.checkpointWithHash(10, honest.HashAt(10), witBadger.signer)
+	honest15 := logFoo.checkpointWithHash(15, honest.HashAt(15), witChameleon.signer)
+	fork15 := logFoo.checkpointWithHash(15, fork.HashAt(15), witChameleon.signer)
+	fork20 := logFoo.checkpointWithHash(20, fork.HashAt(20), witAardvark.signer)
+
 	testCases := []struct {
-		desc        string
-		order       []witnessAndSize
-		reqN        uint32
-		wantErr     bool
-		wantErrCode codes.Code
-		wantSize    uint64
-		wantWits    []note.Verifier
+		desc   string
+		source distributor.ProofSource
+		// existing are the checkpoints stored before next is submitted by Aardvark.
+		existing map[string][]byte
+		next     []byte
+		want     []api.Inconsistency
 	}{
 		{
-			desc: "N=1 gets latest version",
-			order: []witnessAndSize{
-				{
-					witChameleon,
-					10,
-				},
-				{
-					witBadger,
-					10,
-				},
-				{
-					witChameleon,
-					22,
-				},
-			},
-			reqN:     1,
-			wantErr:  false,
-			wantSize: 22,
+			desc:     "detection disabled",
+			existing: map[string][]byte{"Badger": honest10},
+			next:     fork20,
 		},
 		{
-			desc: "N=2 can get historic version where both were in sync together",
-			order: []witnessAndSize{
-				{
-					witChameleon,
-					10,
-				},
-				{
-					witBadger,
-					10,
-				},
-				{
-					witChameleon,
-					22,
-				},
-			},
-			reqN:     2,
-			wantErr:  false,
-			wantSize: 10,
+			desc:     "consistent",
+			source:   fakeProofSource{tree: honest},
+			existing: map[string][]byte{"Badger": honest10, "Chameleon": honest15},
+			next:     logFoo.checkpointWithHash(20, honest.HashAt(20), witAardvark.signer),
 		},
 		{
-			desc: "TODO: N=2 can get historic version where both have been seen but not at same time",
-			order: []witnessAndSize{
-				{
-					witChameleon,
-					10,
-				},
-				{
-					witChameleon,
-					22,
-				},
-				{
-					witBadger,
-					10,
-				},
-			},
-			reqN:        2,
-			wantErr:     true,
-			wantErrCode: codes.NotFound,
-			// TODO(#103): this case should work with the following assertions
-			// wantErr: false,
-			// wantSize: 10,
+			desc:     "fork of smaller checkpoint",
+			source:   fakeProofSource{tree: honest},
+			existing: map[string][]byte{"Badger": honest10},
+			next:     fork20,
+			want: []api.Inconsistency{{
+				TreeSize:    10,
+				Checkpoints: [2]string{string(honest10), string(fork20)},
+				Proof:       mustProof(honest, 10, 20),
+			}},
+		},
+		{
+			desc:     "fork of larger checkpoint",
+			source:   fakeProofSource{tree: honest},
+			existing: map[string][]byte{"Chameleon": fork15},
+			next:     logFoo.checkpointWithHash(10, honest.HashAt(10), witAardvark.signer),
+			want: []api.Inconsistency{{
+				TreeSize:    10,
+				Checkpoints: [2]string{string(logFoo.checkpointWithHash(10, honest.HashAt(10), witAardvark.signer)), string(fork15)},
+				Proof:       mustProof(honest, 10, 15),
+			}},
+		},
+		{
+			desc:     "fork at same size",
+			source:   fakeProofSource{tree: honest},
+			existing: map[string][]byte{"Chameleon": honest15},
+			next:     logFoo.checkpointWithHash(15, fork.HashAt(15), witAardvark.signer),
+			want: []api.Inconsistency{{
+				TreeSize: 15,
+				// Checkpoints for the same size are ordered by their hashes.
+				Checkpoints: [2]string{string(honest15), string(logFoo.checkpointWithHash(15, fork.HashAt(15), witAardvark.signer))},
+			}},
+		},
+		{
+			desc:     "proof source fails",
+			source:   failingProofSource{},
+			existing: map[string][]byte{"Badger": honest10},
+			next:     fork20,
 		},
 	}
 	for _, tC := range testCases {
 		t.Run(tC.desc, func(t *testing.T) {
-			ctx, cancel := context.WithCancel(context.Background())
-			defer cancel()
-			db, err := helper.create("TestGetCheckpointN")
-			if err != nil {
-				t.Fatalf("helper.create(): %v", err)
-			}
-			d, err := distributor.NewDistributor(ws, ls, db)
-			if err != nil {
-				t.Fatalf("NewDistributor(): %v", err)
-			}
-			for _, was := range tC.order {
-				if err := d.Distribute(ctx, "FooLog", was.wit.verifier.Name(), logFoo.checkpoint(was.size, fmt.Sprintf("%d", was.size), was.wit.signer)); err != nil {
-					t.Fatal(err)
+			forEachStorage(t, func(t *testing.T, newStorage storageFactory) {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				s, err := newStorage(ctx, "TestForkDetection")
+				if err != nil {
+					t.Fatalf("newStorage(): %v", err)
 				}
-			}
-
-			cpRaw, err := d.GetCheckpointN(ctx, "FooLog", tC.reqN)
-			if (err != nil) != tC.wantErr {
-				t.Fatalf("unexpected error output (wantErr: %t): %v", tC.wantErr, err)
-			}
-			if !tC.wantErr {
-				cp, _, n, err := log.ParseCheckpoint(cpRaw, logFoo.Origin, logFoo.Verifier, tC.wantWits...)
+				var opts []distributor.Option
+				if tC.source != nil {
+					opts = append(opts, distributor.WithForkDetection(tC.source))
+				}
+				d, err := distributor.NewDistributor(ws, ls, s, opts...)
 				if err != nil {
-					t.Error(err)
+					t.Fatalf("NewDistributor(): %v", err)
 				}
-				if got, want := len(n.Sigs), 1+len(tC.wantWits); got != want {
-					t.Errorf("expected %d sigs, got %d", want, got)
+				for witID, cp := range tC.existing {
+					if err := d.Distribute(ctx, "FooLog", witID, cp); err != nil {
+						t.Fatalf("Distribute(%q): %v", witID, err)
+					}
 				}
-				if cp.Size != tC.wantSize {
-					t.Errorf("expected tree size of %d but got %d", tC.wantSize, cp.Size)
+
+				// The submission is accepted even if it is inconsistent with another witness.
+				if err := d.Distribute(ctx, "FooLog", "Aardvark", tC.next); err != nil {
+					t.Fatalf("Distribute(): %v", err)
 				}
-			} else {
-				if got, want := status.Code(err), tC.wantErrCode; got != want {
-					t.Errorf("error code got != want: %v != %v", got, want)
+				d.WaitForForkDetection()
+				got, err := d.GetInconsistencies(ctx, "FooLog")
+				if err != nil {
+					t.Fatalf("GetInconsistencies(): %v", err)
 				}
-			}
+				if diff := cmp.Diff(tC.want, got, cmpopts.EquateEmpty(), cmpopts.IgnoreFields(api.Inconsistency{}, "Discovered")); diff != "" {
+					t.Errorf("unexpected inconsistencies (-want +got):\n%s", diff)
+				}
+			})
 		})
 	}
 }
 
-func logVerifierOrDie(vkey string) note.Verifier {
-	v, err := note.NewVerifier(vkey)
-	if err != nil {
-		panic(err)
+func TestForkDetectionDoesNotBlockSubmissions(t *testing.T) {
+	ctx := context.Background()
+	ws := map[string]note.Verifier{
+		aardvarkVKey: witAardvark.verifier,
+		badgerVKey:   witBadger.verifier,
 	}
-	return v
-}
-
-func logSignerOrDie(skey string) note.Signer {
-	s, err := note.NewSigner(skey)
-	if err != nil {
-		panic(err)
+	ls := map[string]config.LogInfo{
+		"FooLog": logFoo.LogInfo,
 	}
-	return s
-}
-
-func witnessVerifierOrDie(vkey string) note.Verifier {
-	v, err := f_note.NewVerifierForCosignatureV1(vkey)
+	ps := blockingProofSource{release: make(chan struct{})}
+	d, err := distributor.NewDistributor(ws, ls, memory.New(), distributor.WithForkDetection(ps))
 	if err != nil {
-		panic(err)
+		t.Fatalf("NewDistributor(): %v", err)
 	}
-	return v
-}
-
-func witnessSignerOrDie(skey string) note.Signer {
-	s, err := f_note.NewSignerForCosignatureV1(skey)
-	if err != nil {
-		panic(err)
+	if err := d.Distribute(ctx, "FooLog", "Badger", logFoo.checkpoint(10, "foo", witBadger.signer)); err != nil {
+		t.Fatalf("Distribute(): %v", err)
 	}
-	return s
-}
-
-type fakeLog struct {
-	config.LogInfo
-	signer note.Signer
-}
-
-func (l fakeLog) checkpoint(size uint64, hashSeed string, wit ...note.Signer) []byte {
-	hbs := sha256.Sum256([]byte(hashSeed))
-	rawCP := log.Checkpoint{
-		Origin: l.Origin,
-		Size:   size,
-		Hash:   hbs[:],
-	}.Marshal()
-	n := note.Note{}
-	n.Text = string(rawCP)
-	bs, err := note.Sign(&n, append([]note.Signer{l.signer}, wit...)...)
-	if err != nil {
-		panic(err)
+	// This would block forever if the proof source were called synchronously.
+	if err := d.Distribute(ctx, "FooLog", "Aardvark", logFoo.checkpoint(20, "bar", witAardvark.signer)); err != nil {
+		t.Fatalf("Distribute(): %v", err)
 	}
-	return bs
-}
-
-type fakeWitness struct {
-	verifier note.Verifier
-	signer   note.Signer
+	close(ps.release)
+	d.WaitForForkDetection()
 }
@@ -0,0 +1,183 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	gohttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/transparency-dev/distributor/api"
+	"github.com/transparency-dev/distributor/cmd/internal/http"
+	"github.com/transparency-dev/distributor/config"
+)
+
+// newClientCert returns a self-signed TLS client certificate, along with its SHA-256 fingerprint.
+func newClientCert(t *testing.T, name string) (tls.Certificate, string) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey(): %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, pub, priv)
+	if err != nil {
+		t.Fatalf("CreateCertificate(): %v", err)
+	}
+	fp := sha256.Sum256(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: priv}, hex.EncodeToString(fp[:])
+}
+
+func TestUpdateAuthentication(t *testing.T) {
+	aardvarkCert, aardvarkFP := newClientCert(t, "Aardvark")
+	badgerCert, _ := newClientCert(t, "Badger")
+	testCases := []struct {
+		desc           string
+		witid          string
+		requireAuth    bool
+		cert           *tls.Certificate
+		wantStatusCode int
+	}{
+		{
+			desc:           "witness without authentication",
+			witid:          "Badger",
+			wantStatusCode: 200,
+		},
+		{
+			desc:           "witness without authentication when required",
+			witid:          "Badger",
+			requireAuth:    true,
+			wantStatusCode: 401,
+		},
+		{
+			desc:           "witness without authentication when required with certificate",
+			witid:          "Badger",
+			requireAuth:    true,
+			cert:           &badgerCert,
+			wantStatusCode: 403,
+		},
+		{
+			desc:           "allowed client certificate when required",
+			witid:          "Aardvark",
+			requireAuth:    true,
+			cert:           &aardvarkCert,
+			wantStatusCode: 200,
+		},
+		{
+			desc:           "no client certificate",
+			witid:          "Aardvark",
+			wantStatusCode: 401,
+		},
+		{
+			desc:           "wrong client certificate",
+			witid:          "Aardvark",
+			cert:           &badgerCert,
+			wantStatusCode: 403,
+		},
+		{
+			desc:           "allowed client certificate",
+			witid:          "Aardvark",
+			cert:           &aardvarkCert,
+			wantStatusCode: 200,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			d := NewMockDistributor(ctrl)
+			expectSubmitters(d)
+			if tC.wantStatusCode == 200 {
+				d.EXPECT().Distribute(gomock.Any(), "FooLog", tC.witid, []byte("checkpoint")).Return(nil)
+			}
+			var opts []http.Option
+			if tC.requireAuth {
+				opts = append(opts, http.WithRequireClientAuth())
+			}
+			s := http.NewServer(d, opts...)
+			s.SetWitnessAuth(map[string]config.WitnessAuth{
+				"Aardvark": {ClientCertSHA256: []string{aardvarkFP}},
+			})
+			r := mux.NewRouter()
+			s.RegisterHandlers(r)
+			ts := httptest.NewUnstartedServer(r)
+			ts.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+			ts.StartTLS()
+			defer ts.Close()
+
+			client := ts.Client()
+			if tC.cert != nil {
+				client.Transport.(*gohttp.Transport).TLSClientConfig.Certificates = []tls.Certificate{*tC.cert}
+			}
+			req, err := gohttp.NewRequest(gohttp.MethodPut, ts.URL+fmt.Sprintf(api.HTTPCheckpointByWitness, "FooLog", tC.witid), strings.NewReader("checkpoint"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tC.wantStatusCode {
+				t.Errorf("expected %d, got %d", tC.wantStatusCode, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestAddCheckpointAuthentication(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	d := NewMockDistributor(ctrl)
+	d.EXPECT().GetLogOrigins(gomock.Any()).Return([]string{testOrigin}, nil).AnyTimes()
+	d.EXPECT().GetWitnesses(gomock.Any()).Return([]string{"Aardvark+12345678+AAAA"}, nil).AnyTimes()
+	s := http.NewServer(d)
+	s.SetWitnessAuth(map[string]config.WitnessAuth{
+		"Aardvark": {ClientCertSHA256: []string{strings.Repeat("00", 32)}},
+	})
+	r := mux.NewRouter()
+	s.RegisterHandlers(r)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	// Distribute must not be called, as the witness has not authenticated.
+	resp, err := ts.Client().Post(ts.URL+api.HTTPAddCheckpoint, "text/plain", strings.NewReader("old 0\n\n"+testCheckpoint))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := resp.StatusCode, 401; got != want {
+		t.Errorf("expected %d, got %d", want, got)
+	}
+}
@@ -0,0 +1,325 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/gorilla/mux"
+	"github.com/transparency-dev/distributor/api"
+	"github.com/transparency-dev/formats/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxProofLines is the maximum number of consistency proof hashes in an
+// add-checkpoint request, as set by the C2SP tlog-witness spec.
+const maxProofLines = 63
+
+// addCheckpoint handles requests from witnesses to add a cosigned checkpoint, following
+// the add-checkpoint endpoint of https://c2sp.org/tlog-witness.
+func (s *Server) addCheckpoint(w http.ResponseWriter, r *http.Request) {
+	body, ok := s.readBody(w, r, s.maxBodySize)
+	if !ok {
+		return
+	}
+	oldSize, proof, cpRaw, err := parseAddCheckpointRequest(body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+
+	origin, _, _ := bytes.Cut(cpRaw, []byte("\n"))
+	logID := log.ID(string(origin))
+	origins, err := s.d.GetLogOrigins(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get log list: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if !slices.Contains(origins, string(origin)) {
+		http.Error(w, fmt.Sprintf("unknown log %q", origin), http.StatusNotFound)
+		return
+	}
+	witIDs, err := s.witnessCosigners(ctx, cpRaw)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get witness list: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if len(witIDs) != 1 {
+		http.Error(w, fmt.Sprintf("checkpoint must be cosigned by exactly one known witness, found %d", len(witIDs)), http.StatusForbidden)
+		return
+	}
+	witID := witIDs[0]
+	if !s.authenticate(w, r, witID) {
+		return
+	}
+	if !s.allowSubmission(w, logID, witID) {
+		return
+	}
+
+	latestSize, err := s.latestSize(ctx, logID, witID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get latest checkpoint: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if oldSize != latestSize {
+		writeConflict(w, latestSize)
+		return
+	}
+
+	var p *api.ConsistencyProof
+	if oldSize > 0 {
+		p = &api.ConsistencyProof{From: oldSize, Hashes: proof}
+	}
+	if err := s.d.DistributeWithProof(ctx, logID, witID, cpRaw, p); err != nil {
+		glog.Warningf("failed to add checkpoint: %v", err)
+		switch status.Code(err) {
+		case codes.FailedPrecondition:
+			// Either the proof is invalid, the checkpoint is inconsistent with the latest one for
+			// the witness, or another submission from the same witness got in first.
+			if latestSize, err := s.latestSize(ctx, logID, witID); err == nil && latestSize != oldSize {
+				writeConflict(w, latestSize)
+				return
+			}
+			http.Error(w, "invalid consistency proof", http.StatusUnprocessableEntity)
+		case codes.AlreadyExists:
+			// Another submission from the same witness got in first.
+			if latestSize, err := s.latestSize(ctx, logID, witID); err == nil {
+				writeConflict(w, latestSize)
+				return
+			}
+			http.Error(w, "failed to add checkpoint", http.StatusConflict)
+		case codes.InvalidArgument:
+			// Another submission from the same witness may have got in first with a larger
+			// checkpoint, which the spec reports as a conflict.
+			if latestSize, err := s.latestSize(ctx, logID, witID); err == nil && latestSize != oldSize {
+				writeConflict(w, latestSize)
+				return
+			}
+			// Otherwise, as the request has already been parsed and the checkpoint is no smaller
+			// than the old size, a signature failed to verify.
+			http.Error(w, "failed to add checkpoint", http.StatusForbidden)
+		case codes.PermissionDenied:
+			http.Error(w, "failed to add checkpoint", http.StatusForbidden)
+		default:
+			http.Error(w, "failed to add checkpoint", httpForCode(status.Code(err)))
+		}
+		return
+	}
+	// Respond with the witness cosignature, as a witness would.
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, l := range signatureLines(cpRaw) {
+		if name, _, _ := strings.Cut(l, " "); name == witID {
+			if _, err := fmt.Fprintf(w, "— %s\n", l); err != nil {
+				glog.Errorf("w.Write(): %v", err)
+			}
+		}
+	}
+}
+
+// getLogOrigins returns the origins of all logs the distributor is aware of, one per line.
+func (s *Server) getLogOrigins(w http.ResponseWriter, r *http.Request) {
+	origins, err := s.d.GetLogOrigins(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get log list: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, o := range origins {
+		if _, err := fmt.Fprintln(w, o); err != nil {
+			glog.Errorf("w.Write(): %v", err)
+			return
+		}
+	}
+}
+
+// getOriginCheckpoint returns the freshest checkpoint for the log with the origin given,
+// with at least the number of cosignatures requested.
+func (s *Server) getOriginCheckpoint(w http.ResponseWriter, r *http.Request) {
+	logID, ok := s.knownOrigin(w, r)
+	if !ok {
+		return
+	}
+	n := uint64(1)
+	if nStr := r.URL.Query().Get(api.HTTPCosignaturesParam); nStr != "" {
+		var err error
+		if n, err = strconv.ParseUint(nStr, 10, 32); err != nil {
+			http.Error(w, fmt.Sprintf("failed to parse number of cosignatures: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	maxAge, ok := maxAgeParam(w, r)
+	if !ok {
+		return
+	}
+	chkpt, err := s.d.GetCheckpointN(r.Context(), logID, uint32(n), maxAge)
+	writeCheckpoint(w, chkpt, err)
+}
+
+// getOriginCheckpointWitness returns the latest checkpoint for the log with the origin given,
+// cosigned by the given witness.
+func (s *Server) getOriginCheckpointWitness(w http.ResponseWriter, r *http.Request) {
+	logID, ok := s.knownOrigin(w, r)
+	if !ok {
+		return
+	}
+	maxAge, ok := maxAgeParam(w, r)
+	if !ok {
+		return
+	}
+	chkpt, err := s.d.GetCheckpointWitness(r.Context(), logID, mux.Vars(r)["witid"], maxAge)
+	writeCheckpoint(w, chkpt, err)
+}
+
+// knownOrigin returns the ID of the log whose origin is in the request path.
+// If the log is not known to the distributor then an error response is written
+// and false is returned.
+func (s *Server) knownOrigin(w http.ResponseWriter, r *http.Request) (string, bool) {
+	origin := mux.Vars(r)["origin"]
+	origins, err := s.d.GetLogOrigins(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get log list: %v", err), http.StatusInternalServerError)
+		return "", false
+	}
+	if !slices.Contains(origins, origin) {
+		http.Error(w, fmt.Sprintf("unknown log %q", origin), http.StatusNotFound)
+		return "", false
+	}
+	return log.ID(origin), true
+}
+
+// writeCheckpoint writes the checkpoint as the response, or an error response if err is set.
+func writeCheckpoint(w http.ResponseWriter, chkpt []byte, err error) {
+	if err != nil {
+		glog.Warningf("failed to get checkpoint: %v", err)
+		http.Error(w, "failed to get checkpoint", httpForCode(status.Code(err)))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if _, err := w.Write(chkpt); err != nil {
+		glog.Errorf("w.Write(): %v", err)
+	}
+}
+
+// parseAddCheckpointRequest parses the body of an add-checkpoint request into the
+// old size, the consistency proof, and the checkpoint. An error is returned if the
+// checkpoint is smaller than the old size.
+func parseAddCheckpointRequest(body []byte) (uint64, [][]byte, []byte, error) {
+	header, cpRaw, ok := bytes.Cut(body, []byte("\n\n"))
+	if !ok {
+		return 0, nil, nil, errors.New("missing blank line after header")
+	}
+	lines := strings.Split(string(header), "\n")
+	oldStr, ok := strings.CutPrefix(lines[0], "old ")
+	if !ok {
+		return 0, nil, nil, errors.New("missing old size")
+	}
+	oldSize, err := strconv.ParseUint(oldStr, 10, 64)
+	if err != nil || strconv.FormatUint(oldSize, 10) != oldStr {
+		return 0, nil, nil, fmt.Errorf("invalid old size %q", oldStr)
+	}
+	proofLines := lines[1:]
+	if len(proofLines) > maxProofLines {
+		return 0, nil, nil, fmt.Errorf("too many proof lines: %d", len(proofLines))
+	}
+	if oldSize == 0 && len(proofLines) > 0 {
+		return 0, nil, nil, errors.New("unexpected proof for old size 0")
+	}
+	proof := make([][]byte, 0, len(proofLines))
+	for _, l := range proofLines {
+		h, err := base64.StdEncoding.DecodeString(l)
+		if err != nil || len(h) != 32 {
+			return 0, nil, nil, fmt.Errorf("invalid proof hash %q", l)
+		}
+		proof = append(proof, h)
+	}
+	cp := &log.Checkpoint{}
+	if _, err := cp.Unmarshal(cpRaw); err != nil {
+		return 0, nil, nil, fmt.Errorf("invalid checkpoint: %v", err)
+	}
+	if cp.Size < oldSize {
+		return 0, nil, nil, fmt.Errorf("checkpoint size %d is smaller than old size %d", cp.Size, oldSize)
+	}
+	return oldSize, proof, cpRaw, nil
+}
+
+// witnessCosigners returns the IDs of all of the known witnesses with a signature line on
+// the checkpoint note. The signatures are not verified.
+func (s *Server) witnessCosigners(ctx context.Context, cpRaw []byte) ([]string, error) {
+	wits, err := s.d.GetWitnesses(ctx)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(wits))
+	for _, k := range wits {
+		name, _, _ := strings.Cut(k, "+")
+		known[name] = true
+	}
+	var r []string
+	for _, l := range signatureLines(cpRaw) {
+		if name, _, _ := strings.Cut(l, " "); known[name] && !slices.Contains(r, name) {
+			r = append(r, name)
+		}
+	}
+	return r, nil
+}
+
+// signatureLines returns the signature lines of a note, without the leading "— ".
+func signatureLines(n []byte) []string {
+	_, sigs, _ := bytes.Cut(n, []byte("\n\n"))
+	var r []string
+	for _, l := range strings.Split(string(sigs), "\n") {
+		if sig, ok := strings.CutPrefix(l, "— "); ok {
+			r = append(r, sig)
+		}
+	}
+	return r
+}
+
+// latestSize returns the tree size of the latest checkpoint stored for the log by the
+// witness, or zero if there is none.
+func (s *Server) latestSize(ctx context.Context, logID, witID string) (uint64, error) {
+	cpRaw, err := s.d.GetCheckpointWitness(ctx, logID, witID, 0)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return 0, nil
+		}
+		return 0, err
+	}
+	cp := &log.Checkpoint{}
+	if _, err := cp.Unmarshal(cpRaw); err != nil {
+		return 0, fmt.Errorf("failed to parse stored checkpoint: %v", err)
+	}
+	return cp.Size, nil
+}
+
+// writeConflict writes a 409 response containing the latest size known for the witness.
+func writeConflict(w http.ResponseWriter, size uint64) {
+	w.Header().Set("Content-Type", api.ContentTypeTLogSize)
+	w.WriteHeader(http.StatusConflict)
+	if _, err := fmt.Fprintf(w, "%d\n", size); err != nil {
+		glog.Errorf("w.Write(): %v", err)
+	}
+}
@@ -0,0 +1,336 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http_test
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/transparency-dev/distributor/api"
+	"github.com/transparency-dev/distributor/cmd/internal/distributor"
+	"github.com/transparency-dev/distributor/cmd/internal/storage/memory"
+	"github.com/transparency-dev/distributor/config"
+	"github.com/transparency-dev/formats/log"
+	f_note "github.com/transparency-dev/formats/note"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/merkle/testonly"
+	"golang.org/x/mod/sumdb/note"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	testOrigin     = "example.com/log"
+	testCheckpoint = testOrigin + "\n16\nqINS1GRFhWHwdkUeqLEoP4yEMkTBBzxBkGwGQlVlVcs=\n\n— example.com/log AAAAAQ==\n— Aardvark BBBBBBBB\n"
+)
+
+func TestAddCheckpoint(t *testing.T) {
+	logID := log.ID(testOrigin)
+	witnesses := []string{"Aardvark+12345678+AAAA", "Badger+87654321+BBBB"}
+	proofHash, err := base64.StdEncoding.DecodeString("qINS1GRFhWHwdkUeqLEoP4yEMkTBBzxBkGwGQlVlVcs=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof := &api.ConsistencyProof{From: 10, Hashes: [][]byte{proofHash}}
+	testCases := []struct {
+		desc           string
+		body           string
+		storedCP       string
+		storedAfter    string
+		wantDistribute bool
+		wantProof      *api.ConsistencyProof
+		distributeErr  error
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			desc:           "first checkpoint",
+			body:           "old 0\n\n" + testCheckpoint,
+			wantDistribute: true,
+			wantStatusCode: 200,
+			wantBody:       "— Aardvark BBBBBBBB\n",
+		},
+		{
+			desc:           "consistent update",
+			body:           "old 10\nqINS1GRFhWHwdkUeqLEoP4yEMkTBBzxBkGwGQlVlVcs=\n\n" + testCheckpoint,
+			storedCP:       testOrigin + "\n10\nqINS1GRFhWHwdkUeqLEoP4yEMkTBBzxBkGwGQlVlVcs=\n\n— Aardvark CCCC\n",
+			wantDistribute: true,
+			wantProof:      proof,
+			wantStatusCode: 200,
+			wantBody:       "— Aardvark BBBBBBBB\n",
+		},
+		{
+			desc:           "proof does not verify",
+			body:           "old 10\nqINS1GRFhWHwdkUeqLEoP4yEMkTBBzxBkGwGQlVlVcs=\n\n" + testCheckpoint,
+			storedCP:       testOrigin + "\n10\nqINS1GRFhWHwdkUeqLEoP4yEMkTBBzxBkGwGQlVlVcs=\n\n— Aardvark CCCC\n",
+			wantDistribute: true,
+			wantProof:      proof,
+			distributeErr:  status.Error(codes.FailedPrecondition, "invalid consistency proof"),
+			wantStatusCode: 422,
+		},
+		{
+			desc:           "old size does not match",
+			body:           "old 5\nqINS1GRFhWHwdkUeqLEoP4yEMkTBBzxBkGwGQlVlVcs=\n\n" + testCheckpoint,
+			storedCP:       testOrigin + "\n10\nqINS1GRFhWHwdkUeqLEoP4yEMkTBBzxBkGwGQlVlVcs=\n\n— Aardvark CCCC\n",
+			wantStatusCode: 409,
+			wantBody:       "10\n",
+		},
+		{
+			desc:           "superseded by a concurrent submission",
+			body:           "old 0\n\n" + testCheckpoint,
+			storedAfter:    testOrigin + "\n20\nqINS1GRFhWHwdkUeqLEoP4yEMkTBBzxBkGwGQlVlVcs=\n\n— Aardvark CCCC\n",
+			wantDistribute: true,
+			distributeErr:  status.Error(codes.InvalidArgument, "cannot update to smaller size"),
+			wantStatusCode: 409,
+			wantBody:       "20\n",
+		},
+		{
+			desc:           "bad signature",
+			body:           "old 0\n\n" + testCheckpoint,
+			wantDistribute: true,
+			distributeErr:  status.Error(codes.InvalidArgument, "bad sig"),
+			wantStatusCode: 403,
+		},
+		{
+			desc:           "unknown log",
+			body:           "old 0\n\nexample.com/other\n16\nqINS1GRFhWHwdkUeqLEoP4yEMkTBBzxBkGwGQlVlVcs=\n\n— Aardvark BBBBBBBB\n",
+			wantStatusCode: 404,
+		},
+		{
+			desc:           "no known witness",
+			body:           "old 0\n\n" + testOrigin + "\n16\nqINS1GRFhWHwdkUeqLEoP4yEMkTBBzxBkGwGQlVlVcs=\n\n— Dingo BBBBBBBB\n",
+			wantStatusCode: 403,
+		},
+		{
+			desc:           "missing old",
+			body:           "\n" + testCheckpoint,
+			wantStatusCode: 400,
+		},
+		{
+			desc:           "proof with old size 0",
+			body:           "old 0\nqINS1GRFhWHwdkUeqLEoP4yEMkTBBzxBkGwGQlVlVcs=\n\n" + testCheckpoint,
+			wantStatusCode: 400,
+		},
+		{
+			desc:           "invalid proof",
+			body:           "old 10\nnotbase64!\n\n" + testCheckpoint,
+			wantStatusCode: 400,
+		},
+		{
+			desc:           "checkpoint smaller than old size",
+			body:           "old 20\n\n" + testCheckpoint,
+			storedCP:       testOrigin + "\n20\nqINS1GRFhWHwdkUeqLEoP4yEMkTBBzxBkGwGQlVlVcs=\n\n— Aardvark CCCC\n",
+			wantStatusCode: 400,
+		},
+		{
+			desc:           "malformed checkpoint",
+			body:           "old 0\n\n" + testOrigin + "\nsixteen\nqINS1GRFhWHwdkUeqLEoP4yEMkTBBzxBkGwGQlVlVcs=\n\n— Aardvark BBBBBBBB\n",
+			wantStatusCode: 400,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			d := NewMockDistributor(ctrl)
+			s, close := createTestEnv(d)
+			defer close()
+
+			d.EXPECT().GetLogOrigins(gomock.Any()).Return([]string{testOrigin}, nil).AnyTimes()
+			d.EXPECT().GetWitnesses(gomock.Any()).Return(witnesses, nil).AnyTimes()
+			expectStored := func(cp string) *gomock.Call {
+				if cp == "" {
+					return d.EXPECT().GetCheckpointWitness(gomock.Any(), logID, "Aardvark", time.Duration(0)).Return(nil, status.Error(codes.NotFound, "none"))
+				}
+				return d.EXPECT().GetCheckpointWitness(gomock.Any(), logID, "Aardvark", time.Duration(0)).Return([]byte(cp), nil)
+			}
+			if tC.storedAfter == "" {
+				expectStored(tC.storedCP).AnyTimes()
+			} else {
+				// Calls match expectations in order, so the first lookup sees storedCP.
+				expectStored(tC.storedCP).Times(1)
+				expectStored(tC.storedAfter).AnyTimes()
+			}
+			if tC.wantDistribute {
+				d.EXPECT().DistributeWithProof(gomock.Any(), logID, "Aardvark", []byte(testCheckpoint), tC.wantProof).Return(tC.distributeErr)
+			}
+
+			resp, err := s.Client().Post(s.URL+api.HTTPAddCheckpoint, "text/plain", strings.NewReader(tC.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tC.wantStatusCode {
+				t.Errorf("expected %d, got %d", tC.wantStatusCode, resp.StatusCode)
+			}
+			if tC.wantBody == "" {
+				return
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(body); got != tC.wantBody {
+				t.Errorf("expected body %q, got %q", tC.wantBody, got)
+			}
+			if resp.StatusCode == 409 {
+				if got, want := resp.Header.Get("Content-Type"), api.ContentTypeTLogSize; got != want {
+					t.Errorf("expected content type %q, got %q", want, got)
+				}
+			}
+		})
+	}
+}
+
+// TestAddCheckpointVerifiesProof checks, against a real distributor, that the consistency
+// proof in an add-checkpoint request is verified before the checkpoint is accepted.
+func TestAddCheckpointVerifiesProof(t *testing.T) {
+	const (
+		origin  = "from foo"
+		logSKey = "PRIVATE+KEY+FooLog+3d42aea6+AdLOqvyC6Q/86GltHux+trlUT3fRKyCtnc/1VMrmLIdo"
+		logVKey = "FooLog+3d42aea6+Aby03a35YY+FNI4dfRSvLtq1jQE5UjxIW5CXfK0hiIac"
+		witSKey = "PRIVATE+KEY+Aardvark+871d50e2+Ad/vysEZw5Etl39nPqMjSyJ74QPxkj6W5aBEpLiJWAf2"
+		witVKey = "Aardvark+871d50e2+AWvETn8gle8a0w19eLk7A9bj8INCAXa+LCJ8Om3jwYsD"
+	)
+	logV, err := note.NewVerifier(logVKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logS, err := note.NewSigner(logSKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	witV, err := f_note.NewVerifierForCosignatureV1(witVKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	witS, err := f_note.NewSignerForCosignatureV1(witSKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := distributor.NewDistributor(
+		map[string]note.Verifier{witVKey: witV},
+		map[string]config.LogInfo{log.ID(origin): {Origin: origin, Verifier: logV}},
+		memory.New())
+	if err != nil {
+		t.Fatalf("NewDistributor(): %v", err)
+	}
+	s, close := createTestEnv(d)
+	defer close()
+
+	// other differs from tree in its first leaf, so its proofs do not match tree's root hashes.
+	// fork shares the first 10 leaves of tree, and differs after that.
+	tree, other, fork := testonly.New(rfc6962.DefaultHasher), testonly.New(rfc6962.DefaultHasher), testonly.New(rfc6962.DefaultHasher)
+	for i := 0; i < 20; i++ {
+		tree.AppendData([]byte(fmt.Sprintf("leaf %d", i)))
+		other.AppendData([]byte(fmt.Sprintf("other %d", i)))
+		if i < 10 {
+			fork.AppendData([]byte(fmt.Sprintf("leaf %d", i)))
+		} else {
+			fork.AppendData([]byte(fmt.Sprintf("fork %d", i)))
+		}
+	}
+	checkpoint := func(cpTree *testonly.Tree, size uint64) string {
+		n := &note.Note{Text: string(log.Checkpoint{Origin: origin, Size: size, Hash: cpTree.HashAt(size)}.Marshal())}
+		cp, err := note.Sign(n, logS, witS)
+		if err != nil {
+			t.Fatalf("Sign(): %v", err)
+		}
+		return string(cp)
+	}
+	request := func(oldSize uint64, proofTree, cpTree *testonly.Tree, size uint64) string {
+		var b strings.Builder
+		fmt.Fprintf(&b, "old %d\n", oldSize)
+		if oldSize > 0 {
+			p, err := proofTree.ConsistencyProof(oldSize, size)
+			if err != nil {
+				t.Fatalf("ConsistencyProof(): %v", err)
+			}
+			for _, h := range p {
+				fmt.Fprintf(&b, "%s\n", base64.StdEncoding.EncodeToString(h))
+			}
+		}
+		return b.String() + "\n" + checkpoint(cpTree, size)
+	}
+
+	for _, step := range []struct {
+		desc           string
+		body           string
+		wantStatusCode int
+		wantSize       uint64
+	}{
+		{
+			desc:           "first checkpoint",
+			body:           request(0, nil, tree, 10),
+			wantStatusCode: 200,
+			wantSize:       10,
+		},
+		{
+			desc:           "checkpoint smaller than old size",
+			body:           "old 10\n\n" + checkpoint(tree, 5),
+			wantStatusCode: 400,
+			wantSize:       10,
+		},
+		{
+			desc:           "proof does not verify",
+			body:           request(10, other, tree, 20),
+			wantStatusCode: 422,
+			wantSize:       10,
+		},
+		{
+			desc:           "proof matches old root but not new",
+			body:           request(10, tree, fork, 20),
+			wantStatusCode: 422,
+			wantSize:       10,
+		},
+		{
+			desc:           "same size with different hash",
+			body:           request(10, tree, other, 10),
+			wantStatusCode: 422,
+			wantSize:       10,
+		},
+		{
+			desc:           "proof verifies",
+			body:           request(10, tree, tree, 20),
+			wantStatusCode: 200,
+			wantSize:       20,
+		},
+	} {
+		resp, err := s.Client().Post(s.URL+api.HTTPAddCheckpoint, "text/plain", strings.NewReader(step.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != step.wantStatusCode {
+			t.Errorf("%s: expected %d, got %d", step.desc, step.wantStatusCode, resp.StatusCode)
+		}
+		cpRaw, err := d.GetCheckpointWitness(context.Background(), log.ID(origin), "Aardvark", 0)
+		if err != nil {
+			t.Fatalf("%s: GetCheckpointWitness(): %v", step.desc, err)
+		}
+		cp, _, _, err := log.ParseCheckpoint(cpRaw, origin, logV, witV)
+		if err != nil {
+			t.Fatalf("%s: ParseCheckpoint(): %v", step.desc, err)
+		}
+		if cp.Size != step.wantSize {
+			t.Errorf("%s: stored checkpoint has size %d, want %d", step.desc, cp.Size, step.wantSize)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	gohttp "net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/transparency-dev/distributor/api"
+	"github.com/transparency-dev/distributor/cmd/internal/http"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestOversizedSubmission(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		method, path   string
+		body           string
+		distributeErr  error
+		wantDistribute bool
+		// batchDistributed are the checkpoints in a batch that are expected to be distributed.
+		batchDistributed []string
+		wantStatusCode   int
+		// wantBatchStatuses are the expected statuses of the checkpoints in a batch.
+		wantBatchStatuses []int
+	}{
+		{
+			desc:           "update within limit",
+			method:         gohttp.MethodPut,
+			path:           fmt.Sprintf(api.HTTPCheckpointByWitness, "FooLog", "Aardvark"),
+			body:           strings.Repeat("a", 32),
+			wantDistribute: true,
+			wantStatusCode: 200,
+		},
+		{
+			desc:           "update too large",
+			method:         gohttp.MethodPut,
+			path:           fmt.Sprintf(api.HTTPCheckpointByWitness, "FooLog", "Aardvark"),
+			body:           strings.Repeat("a", 33),
+			wantStatusCode: 413,
+		},
+		{
+			desc:           "note exceeds distributor limits",
+			method:         gohttp.MethodPut,
+			path:           fmt.Sprintf(api.HTTPCheckpointByWitness, "FooLog", "Aardvark"),
+			body:           strings.Repeat("a", 32),
+			wantDistribute: true,
+			distributeErr:  status.Error(codes.ResourceExhausted, "too many signatures"),
+			wantStatusCode: 413,
+		},
+		{
+			desc:           "add-checkpoint too large",
+			method:         gohttp.MethodPost,
+			path:           api.HTTPAddCheckpoint,
+			body:           "old 0\n\n" + strings.Repeat("a", 32),
+			wantStatusCode: 413,
+		},
+		{
+			desc:              "batch larger than a single submission",
+			method:            gohttp.MethodPost,
+			path:              fmt.Sprintf(api.HTTPDistributeBatch, "Aardvark"),
+			body:              `[{"logID": "FooLog", "checkpoint": "` + strings.Repeat("a", 32) + `"}, {"logID": "FooLog", "checkpoint": "` + strings.Repeat("b", 32) + `"}]`,
+			batchDistributed:  []string{strings.Repeat("a", 32), strings.Repeat("b", 32)},
+			wantStatusCode:    200,
+			wantBatchStatuses: []int{200, 200},
+		},
+		{
+			desc:              "batch with checkpoint too large",
+			method:            gohttp.MethodPost,
+			path:              fmt.Sprintf(api.HTTPDistributeBatch, "Aardvark"),
+			body:              `[{"logID": "FooLog", "checkpoint": "` + strings.Repeat("a", 33) + `"}, {"logID": "FooLog", "checkpoint": "` + strings.Repeat("b", 32) + `"}]`,
+			batchDistributed:  []string{strings.Repeat("b", 32)},
+			wantStatusCode:    200,
+			wantBatchStatuses: []int{413, 200},
+		},
+		{
+			desc:           "batch too large",
+			method:         gohttp.MethodPost,
+			path:           fmt.Sprintf(api.HTTPDistributeBatch, "Aardvark"),
+			body:           strings.Repeat(" ", 32*100) + "[]",
+			wantStatusCode: 413,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			d := NewMockDistributor(ctrl)
+			expectSubmitters(d)
+			if tC.wantDistribute {
+				d.EXPECT().Distribute(gomock.Any(), "FooLog", "Aardvark", []byte(tC.body)).Return(tC.distributeErr)
+			}
+			for _, cp := range tC.batchDistributed {
+				d.EXPECT().Distribute(gomock.Any(), "FooLog", "Aardvark", []byte(cp)).Return(nil)
+			}
+			r := mux.NewRouter()
+			http.NewServer(d, http.WithMaxBodySize(32)).RegisterHandlers(r)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			req, err := gohttp.NewRequest(tC.method, ts.URL+tC.path, strings.NewReader(tC.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tC.wantStatusCode {
+				t.Errorf("expected %d, got %d", tC.wantStatusCode, resp.StatusCode)
+			}
+			if tC.wantBatchStatuses == nil {
+				return
+			}
+			var results []api.BatchResult
+			if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			var got []int
+			for _, res := range results {
+				got = append(got, res.Status)
+			}
+			if !slices.Equal(got, tC.wantBatchStatuses) {
+				t.Errorf("got batch statuses %v, want %v", got, tC.wantBatchStatuses)
+			}
+		})
+	}
+}
+
+func TestSlowSubmission(t *testing.T) {
+	path := fmt.Sprintf(api.HTTPCheckpointByWitness, "FooLog", "Aardvark")
+	testCases := []struct {
+		desc string
+		// sent is written to the server, which then waits for the rest of the request.
+		sent string
+	}{
+		{
+			desc: "slow headers",
+			sent: "PUT " + path + " HTTP/1.1\r\nHost: distributor\r\n",
+		},
+		{
+			desc: "slow body",
+			sent: "PUT " + path + " HTTP/1.1\r\nHost: distributor\r\nContent-Length: 100\r\n\r\nfrom foo\n",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			// Distribute must not be called, as the request is never completed.
+			d := NewMockDistributor(ctrl)
+			expectSubmitters(d)
+			r := mux.NewRouter()
+			http.NewServer(d).RegisterHandlers(r)
+			ts := httptest.NewUnstartedServer(r)
+			ts.Config = http.NewHTTPServer(r, http.Timeouts{
+				ReadHeader: 100 * time.Millisecond,
+				Read:       200 * time.Millisecond,
+			})
+			ts.Start()
+			defer ts.Close()
+
+			conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				if err := conn.Close(); err != nil {
+					t.Errorf("conn.Close(): %v", err)
+				}
+			}()
+			if _, err := io.WriteString(conn, tC.sent); err != nil {
+				t.Fatal(err)
+			}
+			// The server must give up on the request long before this deadline.
+			if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+				t.Fatal(err)
+			}
+			resp, err := io.ReadAll(conn)
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				t.Fatal("server did not time out the request")
+			}
+			if strings.HasPrefix(string(resp), "HTTP/1.1 200") {
+				t.Errorf("got successful response %q", resp)
+			}
+		})
+	}
+}
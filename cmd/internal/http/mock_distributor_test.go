@@ -6,8 +6,10 @@ package http_test
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
+	api "github.com/transparency-dev/distributor/api"
 )
 
 // MockDistributor is a mock of Distributor interface.
@@ -47,34 +49,123 @@ func (mr *MockDistributorMockRecorder) Distribute(arg0, arg1, arg2, arg3 interfa
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Distribute", reflect.TypeOf((*MockDistributor)(nil).Distribute), arg0, arg1, arg2, arg3)
 }
 
+// DistributeWithProof mocks base method.
+func (m *MockDistributor) DistributeWithProof(arg0 context.Context, arg1, arg2 string, arg3 []byte, arg4 *api.ConsistencyProof) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DistributeWithProof", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DistributeWithProof indicates an expected call of DistributeWithProof.
+func (mr *MockDistributorMockRecorder) DistributeWithProof(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DistributeWithProof", reflect.TypeOf((*MockDistributor)(nil).DistributeWithProof), arg0, arg1, arg2, arg3, arg4)
+}
+
 // GetCheckpointN mocks base method.
-func (m *MockDistributor) GetCheckpointN(arg0 context.Context, arg1 string, arg2 uint32) ([]byte, error) {
+func (m *MockDistributor) GetCheckpointN(arg0 context.Context, arg1 string, arg2 uint32, arg3 time.Duration) ([]byte, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetCheckpointN", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "GetCheckpointN", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].([]byte)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetCheckpointN indicates an expected call of GetCheckpointN.
-func (mr *MockDistributorMockRecorder) GetCheckpointN(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockDistributorMockRecorder) GetCheckpointN(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCheckpointN", reflect.TypeOf((*MockDistributor)(nil).GetCheckpointN), arg0, arg1, arg2, arg3)
+}
+
+// GetCheckpointForPolicy mocks base method.
+func (m *MockDistributor) GetCheckpointForPolicy(arg0 context.Context, arg1, arg2 string) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCheckpointForPolicy", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCheckpointForPolicy indicates an expected call of GetCheckpointForPolicy.
+func (mr *MockDistributorMockRecorder) GetCheckpointForPolicy(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCheckpointForPolicy", reflect.TypeOf((*MockDistributor)(nil).GetCheckpointForPolicy), arg0, arg1, arg2)
+}
+
+// GetCheckpointForWitnesses mocks base method.
+func (m *MockDistributor) GetCheckpointForWitnesses(arg0 context.Context, arg1 string, arg2 []string, arg3 uint32) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCheckpointForWitnesses", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCheckpointForWitnesses indicates an expected call of GetCheckpointForWitnesses.
+func (mr *MockDistributorMockRecorder) GetCheckpointForWitnesses(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCheckpointN", reflect.TypeOf((*MockDistributor)(nil).GetCheckpointN), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCheckpointForWitnesses", reflect.TypeOf((*MockDistributor)(nil).GetCheckpointForWitnesses), arg0, arg1, arg2, arg3)
 }
 
 // GetCheckpointWitness mocks base method.
-func (m *MockDistributor) GetCheckpointWitness(arg0 context.Context, arg1, arg2 string) ([]byte, error) {
+func (m *MockDistributor) GetCheckpointWitness(arg0 context.Context, arg1, arg2 string, arg3 time.Duration) ([]byte, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetCheckpointWitness", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "GetCheckpointWitness", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].([]byte)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetCheckpointWitness indicates an expected call of GetCheckpointWitness.
-func (mr *MockDistributorMockRecorder) GetCheckpointWitness(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockDistributorMockRecorder) GetCheckpointWitness(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCheckpointWitness", reflect.TypeOf((*MockDistributor)(nil).GetCheckpointWitness), arg0, arg1, arg2, arg3)
+}
+
+// GetCheckpointHistory mocks base method.
+func (m *MockDistributor) GetCheckpointHistory(arg0 context.Context, arg1, arg2 string, arg3, arg4 time.Time) ([][]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCheckpointHistory", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].([][]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCheckpointHistory indicates an expected call of GetCheckpointHistory.
+func (mr *MockDistributorMockRecorder) GetCheckpointHistory(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCheckpointHistory", reflect.TypeOf((*MockDistributor)(nil).GetCheckpointHistory), arg0, arg1, arg2, arg3, arg4)
+}
+
+// GetInconsistencies mocks base method.
+func (m *MockDistributor) GetInconsistencies(arg0 context.Context, arg1 string) ([]api.Inconsistency, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetInconsistencies", arg0, arg1)
+	ret0, _ := ret[0].([]api.Inconsistency)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetInconsistencies indicates an expected call of GetInconsistencies.
+func (mr *MockDistributorMockRecorder) GetInconsistencies(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInconsistencies", reflect.TypeOf((*MockDistributor)(nil).GetInconsistencies), arg0, arg1)
+}
+
+// GetLogOrigins mocks base method.
+func (m *MockDistributor) GetLogOrigins(arg0 context.Context) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLogOrigins", arg0)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLogOrigins indicates an expected call of GetLogOrigins.
+func (mr *MockDistributorMockRecorder) GetLogOrigins(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCheckpointWitness", reflect.TypeOf((*MockDistributor)(nil).GetCheckpointWitness), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLogOrigins", reflect.TypeOf((*MockDistributor)(nil).GetLogOrigins), arg0)
 }
 
 // GetLogs mocks base method.
@@ -0,0 +1,69 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// maxIdleLimiters is the number of limiters that a keyedLimiter holds before it
+// starts to discard those which are idle.
+const maxIdleLimiters = 1024
+
+// keyedLimiter is a set of token bucket rate limiters, one for each key.
+type keyedLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu sync.Mutex
+	ls map[string]*rate.Limiter
+}
+
+func newKeyedLimiter(limit rate.Limit, burst int) *keyedLimiter {
+	return &keyedLimiter{
+		limit: limit,
+		burst: burst,
+		ls:    make(map[string]*rate.Limiter),
+	}
+}
+
+// reserve reserves a token for the key at the time given, returning the reservation.
+func (k *keyedLimiter) reserve(key string, now time.Time) *rate.Reservation {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	l, ok := k.ls[key]
+	if !ok {
+		if len(k.ls) >= maxIdleLimiters {
+			k.prune(now)
+		}
+		l = rate.NewLimiter(k.limit, k.burst)
+		k.ls[key] = l
+	}
+	return l.ReserveN(now, 1)
+}
+
+// prune discards limiters whose buckets have refilled, as they behave the same as a new one.
+// This bounds the memory used when requests are made for many different keys, such as IDs
+// that are not known to the distributor.
+func (k *keyedLimiter) prune(now time.Time) {
+	for key, l := range k.ls {
+		if l.TokensAt(now) >= float64(k.burst) {
+			delete(k.ls, key)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http_test
+
+import (
+	"fmt"
+	gohttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/transparency-dev/distributor/api"
+	"github.com/transparency-dev/distributor/cmd/internal/http"
+	"golang.org/x/time/rate"
+)
+
+func TestUpdateRateLimit(t *testing.T) {
+	type submission struct {
+		logid, witid   string
+		wantStatusCode int
+	}
+	testCases := []struct {
+		desc        string
+		opts        []http.Option
+		submissions []submission
+	}{
+		{
+			desc: "no limits",
+			submissions: []submission{
+				{"FooLog", "Aardvark", 200},
+				{"FooLog", "Aardvark", 200},
+				{"FooLog", "Aardvark", 200},
+			},
+		},
+		{
+			desc: "witness limit",
+			opts: []http.Option{http.WithWitnessRateLimit(rate.Every(time.Hour), 2)},
+			submissions: []submission{
+				{"FooLog", "Aardvark", 200},
+				{"BarLog", "Aardvark", 200},
+				{"FooLog", "Aardvark", 429},
+				{"FooLog", "Badger", 200},
+			},
+		},
+		{
+			desc: "log limit",
+			opts: []http.Option{http.WithLogRateLimit(rate.Every(time.Hour), 1)},
+			submissions: []submission{
+				{"FooLog", "Aardvark", 200},
+				{"FooLog", "Badger", 429},
+				{"BarLog", "Badger", 200},
+			},
+		},
+		{
+			desc: "unknown logs and witnesses do not use up limits",
+			opts: []http.Option{http.WithWitnessRateLimit(rate.Every(time.Hour), 1), http.WithLogRateLimit(rate.Every(time.Hour), 1)},
+			submissions: []submission{
+				{"FooLog", "Dingo", 404},
+				{"QuuxLog", "Aardvark", 404},
+				{"FooLog", "Aardvark", 200},
+			},
+		},
+		{
+			desc: "rejected submissions do not use up other limits",
+			opts: []http.Option{http.WithWitnessRateLimit(rate.Every(time.Hour), 1), http.WithLogRateLimit(rate.Every(time.Hour), 1)},
+			submissions: []submission{
+				{"FooLog", "Aardvark", 200},
+				{"BarLog", "Aardvark", 429},
+				{"BarLog", "Badger", 200},
+			},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			d := NewMockDistributor(ctrl)
+			expectSubmitters(d)
+			r := mux.NewRouter()
+			http.NewServer(d, tC.opts...).RegisterHandlers(r)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			for i, sub := range tC.submissions {
+				if sub.wantStatusCode == 200 {
+					d.EXPECT().Distribute(gomock.Any(), sub.logid, sub.witid, []byte("checkpoint")).Return(nil)
+				}
+				req, err := gohttp.NewRequest(gohttp.MethodPut, ts.URL+fmt.Sprintf(api.HTTPCheckpointByWitness, sub.logid, sub.witid), strings.NewReader("checkpoint"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp, err := ts.Client().Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resp.StatusCode != sub.wantStatusCode {
+					t.Errorf("submission %d: expected %d, got %d", i, sub.wantStatusCode, resp.StatusCode)
+				}
+				if resp.StatusCode == 429 {
+					// The next token is available just under an hour after the first submission.
+					if got, want := resp.Header.Get("Retry-After"), "3600"; got != want {
+						t.Errorf("submission %d: got Retry-After %q, want %q", i, got, want)
+					}
+				}
+			}
+		})
+	}
+}
@@ -17,15 +17,25 @@ package http
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/gorilla/mux"
 	"github.com/transparency-dev/distributor/api"
+	"github.com/transparency-dev/distributor/config"
+	"golang.org/x/time/rate"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -35,29 +45,264 @@ type Distributor interface {
 	// GetLogs returns a list of all log IDs the distributor is aware of, sorted
 	// by the ID.
 	GetLogs(ctx context.Context) ([]string, error)
+	// GetLogOrigins returns the origins of all logs the distributor is aware of, sorted.
+	GetLogOrigins(ctx context.Context) ([]string, error)
 	// GetWitnesses returns a list of all witness verifier keys the distributor is
 	// aware of, sorted by the ID.
 	GetWitnesses(ctx context.Context) ([]string, error)
 	// GetCheckpointN gets the largest checkpoint for a given log that has at least `n` signatures.
-	GetCheckpointN(ctx context.Context, logID string, n uint32) ([]byte, error)
+	// If maxAge is non-zero, only signatures made within maxAge are counted.
+	GetCheckpointN(ctx context.Context, logID string, n uint32, maxAge time.Duration) ([]byte, error)
+	// GetCheckpointForPolicy gets the largest checkpoint for the log whose witness signatures satisfy the named policy.
+	GetCheckpointForPolicy(ctx context.Context, logID, policy string) ([]byte, error)
+	// GetCheckpointForWitnesses gets the largest checkpoint for the log that at least k of the given
+	// witnesses have cosigned, or all of them if k is zero.
+	GetCheckpointForWitnesses(ctx context.Context, logID string, witIDs []string, k uint32) ([]byte, error)
 	// GetCheckpointWitness gets the largest checkpoint for the log that was witnessed by the given witness.
-	GetCheckpointWitness(ctx context.Context, logID, witID string) ([]byte, error)
+	// If maxAge is non-zero, the checkpoint is only returned if it was signed within maxAge.
+	GetCheckpointWitness(ctx context.Context, logID, witID string, maxAge time.Duration) ([]byte, error)
+	// GetCheckpointHistory returns the checkpoints for the log that were accepted from the witness,
+	// and which the witness signed at a time within [since, until). If until is zero then there is
+	// no upper bound.
+	GetCheckpointHistory(ctx context.Context, logID, witID string, since, until time.Time) ([][]byte, error)
+	// GetInconsistencies returns the evidence of inconsistency that has been found for the log.
+	GetInconsistencies(ctx context.Context, logID string) ([]api.Inconsistency, error)
 	// Distribute adds a new witnessed checkpoint to be distributed. This checkpoint must be signed
 	// by both the log and the witness specified, and be larger than any previous checkpoint distributed
 	// for this pair.
 	Distribute(ctx context.Context, logID, witID string, nextRaw []byte) error
+	// DistributeWithProof is like Distribute, but the checkpoint is accompanied by a proof that it is
+	// consistent with the previous checkpoint for this pair.
+	DistributeWithProof(ctx context.Context, logID, witID string, nextRaw []byte, p *api.ConsistencyProof) error
 }
 
 // Server is the core handler implementation of the witness.
 type Server struct {
-	d Distributor
+	d    Distributor
+	auth atomic.Pointer[map[string]config.WitnessAuth]
+	now  func() time.Time
+
+	// maxBodySize is the maximum size, in bytes, of the body of a checkpoint submission,
+	// and of each checkpoint in a batch.
+	maxBodySize int64
+
+	// requireClientAuth is true if witnesses without client certificates configured
+	// cannot submit checkpoints.
+	requireClientAuth bool
+
+	// witLimits and logLimits rate limit submissions of checkpoints by witness ID
+	// and log ID respectively. Either may be nil if there is no limit.
+	witLimits, logLimits *keyedLimiter
+}
+
+const (
+	// DefaultMaxBodySize is the default maximum size, in bytes, of the body of a checkpoint
+	// submission.
+	DefaultMaxBodySize = 64 << 10
+	// maxBatchSize is the maximum number of checkpoints in a batch submitted by a witness.
+	maxBatchSize = 100
+)
+
+// Option configures optional behaviour of a Server.
+type Option func(*Server)
+
+// WithMaxBodySize sets the maximum size, in bytes, of the body of a checkpoint submission.
+// Larger submissions are rejected with status 413. The default is DefaultMaxBodySize.
+// A batch may be up to maxBatchSize times larger, but each checkpoint in it is held to
+// the same limit as a single submission.
+func WithMaxBodySize(n int64) Option {
+	return func(s *Server) {
+		s.maxBodySize = n
+	}
+}
+
+// WithRequireClientAuth requires that every witness authenticates its submissions with a
+// TLS client certificate. Submissions from witnesses without any certificate fingerprints
+// configured are then rejected, rather than being accepted without authentication.
+func WithRequireClientAuth() Option {
+	return func(s *Server) {
+		s.requireClientAuth = true
+	}
+}
+
+// WithWitnessRateLimit limits the rate at which checkpoints can be submitted by each
+// witness, to r per second with bursts of up to burst. Submissions over the limit are
+// rejected with status 429. By default there is no limit.
+func WithWitnessRateLimit(r rate.Limit, burst int) Option {
+	return func(s *Server) {
+		s.witLimits = newKeyedLimiter(r, burst)
+	}
+}
+
+// WithLogRateLimit limits the rate at which checkpoints can be submitted for each log,
+// across all witnesses, to r per second with bursts of up to burst. Submissions over
+// the limit are rejected with status 429. By default there is no limit.
+//
+// Only submissions for known logs by known witnesses count towards either limit, and
+// only once the witness has authenticated, if it is configured to.
+func WithLogRateLimit(r rate.Limit, burst int) Option {
+	return func(s *Server) {
+		s.logLimits = newKeyedLimiter(r, burst)
+	}
 }
 
 // NewServer creates a new server.
-func NewServer(d Distributor) *Server {
-	return &Server{
-		d: d,
+func NewServer(d Distributor, opts ...Option) *Server {
+	s := &Server{
+		d:           d,
+		now:         time.Now,
+		maxBodySize: DefaultMaxBodySize,
+	}
+	for _, o := range opts {
+		o(s)
 	}
+	return s
+}
+
+// Timeouts bound how long an HTTP server spends on each connection, so that slow or idle
+// clients cannot tie up its resources.
+type Timeouts struct {
+	// ReadHeader is the maximum time to read the headers of a request.
+	ReadHeader time.Duration
+	// Read is the maximum time to read a request, including the body.
+	Read time.Duration
+	// Write is the maximum time from the end of reading the request headers until the
+	// response is written.
+	Write time.Duration
+	// Idle is the maximum time to wait for the next request on a keep-alive connection.
+	Idle time.Duration
+}
+
+// NewHTTPServer returns an HTTP server for the handler, which applies the timeouts given.
+// If the server is used for HTTPS, then clients are asked for certificates so that
+// witnesses can authenticate their submissions.
+func NewHTTPServer(h http.Handler, t Timeouts) *http.Server {
+	return &http.Server{
+		Handler:           h,
+		ReadHeaderTimeout: t.ReadHeader,
+		ReadTimeout:       t.Read,
+		WriteTimeout:      t.Write,
+		IdleTimeout:       t.Idle,
+		// Client certificates are matched against the fingerprints configured for each
+		// witness, so they are not verified against any CA.
+		TLSConfig: &tls.Config{ClientAuth: tls.RequestClientCert},
+	}
+}
+
+// allowSubmission checks that a checkpoint submission for the log by the witness is within
+// the configured rate limits. If not, a 429 response is written and false is returned.
+func (s *Server) allowSubmission(w http.ResponseWriter, logID, witID string) bool {
+	retryAfter, ok := s.reserveSubmission(logID, witID)
+	if ok {
+		return true
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	}
+	http.Error(w, fmt.Sprintf("too many submissions for log %q by witness %q", logID, witID), http.StatusTooManyRequests)
+	return false
+}
+
+// reserveSubmission takes tokens from the rate limits for a checkpoint submission for the
+// log by the witness. If any of the limits have been reached then no tokens are taken, and
+// false is returned along with the number of seconds to wait before retrying, which is zero
+// if retrying will never succeed.
+func (s *Server) reserveSubmission(logID, witID string) (int, bool) {
+	now := s.now()
+	var rs []*rate.Reservation
+	if s.witLimits != nil {
+		rs = append(rs, s.witLimits.reserve(witID, now))
+	}
+	if s.logLimits != nil {
+		rs = append(rs, s.logLimits.reserve(logID, now))
+	}
+	var wait time.Duration
+	ok := true
+	for _, r := range rs {
+		if !r.OK() {
+			// The burst is zero, so no submissions will ever be allowed.
+			ok = false
+			continue
+		}
+		wait = max(wait, r.DelayFrom(now))
+	}
+	if ok && wait == 0 {
+		return 0, true
+	}
+	// Return the tokens so that rejected submissions don't count towards the limits.
+	for _, r := range rs {
+		r.CancelAt(now)
+	}
+	if !ok {
+		return 0, false
+	}
+	return int((wait + time.Second - 1) / time.Second), false
+}
+
+// SetWitnessAuth atomically replaces the settings for authenticating submissions from
+// witnesses, keyed by witness ID. Submissions from witnesses without settings are not
+// authenticated, unless WithRequireClientAuth is set, in which case they are rejected.
+func (s *Server) SetWitnessAuth(a map[string]config.WitnessAuth) {
+	s.auth.Store(&a)
+}
+
+// authenticate checks that the request was made by the witness with the ID given, if
+// that witness is configured to be authenticated, or if all witnesses must be. If not,
+// an error response is written and false is returned.
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request, witID string) bool {
+	var auth config.WitnessAuth
+	if as := s.auth.Load(); as != nil {
+		auth = (*as)[witID]
+	}
+	if len(auth.ClientCertSHA256) == 0 && !s.requireClientAuth {
+		return true
+	}
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		http.Error(w, fmt.Sprintf("witness %q must present a client certificate", witID), http.StatusUnauthorized)
+		return false
+	}
+	fp := sha256.Sum256(r.TLS.PeerCertificates[0].Raw)
+	if !slices.Contains(auth.ClientCertSHA256, hex.EncodeToString(fp[:])) {
+		glog.Warningf("rejected submission for witness %q with client certificate %x", witID, fp)
+		http.Error(w, fmt.Sprintf("client certificate is not allowed for witness %q", witID), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// checkWitness checks that the witness submitting checkpoints is known to the distributor,
+// and that the request was made by that witness. If not, an error response is written and
+// false is returned. Along with checkLog, this is checked before the submission is rate
+// limited, so that requests which could never succeed don't use up the limits.
+func (s *Server) checkWitness(w http.ResponseWriter, r *http.Request, witID string) bool {
+	wits, err := s.d.GetWitnesses(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get witness list: %v", err), http.StatusInternalServerError)
+		return false
+	}
+	if !slices.ContainsFunc(wits, func(k string) bool {
+		name, _, _ := strings.Cut(k, "+")
+		return name == witID
+	}) {
+		http.Error(w, fmt.Sprintf("unknown witness %q", witID), http.StatusNotFound)
+		return false
+	}
+	return s.authenticate(w, r, witID)
+}
+
+// checkLog checks that the log that a checkpoint is submitted for is known to the distributor.
+// If not, an error response is written and false is returned.
+func (s *Server) checkLog(w http.ResponseWriter, r *http.Request, logID string) bool {
+	logs, err := s.d.GetLogs(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get log list: %v", err), http.StatusInternalServerError)
+		return false
+	}
+	if !slices.Contains(logs, logID) {
+		http.Error(w, fmt.Sprintf("unknown log %q", logID), http.StatusNotFound)
+		return false
+	}
+	return true
 }
 
 // update handles requests to update checkpoints.
@@ -65,9 +310,14 @@ func (s *Server) update(w http.ResponseWriter, r *http.Request) {
 	v := mux.Vars(r)
 	logID := v["logid"]
 	witID := v["witid"]
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("cannot read request body: %v", err.Error()), http.StatusBadRequest)
+	if !s.checkWitness(w, r, witID) || !s.checkLog(w, r, logID) {
+		return
+	}
+	if !s.allowSubmission(w, logID, witID) {
+		return
+	}
+	body, ok := s.readBody(w, r, s.maxBodySize)
+	if !ok {
 		return
 	}
 	if err := s.d.Distribute(r.Context(), logID, witID, body); err != nil {
@@ -77,6 +327,77 @@ func (s *Server) update(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// distributeBatch handles requests from a witness to update the checkpoints for many logs.
+// Each checkpoint is distributed separately, in its own storage transaction, so that one
+// being rejected doesn't affect the others. The response contains the result for each.
+func (s *Server) distributeBatch(w http.ResponseWriter, r *http.Request) {
+	witID := mux.Vars(r)["witid"]
+	if !s.checkWitness(w, r, witID) {
+		return
+	}
+	logs, err := s.d.GetLogs(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get log list: %v", err), http.StatusInternalServerError)
+		return
+	}
+	body, ok := s.readBody(w, r, s.maxBodySize*maxBatchSize)
+	if !ok {
+		return
+	}
+	var cps []api.BatchCheckpoint
+	if err := json.Unmarshal(body, &cps); err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse batch: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(cps) > maxBatchSize {
+		http.Error(w, fmt.Sprintf("batch has %d checkpoints, more than the limit of %d", len(cps), maxBatchSize), http.StatusBadRequest)
+		return
+	}
+	results := make([]api.BatchResult, 0, len(cps))
+	for _, cp := range cps {
+		res := api.BatchResult{LogID: cp.LogID, Status: http.StatusOK}
+		if int64(len(cp.Checkpoint)) > s.maxBodySize {
+			res.Status = http.StatusRequestEntityTooLarge
+			res.Error = fmt.Sprintf("checkpoint is larger than the limit of %d bytes", s.maxBodySize)
+		} else if !slices.Contains(logs, cp.LogID) {
+			res.Status = http.StatusNotFound
+			res.Error = fmt.Sprintf("unknown log %q", cp.LogID)
+		} else if retryAfter, ok := s.reserveSubmission(cp.LogID, witID); !ok {
+			res.Status = http.StatusTooManyRequests
+			res.Error = fmt.Sprintf("too many submissions for log %q by witness %q, retry after %ds", cp.LogID, witID, retryAfter)
+		} else if err := s.d.Distribute(r.Context(), cp.LogID, witID, []byte(cp.Checkpoint)); err != nil {
+			glog.Warningf("failed to update to new checkpoint in batch: %v", err)
+			res.Status = httpForCode(status.Code(err))
+			res.Error = "failed to update to new checkpoint"
+			if res.Status != http.StatusInternalServerError {
+				// Other errors are caused by the checkpoint, so explain what is wrong with it.
+				res.Error = status.Convert(err).Message()
+			}
+		}
+		results = append(results, res)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		glog.Errorf("json.Encode(): %v", err)
+	}
+}
+
+// readBody reads the body of a checkpoint submission, up to limit bytes.
+// If it cannot be read then an error response is written and false is returned.
+func (s *Server) readBody(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			http.Error(w, fmt.Sprintf("request body is larger than the limit of %d bytes", mbe.Limit), http.StatusRequestEntityTooLarge)
+			return nil, false
+		}
+		http.Error(w, fmt.Sprintf("cannot read request body: %v", err.Error()), http.StatusBadRequest)
+		return nil, false
+	}
+	return body, true
+}
+
 // getCheckpointN returns a checkpoint stored for a given log with the specified number of witnesses.
 func (s *Server) getCheckpointN(w http.ResponseWriter, r *http.Request) {
 	v := mux.Vars(r)
@@ -86,8 +407,73 @@ func (s *Server) getCheckpointN(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("failed to parse number of signatures: %v", err), http.StatusBadRequest)
 		return
 	}
+	maxAge, ok := maxAgeParam(w, r)
+	if !ok {
+		return
+	}
 	// Get the signed checkpoint from the witness.
-	chkpt, err := s.d.GetCheckpointN(r.Context(), logID, uint32(numSigs))
+	chkpt, err := s.d.GetCheckpointN(r.Context(), logID, uint32(numSigs), maxAge)
+	if err != nil {
+		glog.Warningf("failed to get checkpoint: %v", err)
+		http.Error(w, "failed to get checkpoint", httpForCode(status.Code(err)))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if _, err := w.Write(chkpt); err != nil {
+		glog.Errorf("w.Write(): %v", err)
+	}
+}
+
+// maxAgeParam returns the maximum cosignature age requested in the query, or zero if
+// none was. If the parameter is invalid then an error response is written and false
+// is returned.
+func maxAgeParam(w http.ResponseWriter, r *http.Request) (time.Duration, bool) {
+	ageStr := r.URL.Query().Get(api.HTTPMaxAgeParam)
+	if ageStr == "" {
+		return 0, true
+	}
+	secs, err := strconv.ParseUint(ageStr, 10, 32)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse max age: %v", err), http.StatusBadRequest)
+		return 0, false
+	}
+	if secs == 0 {
+		// A zero max age is how no limit is passed to the distributor, which is not what was asked for.
+		http.Error(w, "max age must be at least 1 second", http.StatusBadRequest)
+		return 0, false
+	}
+	return time.Duration(secs) * time.Second, true
+}
+
+// getCheckpointForPolicy returns a checkpoint stored for a given log that satisfies the named policy.
+func (s *Server) getCheckpointForPolicy(w http.ResponseWriter, r *http.Request) {
+	v := mux.Vars(r)
+	chkpt, err := s.d.GetCheckpointForPolicy(r.Context(), v["logid"], v["policy"])
+	if err != nil {
+		glog.Warningf("failed to get checkpoint: %v", err)
+		http.Error(w, "failed to get checkpoint", httpForCode(status.Code(err)))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if _, err := w.Write(chkpt); err != nil {
+		glog.Errorf("w.Write(): %v", err)
+	}
+}
+
+// getCheckpointForWitnesses returns a checkpoint stored for a given log that was cosigned by
+// the witnesses named in the query.
+func (s *Server) getCheckpointForWitnesses(w http.ResponseWriter, r *http.Request) {
+	logID := mux.Vars(r)["logid"]
+	q := r.URL.Query()
+	var k uint64
+	if kStr := q.Get(api.HTTPThresholdParam); kStr != "" {
+		var err error
+		if k, err = strconv.ParseUint(kStr, 10, 32); err != nil {
+			http.Error(w, fmt.Sprintf("failed to parse number of witnesses: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	chkpt, err := s.d.GetCheckpointForWitnesses(r.Context(), logID, q[api.HTTPWitnessParam], uint32(k))
 	if err != nil {
 		glog.Warningf("failed to get checkpoint: %v", err)
 		http.Error(w, "failed to get checkpoint", httpForCode(status.Code(err)))
@@ -104,9 +490,13 @@ func (s *Server) getCheckpointWitness(w http.ResponseWriter, r *http.Request) {
 	v := mux.Vars(r)
 	logID := v["logid"]
 	witID := v["witid"]
+	maxAge, ok := maxAgeParam(w, r)
+	if !ok {
+		return
+	}
 
 	// Get the signed checkpoint from the witness.
-	chkpt, err := s.d.GetCheckpointWitness(r.Context(), logID, witID)
+	chkpt, err := s.d.GetCheckpointWitness(r.Context(), logID, witID, maxAge)
 	if err != nil {
 		glog.Warningf("failed to get checkpoint: %v", err)
 		http.Error(w, "failed to get checkpoint", httpForCode(status.Code(err)))
@@ -118,6 +508,74 @@ func (s *Server) getCheckpointWitness(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// getCheckpointHistory returns the checkpoints accepted for a given log from a given witness.
+func (s *Server) getCheckpointHistory(w http.ResponseWriter, r *http.Request) {
+	v := mux.Vars(r)
+	since, ok := timeParam(w, r, api.HTTPSinceParam)
+	if !ok {
+		return
+	}
+	until, ok := timeParam(w, r, api.HTTPUntilParam)
+	if !ok {
+		return
+	}
+	cps, err := s.d.GetCheckpointHistory(r.Context(), v["logid"], v["witid"], since, until)
+	if err != nil {
+		glog.Warningf("failed to get checkpoint history: %v", err)
+		http.Error(w, "failed to get checkpoint history", httpForCode(status.Code(err)))
+		return
+	}
+	history := make([]string, 0, len(cps))
+	for _, cp := range cps {
+		history = append(history, string(cp))
+	}
+	cpList, err := json.Marshal(history)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to convert checkpoint history to JSON: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/json")
+	if _, err := w.Write(cpList); err != nil {
+		glog.Errorf("w.Write(): %v", err)
+	}
+}
+
+// timeParam parses the optional RFC 3339 time in the named query parameter, returning
+// the zero time if it is not present. If it is invalid then an error response is
+// written and false is returned.
+func timeParam(w http.ResponseWriter, r *http.Request, name string) (time.Time, bool) {
+	tStr := r.URL.Query().Get(name)
+	if tStr == "" {
+		return time.Time{}, true
+	}
+	t, err := time.Parse(time.RFC3339, tStr)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse %s: %v", name, err), http.StatusBadRequest)
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// getInconsistencies returns the evidence of inconsistency found for a given log.
+func (s *Server) getInconsistencies(w http.ResponseWriter, r *http.Request) {
+	logID := mux.Vars(r)["logid"]
+	incs, err := s.d.GetInconsistencies(r.Context(), logID)
+	if err != nil {
+		glog.Warningf("failed to get inconsistencies: %v", err)
+		http.Error(w, "failed to get inconsistencies", httpForCode(status.Code(err)))
+		return
+	}
+	incList, err := json.Marshal(incs)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to convert inconsistencies to JSON: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/json")
+	if _, err := w.Write(incList); err != nil {
+		glog.Errorf("w.Write(): %v", err)
+	}
+}
+
 // getLogs returns a list of all logs the distributor is aware of.
 func (s *Server) getLogs(w http.ResponseWriter, r *http.Request) {
 	logs, err := s.d.GetLogs(r.Context())
@@ -159,10 +617,24 @@ func (s *Server) RegisterHandlers(r *mux.Router) {
 	logStr := "{logid:[a-zA-Z0-9-]+}"
 	witStr := "{witid:[^ +]+}"
 	r.HandleFunc(fmt.Sprintf(api.HTTPGetCheckpointN, logStr, "{numsigs:\\d+}"), s.getCheckpointN).Methods("GET")
+	r.HandleFunc(fmt.Sprintf(api.HTTPGetCheckpointForPolicy, logStr, "{policy:[a-zA-Z0-9._-]+}"), s.getCheckpointForPolicy).Methods("GET")
+	r.HandleFunc(fmt.Sprintf(api.HTTPGetCheckpointForWitnesses, logStr), s.getCheckpointForWitnesses).Methods("GET")
 	r.HandleFunc(fmt.Sprintf(api.HTTPCheckpointByWitness, logStr, witStr), s.update).Methods("PUT")
 	r.HandleFunc(fmt.Sprintf(api.HTTPCheckpointByWitness, logStr, witStr), s.getCheckpointWitness).Methods("GET")
+	r.HandleFunc(fmt.Sprintf(api.HTTPGetCheckpointHistory, logStr, witStr), s.getCheckpointHistory).Methods("GET")
+	r.HandleFunc(fmt.Sprintf(api.HTTPGetInconsistencies, logStr), s.getInconsistencies).Methods("GET")
+	r.HandleFunc(fmt.Sprintf(api.HTTPDistributeBatch, witStr), s.distributeBatch).Methods("POST")
 	r.HandleFunc(api.HTTPGetLogs, s.getLogs).Methods("GET")
 	r.HandleFunc(api.HTTPGetWitnesses, s.getWitnesses).Methods("GET")
+
+	// Routes which identify logs by origin. Only add-checkpoint follows a published
+	// spec (https://c2sp.org/tlog-witness); the read routes are specific to the distributor.
+	originStr := "{origin:.+}"
+	r.HandleFunc(api.HTTPAddCheckpoint, s.addCheckpoint).Methods("POST")
+	r.HandleFunc(api.HTTPOriginLogs, s.getLogOrigins).Methods("GET")
+	// Origins may contain slashes, so the more specific route must be registered first.
+	r.HandleFunc(fmt.Sprintf(api.HTTPOriginCheckpointByWitness, originStr, witStr), s.getOriginCheckpointWitness).Methods("GET")
+	r.HandleFunc(fmt.Sprintf(api.HTTPOriginCheckpoint, originStr), s.getOriginCheckpoint).Methods("GET")
 }
 
 func httpForCode(c codes.Code) int {
@@ -171,8 +643,14 @@ func httpForCode(c codes.Code) int {
 		return http.StatusConflict
 	case codes.NotFound:
 		return http.StatusNotFound
-	case codes.FailedPrecondition, codes.InvalidArgument:
+	case codes.FailedPrecondition:
+		return http.StatusUnprocessableEntity
+	case codes.InvalidArgument:
 		return http.StatusBadRequest
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.ResourceExhausted:
+		return http.StatusRequestEntityTooLarge
 	default:
 		return http.StatusInternalServerError
 	}
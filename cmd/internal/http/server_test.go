@@ -17,16 +17,24 @@ package http_test
 //go:generate mockgen -write_package_comment=false -self_package github.com/transparency-dev/distributor/cmd/internal/http_test -package http_test -destination mock_distributor_test.go  github.com/transparency-dev/distributor/cmd/internal/http Distributor
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
+	gohttp "net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/google/go-cmp/cmp"
+	"github.com/transparency-dev/distributor/api"
 	"github.com/transparency-dev/distributor/cmd/internal/http"
+	"github.com/transparency-dev/formats/log"
 	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	_ "github.com/mattn/go-sqlite3" // Load drivers for sqlite3
 )
@@ -39,6 +47,13 @@ func createTestEnv(d http.Distributor) (*httptest.Server, func()) {
 	return ts, ts.Close
 }
 
+// expectSubmitters sets up the distributor to know about the logs and witnesses that
+// checkpoints are submitted for in tests.
+func expectSubmitters(d *MockDistributor) {
+	d.EXPECT().GetLogs(gomock.Any()).Return([]string{"BarLog", "BazLog", "FooLog"}, nil).AnyTimes()
+	d.EXPECT().GetWitnesses(gomock.Any()).Return([]string{"Aardvark+12345678+AAAA", "Badger+87654321+BBBB"}, nil).AnyTimes()
+}
+
 func TestGetByWitness(t *testing.T) {
 	testCases := []struct {
 		desc           string
@@ -92,7 +107,7 @@ func TestGetByWitness(t *testing.T) {
 			s, close := createTestEnv(d)
 			defer close()
 
-			d.EXPECT().GetCheckpointWitness(gomock.Any(), gomock.Eq(tC.logid), gomock.Eq(tC.witid)).Return(tC.cpReturn, nil).AnyTimes()
+			d.EXPECT().GetCheckpointWitness(gomock.Any(), gomock.Eq(tC.logid), gomock.Eq(tC.witid), gomock.Any()).Return(tC.cpReturn, nil).AnyTimes()
 
 			c := s.Client()
 			resp, err := c.Get(fmt.Sprintf("%s/distributor/v0/logs/%s/byWitness/%s/checkpoint", s.URL, url.PathEscape(tC.logid), url.PathEscape(tC.witid)))
@@ -145,7 +160,7 @@ func TestGetCheckpointN(t *testing.T) {
 			s, close := createTestEnv(d)
 			defer close()
 
-			d.EXPECT().GetCheckpointN(gomock.Any(), gomock.Eq(tC.logid), gomock.Eq(uint32(tC.n))).Return(tC.wantBody, nil).AnyTimes()
+			d.EXPECT().GetCheckpointN(gomock.Any(), gomock.Eq(tC.logid), gomock.Eq(uint32(tC.n)), gomock.Any()).Return(tC.wantBody, nil).AnyTimes()
 
 			c := s.Client()
 			resp, err := c.Get(fmt.Sprintf("%s/distributor/v0/logs/%s/checkpoint.%d", s.URL, url.PathEscape(tC.logid), tC.n))
@@ -165,3 +180,637 @@ func TestGetCheckpointN(t *testing.T) {
 		})
 	}
 }
+
+func TestGetCheckpointHistory(t *testing.T) {
+	since := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		desc            string
+		query           string
+		wantCall        bool
+		wantSince       time.Time
+		wantUntil       time.Time
+		cpsReturn       [][]byte
+		errReturn       error
+		wantCheckpoints []string
+		wantStatusCode  int
+	}{
+		{
+			desc:            "happy path",
+			query:           "?since=2024-01-02T00:00:00Z&until=2024-01-03T00:00:00Z",
+			wantCall:        true,
+			wantSince:       since,
+			wantUntil:       until,
+			cpsReturn:       [][]byte{[]byte("one"), []byte("two")},
+			wantCheckpoints: []string{"one", "two"},
+			wantStatusCode:  200,
+		},
+		{
+			desc:            "unbounded",
+			wantCall:        true,
+			wantCheckpoints: []string{},
+			wantStatusCode:  200,
+		},
+		{
+			desc:           "bad time",
+			query:          "?since=yesterday",
+			wantStatusCode: 400,
+		},
+		{
+			desc:           "unknown log",
+			wantCall:       true,
+			errReturn:      status.Error(codes.InvalidArgument, "unknown log"),
+			wantStatusCode: 400,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			d := NewMockDistributor(ctrl)
+			s, close := createTestEnv(d)
+			defer close()
+
+			if tC.wantCall {
+				d.EXPECT().GetCheckpointHistory(gomock.Any(), "FooLog", "Aardvark", timeEq(tC.wantSince), timeEq(tC.wantUntil)).Return(tC.cpsReturn, tC.errReturn)
+			}
+
+			resp, err := s.Client().Get(s.URL + fmt.Sprintf(api.HTTPGetCheckpointHistory, "FooLog", "Aardvark") + tC.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tC.wantStatusCode {
+				t.Errorf("expected %d, got %d", tC.wantStatusCode, resp.StatusCode)
+			}
+			if tC.wantStatusCode != 200 {
+				return
+			}
+			var got []string
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if diff := cmp.Diff(tC.wantCheckpoints, got); diff != "" {
+				t.Errorf("unexpected checkpoints (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// timeEq matches a time.Time representing the same instant as want.
+func timeEq(want time.Time) gomock.Matcher {
+	return timeMatcher{want: want}
+}
+
+type timeMatcher struct {
+	want time.Time
+}
+
+func (m timeMatcher) Matches(x any) bool {
+	t, ok := x.(time.Time)
+	return ok && t.Equal(m.want)
+}
+
+func (m timeMatcher) String() string {
+	return fmt.Sprintf("is equal to %v", m.want)
+}
+
+func TestGetInconsistencies(t *testing.T) {
+	incs := []api.Inconsistency{
+		{
+			TreeSize:    16,
+			Checkpoints: [2]string{"Log Checkpoint v0\n16\nAAAA\n", "Log Checkpoint v0\n16\nBBBB\n"},
+			Discovered:  time.Unix(1700000000, 0).UTC(),
+		},
+	}
+	testCases := []struct {
+		desc           string
+		logid          string
+		incsReturn     []api.Inconsistency
+		errReturn      error
+		wantIncs       []api.Inconsistency
+		wantStatusCode int
+	}{
+		{
+			desc:           "happy path",
+			logid:          "thisisalog",
+			incsReturn:     incs,
+			wantIncs:       incs,
+			wantStatusCode: 200,
+		},
+		{
+			desc:           "no inconsistencies",
+			logid:          "thisisalog",
+			incsReturn:     []api.Inconsistency{},
+			wantIncs:       []api.Inconsistency{},
+			wantStatusCode: 200,
+		},
+		{
+			desc:           "unknown log",
+			logid:          "notalog",
+			errReturn:      status.Error(codes.InvalidArgument, "unknown log"),
+			wantStatusCode: 400,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			d := NewMockDistributor(ctrl)
+			s, close := createTestEnv(d)
+			defer close()
+
+			d.EXPECT().GetInconsistencies(gomock.Any(), gomock.Eq(tC.logid)).Return(tC.incsReturn, tC.errReturn)
+
+			c := s.Client()
+			resp, err := c.Get(s.URL + fmt.Sprintf(api.HTTPGetInconsistencies, url.PathEscape(tC.logid)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tC.wantStatusCode {
+				t.Errorf("expected %d, got %d", tC.wantStatusCode, resp.StatusCode)
+			}
+			if tC.wantStatusCode != 200 {
+				return
+			}
+			var got []api.Inconsistency
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if diff := cmp.Diff(tC.wantIncs, got); diff != "" {
+				t.Errorf("unexpected inconsistencies (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		logid          string
+		witid          string
+		wantDistribute bool
+		distributeErr  error
+		wantStatusCode int
+	}{
+		{
+			desc:           "accepted",
+			logid:          "FooLog",
+			witid:          "Aardvark",
+			wantDistribute: true,
+			wantStatusCode: 200,
+		},
+		{
+			desc:           "unknown log",
+			logid:          "QuxLog",
+			witid:          "Aardvark",
+			wantStatusCode: 404,
+		},
+		{
+			desc:           "unknown witness",
+			logid:          "FooLog",
+			witid:          "Chameleon",
+			wantStatusCode: 404,
+		},
+		{
+			desc:           "bad signature",
+			logid:          "FooLog",
+			witid:          "Aardvark",
+			wantDistribute: true,
+			distributeErr:  status.Error(codes.InvalidArgument, "bad sig"),
+			wantStatusCode: 400,
+		},
+		{
+			desc:           "stale",
+			logid:          "FooLog",
+			witid:          "Aardvark",
+			wantDistribute: true,
+			distributeErr:  status.Error(codes.AlreadyExists, "stale"),
+			wantStatusCode: 409,
+		},
+		{
+			desc:           "inconsistent",
+			logid:          "FooLog",
+			witid:          "Aardvark",
+			wantDistribute: true,
+			distributeErr:  status.Error(codes.FailedPrecondition, "inconsistent"),
+			wantStatusCode: 422,
+		},
+		{
+			desc:           "internal error",
+			logid:          "FooLog",
+			witid:          "Aardvark",
+			wantDistribute: true,
+			distributeErr:  status.Error(codes.Internal, "database is down"),
+			wantStatusCode: 500,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			d := NewMockDistributor(ctrl)
+			expectSubmitters(d)
+			s, close := createTestEnv(d)
+			defer close()
+
+			if tC.wantDistribute {
+				d.EXPECT().Distribute(gomock.Any(), tC.logid, tC.witid, []byte("checkpoint")).Return(tC.distributeErr)
+			}
+
+			req, err := gohttp.NewRequest(gohttp.MethodPut, s.URL+fmt.Sprintf(api.HTTPCheckpointByWitness, tC.logid, tC.witid), strings.NewReader("checkpoint"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := s.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tC.wantStatusCode {
+				t.Errorf("expected %d, got %d", tC.wantStatusCode, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestDistributeBatch(t *testing.T) {
+	type distributeCall struct {
+		logid string
+		err   error
+	}
+	testCases := []struct {
+		desc           string
+		body           string
+		calls          []distributeCall
+		wantResults    []api.BatchResult
+		wantStatusCode int
+	}{
+		{
+			desc: "all accepted",
+			body: `[{"logID": "FooLog", "checkpoint": "foo"}, {"logID": "BarLog", "checkpoint": "bar"}]`,
+			calls: []distributeCall{
+				{logid: "FooLog"},
+				{logid: "BarLog"},
+			},
+			wantResults: []api.BatchResult{
+				{LogID: "FooLog", Status: 200},
+				{LogID: "BarLog", Status: 200},
+			},
+			wantStatusCode: 200,
+		},
+		{
+			desc: "some rejected",
+			body: `[{"logID": "FooLog", "checkpoint": "foo"}, {"logID": "BarLog", "checkpoint": "bar"}, {"logID": "BazLog", "checkpoint": "baz"}]`,
+			calls: []distributeCall{
+				{logid: "FooLog", err: status.Error(codes.AlreadyExists, "stale")},
+				{logid: "BarLog"},
+				{logid: "BazLog", err: status.Error(codes.Internal, "database is down")},
+			},
+			wantResults: []api.BatchResult{
+				{LogID: "FooLog", Status: 409, Error: "stale"},
+				{LogID: "BarLog", Status: 200},
+				{LogID: "BazLog", Status: 500, Error: "failed to update to new checkpoint"},
+			},
+			wantStatusCode: 200,
+		},
+		{
+			desc: "inconsistent",
+			body: `[{"logID": "FooLog", "checkpoint": "foo"}]`,
+			calls: []distributeCall{
+				{logid: "FooLog", err: status.Error(codes.FailedPrecondition, "inconsistent")},
+			},
+			wantResults: []api.BatchResult{
+				{LogID: "FooLog", Status: 422, Error: "inconsistent"},
+			},
+			wantStatusCode: 200,
+		},
+		{
+			desc: "unknown log",
+			body: `[{"logID": "FooLog", "checkpoint": "foo"}, {"logID": "QuuxLog", "checkpoint": "quux"}]`,
+			calls: []distributeCall{
+				{logid: "FooLog"},
+			},
+			wantResults: []api.BatchResult{
+				{LogID: "FooLog", Status: 200},
+				{LogID: "QuuxLog", Status: 404, Error: `unknown log "QuuxLog"`},
+			},
+			wantStatusCode: 200,
+		},
+		{
+			desc:           "empty batch",
+			body:           `[]`,
+			wantResults:    []api.BatchResult{},
+			wantStatusCode: 200,
+		},
+		{
+			desc:           "invalid batch",
+			body:           `{"logID": "FooLog"}`,
+			wantStatusCode: 400,
+		},
+		{
+			desc:           "too many checkpoints",
+			body:           "[" + strings.Repeat(`{"logID": "FooLog", "checkpoint": "foo"},`, 100) + `{"logID": "FooLog", "checkpoint": "foo"}]`,
+			wantStatusCode: 400,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			d := NewMockDistributor(ctrl)
+			expectSubmitters(d)
+			s, close := createTestEnv(d)
+			defer close()
+
+			var calls []*gomock.Call
+			for _, c := range tC.calls {
+				calls = append(calls, d.EXPECT().Distribute(gomock.Any(), c.logid, "Aardvark", gomock.Any()).Return(c.err))
+			}
+			gomock.InOrder(calls...)
+
+			resp, err := s.Client().Post(s.URL+fmt.Sprintf(api.HTTPDistributeBatch, "Aardvark"), "application/json", strings.NewReader(tC.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tC.wantStatusCode {
+				t.Errorf("expected %d, got %d", tC.wantStatusCode, resp.StatusCode)
+			}
+			if tC.wantStatusCode != 200 {
+				return
+			}
+			var got []api.BatchResult
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if diff := cmp.Diff(tC.wantResults, got); diff != "" {
+				t.Errorf("unexpected results (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGetCheckpointForPolicy(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		logid          string
+		policy         string
+		cpReturn       []byte
+		errReturn      error
+		wantBody       []byte
+		wantStatusCode int
+	}{
+		{
+			desc:           "happy path",
+			logid:          "thisisalog",
+			policy:         "strict-2",
+			cpReturn:       []byte("checkpoint"),
+			wantBody:       []byte("checkpoint"),
+			wantStatusCode: 200,
+		},
+		{
+			desc:           "policy not satisfied",
+			logid:          "thisisalog",
+			policy:         "strict",
+			errReturn:      status.Error(codes.NotFound, "not satisfied"),
+			wantBody:       []byte("failed to get checkpoint\n"),
+			wantStatusCode: 404,
+		},
+		{
+			desc:           "unknown policy",
+			logid:          "thisisalog",
+			policy:         "nope",
+			errReturn:      status.Error(codes.InvalidArgument, "unknown policy"),
+			wantBody:       []byte("failed to get checkpoint\n"),
+			wantStatusCode: 400,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			d := NewMockDistributor(ctrl)
+			s, close := createTestEnv(d)
+			defer close()
+
+			d.EXPECT().GetCheckpointForPolicy(gomock.Any(), gomock.Eq(tC.logid), gomock.Eq(tC.policy)).Return(tC.cpReturn, tC.errReturn)
+
+			c := s.Client()
+			resp, err := c.Get(s.URL + fmt.Sprintf(api.HTTPGetCheckpointForPolicy, url.PathEscape(tC.logid), url.PathEscape(tC.policy)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tC.wantStatusCode {
+				t.Errorf("expected %d, got %d", tC.wantStatusCode, resp.StatusCode)
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Error(err)
+			}
+			if !cmp.Equal(body, tC.wantBody) {
+				t.Errorf("expected %q, got %q", string(tC.wantBody), string(body))
+			}
+		})
+	}
+}
+
+func TestGetCheckpointForWitnesses(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		query          string
+		wantWitIDs     []string
+		wantK          uint32
+		wantStatusCode int
+	}{
+		{
+			desc:           "all witnesses",
+			query:          "witness=Aardvark&witness=happy.tricky%2Fwitness",
+			wantWitIDs:     []string{"Aardvark", "happy.tricky/witness"},
+			wantStatusCode: 200,
+		},
+		{
+			desc:           "k of n",
+			query:          "witness=Aardvark&witness=Badger&witness=Chameleon&k=2",
+			wantWitIDs:     []string{"Aardvark", "Badger", "Chameleon"},
+			wantK:          2,
+			wantStatusCode: 200,
+		},
+		{
+			desc:           "invalid k",
+			query:          "witness=Aardvark&k=-1",
+			wantStatusCode: 400,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			d := NewMockDistributor(ctrl)
+			s, close := createTestEnv(d)
+			defer close()
+
+			if tC.wantStatusCode == 200 {
+				d.EXPECT().GetCheckpointForWitnesses(gomock.Any(), gomock.Eq("thisisalog"), gomock.Eq(tC.wantWitIDs), gomock.Eq(tC.wantK)).Return([]byte("checkpoint"), nil)
+			}
+
+			c := s.Client()
+			resp, err := c.Get(s.URL + fmt.Sprintf(api.HTTPGetCheckpointForWitnesses, "thisisalog") + "?" + tC.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tC.wantStatusCode {
+				t.Errorf("expected %d, got %d", tC.wantStatusCode, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestGetLogOrigins(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	d := NewMockDistributor(ctrl)
+	s, close := createTestEnv(d)
+	defer close()
+
+	d.EXPECT().GetLogOrigins(gomock.Any()).Return([]string{"example.com/log", "go.sum database tree"}, nil)
+
+	resp, err := s.Client().Get(s.URL + api.HTTPOriginLogs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := resp.StatusCode, 200; got != want {
+		t.Errorf("expected %d, got %d", want, got)
+	}
+	if got, want := resp.Header.Get("Content-Type"), "text/plain; charset=utf-8"; got != want {
+		t.Errorf("expected content type %q, got %q", want, got)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(body), "example.com/log\ngo.sum database tree\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestGetOriginCheckpoint(t *testing.T) {
+	origins := []string{"example.com/log", "go.sum database tree"}
+	testCases := []struct {
+		desc           string
+		path           string
+		setup          func(d *MockDistributor)
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			desc: "freshest checkpoint for origin with slash",
+			path: fmt.Sprintf(api.HTTPOriginCheckpoint, url.PathEscape("example.com/log")),
+			setup: func(d *MockDistributor) {
+				d.EXPECT().GetCheckpointN(gomock.Any(), log.ID("example.com/log"), uint32(1), time.Duration(0)).Return([]byte("checkpoint"), nil)
+			},
+			wantStatusCode: 200,
+			wantBody:       "checkpoint",
+		},
+		{
+			desc: "origin with spaces",
+			path: fmt.Sprintf(api.HTTPOriginCheckpoint, url.PathEscape("go.sum database tree")),
+			setup: func(d *MockDistributor) {
+				d.EXPECT().GetCheckpointN(gomock.Any(), log.ID("go.sum database tree"), uint32(1), time.Duration(0)).Return([]byte("checkpoint"), nil)
+			},
+			wantStatusCode: 200,
+			wantBody:       "checkpoint",
+		},
+		{
+			desc: "minimum cosignatures",
+			path: fmt.Sprintf(api.HTTPOriginCheckpoint, url.PathEscape("example.com/log")) + "?" + api.HTTPCosignaturesParam + "=3",
+			setup: func(d *MockDistributor) {
+				d.EXPECT().GetCheckpointN(gomock.Any(), log.ID("example.com/log"), uint32(3), time.Duration(0)).Return(nil, status.Error(codes.NotFound, "none"))
+			},
+			wantStatusCode: 404,
+		},
+		{
+			desc: "max age",
+			path: fmt.Sprintf(api.HTTPOriginCheckpoint, url.PathEscape("example.com/log")) + "?" + api.HTTPMaxAgeParam + "=3600",
+			setup: func(d *MockDistributor) {
+				d.EXPECT().GetCheckpointN(gomock.Any(), log.ID("example.com/log"), uint32(1), time.Hour).Return([]byte("fresh"), nil)
+			},
+			wantStatusCode: 200,
+			wantBody:       "fresh",
+		},
+		{
+			desc:           "invalid max age",
+			path:           fmt.Sprintf(api.HTTPOriginCheckpoint, url.PathEscape("example.com/log")) + "?" + api.HTTPMaxAgeParam + "=-1",
+			wantStatusCode: 400,
+		},
+		{
+			desc:           "zero max age",
+			path:           fmt.Sprintf(api.HTTPOriginCheckpoint, url.PathEscape("example.com/log")) + "?" + api.HTTPMaxAgeParam + "=0",
+			wantStatusCode: 400,
+		},
+		{
+			desc:           "invalid cosignatures",
+			path:           fmt.Sprintf(api.HTTPOriginCheckpoint, url.PathEscape("example.com/log")) + "?" + api.HTTPCosignaturesParam + "=many",
+			wantStatusCode: 400,
+		},
+		{
+			desc:           "unknown origin",
+			path:           fmt.Sprintf(api.HTTPOriginCheckpoint, url.PathEscape("example.com/other")),
+			wantStatusCode: 404,
+		},
+		{
+			desc: "by witness",
+			path: fmt.Sprintf(api.HTTPOriginCheckpointByWitness, url.PathEscape("example.com/log"), "Aardvark"),
+			setup: func(d *MockDistributor) {
+				d.EXPECT().GetCheckpointWitness(gomock.Any(), log.ID("example.com/log"), "Aardvark", time.Duration(0)).Return([]byte("witnessed"), nil)
+			},
+			wantStatusCode: 200,
+			wantBody:       "witnessed",
+		},
+		{
+			desc:           "by witness for unknown origin",
+			path:           fmt.Sprintf(api.HTTPOriginCheckpointByWitness, url.PathEscape("example.com/other"), "Aardvark"),
+			wantStatusCode: 404,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			d := NewMockDistributor(ctrl)
+			s, close := createTestEnv(d)
+			defer close()
+
+			d.EXPECT().GetLogOrigins(gomock.Any()).Return(origins, nil).AnyTimes()
+			if tC.setup != nil {
+				tC.setup(d)
+			}
+
+			resp, err := s.Client().Get(s.URL + tC.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tC.wantStatusCode {
+				t.Errorf("expected %d, got %d", tC.wantStatusCode, resp.StatusCode)
+			}
+			if tC.wantStatusCode != 200 {
+				return
+			}
+			if got, want := resp.Header.Get("Content-Type"), "text/plain; charset=utf-8"; got != want {
+				t.Errorf("expected content type %q, got %q", want, got)
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(body); got != tC.wantBody {
+				t.Errorf("expected %q, got %q", tC.wantBody, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,344 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package memory provides an in-memory implementation of the distributor storage.
+// All state is lost when the process exits, so this is only suitable for tests
+// and ephemeral deployments.
+package memory
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/transparency-dev/distributor/cmd/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// New returns a new, empty, Storage.
+func New() *Storage {
+	return &Storage{
+		byWitness: make(map[witnessKey]historyRow),
+		merged:    make(map[mergedKey]row),
+		history:   make(map[witnessKey][]historyRow),
+		incs:      make(map[string][]storage.Inconsistency),
+	}
+}
+
+// Storage is an in-memory implementation of storage.Storage.
+// Read transactions may run concurrently, while read-write transactions
+// have exclusive access to the state.
+type Storage struct {
+	mu sync.RWMutex
+	// byWitness mirrors the checkpoints_by_witness table, with the timestamp
+	// being that of the witness signature.
+	byWitness map[witnessKey]historyRow
+	// merged mirrors the merged_checkpoints table.
+	merged map[mergedKey]row
+	// history mirrors the checkpoint_history table. The entries for each key
+	// are kept ordered by timestamp, then tree size.
+	history map[witnessKey][]historyRow
+	// incs mirrors the inconsistencies table, keyed by log ID. The entries for
+	// each log are kept ordered by tree size, then hashes.
+	incs map[string][]storage.Inconsistency
+}
+
+type witnessKey struct {
+	logID, witID string
+}
+
+type mergedKey struct {
+	logID    string
+	sigCount uint32
+}
+
+type row struct {
+	treeSize uint64
+	chkpt    []byte
+}
+
+type historyRow struct {
+	row
+	timestamp int64
+}
+
+// ReadTransaction runs f within a read-only transaction.
+func (s *Storage) ReadTransaction(ctx context.Context, f func(context.Context, storage.ReadTx) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return f(ctx, &tx{s: s})
+}
+
+// ReadWriteTransaction runs f within a transaction that can modify state.
+// Any changes made by f are reverted if it returns an error.
+func (s *Storage) ReadWriteTransaction(ctx context.Context, f func(context.Context, storage.Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := &tx{s: s}
+	if err := f(ctx, t); err != nil {
+		t.rollback()
+		return err
+	}
+	return nil
+}
+
+// tx operates directly on the state of the Storage, which the caller must
+// have locked. Writes record how to undo them so that they can be rolled back.
+type tx struct {
+	s    *Storage
+	undo []func()
+}
+
+func (t *tx) rollback() {
+	for i := len(t.undo) - 1; i >= 0; i-- {
+		t.undo[i]()
+	}
+	t.undo = nil
+}
+
+// witnessCheckpoint converts a row of byWitness into a storage.WitnessCheckpoint.
+func witnessCheckpoint(witID string, r historyRow) storage.WitnessCheckpoint {
+	wcp := storage.WitnessCheckpoint{WitID: witID, TreeSize: r.treeSize, Checkpoint: bytes.Clone(r.chkpt)}
+	if r.timestamp != 0 {
+		wcp.Timestamp = time.Unix(r.timestamp, 0)
+	}
+	return wcp
+}
+
+func (t *tx) GetWitnessCheckpoint(ctx context.Context, logID, witID string) (storage.WitnessCheckpoint, error) {
+	r, ok := t.s.byWitness[witnessKey{logID: logID, witID: witID}]
+	if !ok {
+		return storage.WitnessCheckpoint{}, status.Errorf(codes.NotFound, "no checkpoint for log %q from witness %q", logID, witID)
+	}
+	return witnessCheckpoint(witID, r), nil
+}
+
+func (t *tx) GetCheckpointsAtSize(ctx context.Context, logID string, treeSize uint64) ([]storage.WitnessCheckpoint, error) {
+	var r []storage.WitnessCheckpoint
+	for k, v := range t.s.byWitness {
+		if k.logID == logID && v.treeSize == treeSize {
+			r = append(r, witnessCheckpoint(k.witID, v))
+		}
+	}
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].WitID < r[j].WitID
+	})
+	return r, nil
+}
+
+func (t *tx) GetWitnessCheckpoints(ctx context.Context, logID string) ([]storage.WitnessCheckpoint, error) {
+	var r []storage.WitnessCheckpoint
+	for k, v := range t.s.byWitness {
+		if k.logID == logID {
+			r = append(r, witnessCheckpoint(k.witID, v))
+		}
+	}
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].TreeSize != r[j].TreeSize {
+			return r[i].TreeSize > r[j].TreeSize
+		}
+		return r[i].WitID < r[j].WitID
+	})
+	return r, nil
+}
+
+func (t *tx) GetMergedCheckpoint(ctx context.Context, logID string, sigCount uint32) (uint64, []byte, error) {
+	r, ok := t.s.merged[mergedKey{logID: logID, sigCount: sigCount}]
+	if !ok {
+		return 0, nil, status.Errorf(codes.NotFound, "no checkpoint with %d signatures found", sigCount)
+	}
+	return r.treeSize, bytes.Clone(r.chkpt), nil
+}
+
+func (t *tx) GetLatestMergedCheckpoint(ctx context.Context, logID string, minSigCount uint32) ([]byte, error) {
+	var best *row
+	var bestCount uint32
+	for k, v := range t.s.merged {
+		if k.logID != logID || k.sigCount < minSigCount {
+			continue
+		}
+		if best == nil || v.treeSize > best.treeSize || (v.treeSize == best.treeSize && k.sigCount > bestCount) {
+			v := v
+			best, bestCount = &v, k.sigCount
+		}
+	}
+	if best == nil {
+		return nil, status.Errorf(codes.NotFound, "no checkpoint with at least %d signatures found", minSigCount)
+	}
+	return bytes.Clone(best.chkpt), nil
+}
+
+func (t *tx) GetMergedCheckpoints(ctx context.Context, logID string) ([]storage.MergedCheckpoint, error) {
+	var r []storage.MergedCheckpoint
+	for k, v := range t.s.merged {
+		if k.logID == logID {
+			r = append(r, storage.MergedCheckpoint{SigCount: k.sigCount, TreeSize: v.treeSize, Checkpoint: bytes.Clone(v.chkpt)})
+		}
+	}
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].SigCount < r[j].SigCount
+	})
+	return r, nil
+}
+
+func (t *tx) PutWitnessCheckpoint(ctx context.Context, logID, witID string, treeSize uint64, timestamp time.Time, chkpt []byte) error {
+	put(t, t.s.byWitness, witnessKey{logID: logID, witID: witID}, historyRow{row: row{treeSize: treeSize, chkpt: bytes.Clone(chkpt)}, timestamp: timestamp.Unix()})
+	return nil
+}
+
+func (t *tx) PutMergedCheckpoint(ctx context.Context, logID string, sigCount uint32, treeSize uint64, chkpt []byte) error {
+	put(t, t.s.merged, mergedKey{logID: logID, sigCount: sigCount}, row{treeSize: treeSize, chkpt: bytes.Clone(chkpt)})
+	return nil
+}
+
+func (t *tx) DeleteMergedCheckpoint(ctx context.Context, logID string, sigCount uint32) error {
+	del(t, t.s.merged, mergedKey{logID: logID, sigCount: sigCount})
+	return nil
+}
+
+func (t *tx) GetWitnessCheckpointHistory(ctx context.Context, logID, witID string, since, until time.Time) ([]storage.HistoricCheckpoint, error) {
+	var r []storage.HistoricCheckpoint
+	for _, h := range t.s.history[witnessKey{logID: logID, witID: witID}] {
+		if h.timestamp >= since.Unix() && h.timestamp < until.Unix() {
+			r = append(r, storage.HistoricCheckpoint{
+				TreeSize:   h.treeSize,
+				Timestamp:  time.Unix(h.timestamp, 0),
+				Checkpoint: bytes.Clone(h.chkpt),
+			})
+		}
+	}
+	return r, nil
+}
+
+func (t *tx) AddWitnessCheckpointHistory(ctx context.Context, logID, witID string, treeSize uint64, timestamp time.Time, chkpt []byte) error {
+	k := witnessKey{logID: logID, witID: witID}
+	n := historyRow{row: row{treeSize: treeSize, chkpt: bytes.Clone(chkpt)}, timestamp: timestamp.Unix()}
+	// Always build a new slice so that the old one remains intact for rollback.
+	old := t.s.history[k]
+	hs := make([]historyRow, 0, len(old)+1)
+	for _, h := range old {
+		if h.timestamp != n.timestamp || h.treeSize != n.treeSize {
+			hs = append(hs, h)
+		}
+	}
+	hs = append(hs, n)
+	sort.SliceStable(hs, func(i, j int) bool {
+		if hs[i].timestamp != hs[j].timestamp {
+			return hs[i].timestamp < hs[j].timestamp
+		}
+		return hs[i].treeSize < hs[j].treeSize
+	})
+	put(t, t.s.history, k, hs)
+	return nil
+}
+
+func (t *tx) PruneWitnessCheckpointHistory(ctx context.Context, logID, witID string, before time.Time) error {
+	k := witnessKey{logID: logID, witID: witID}
+	old := t.s.history[k]
+	var hs []historyRow
+	for _, h := range old {
+		if h.timestamp >= before.Unix() {
+			hs = append(hs, h)
+		}
+	}
+	if len(hs) != len(old) {
+		put(t, t.s.history, k, hs)
+	}
+	return nil
+}
+
+func (t *tx) PruneCheckpointHistory(ctx context.Context, before time.Time) error {
+	for k := range t.s.history {
+		if err := t.PruneWitnessCheckpointHistory(ctx, k.logID, k.witID, before); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *tx) GetInconsistencies(ctx context.Context, logID string) ([]storage.Inconsistency, error) {
+	var r []storage.Inconsistency
+	for _, inc := range t.s.incs[logID] {
+		r = append(r, cloneInconsistency(inc))
+	}
+	return r, nil
+}
+
+func (t *tx) AddInconsistency(ctx context.Context, logID string, inc storage.Inconsistency, limit int) (bool, error) {
+	old := t.s.incs[logID]
+	if len(old) >= limit {
+		return false, nil
+	}
+	for _, o := range old {
+		if o.TreeSize == inc.TreeSize && bytes.Equal(o.HashA, inc.HashA) && bytes.Equal(o.HashB, inc.HashB) {
+			return false, nil
+		}
+	}
+	// Always build a new slice so that the old one remains intact for rollback.
+	incs := append(append(make([]storage.Inconsistency, 0, len(old)+1), old...), cloneInconsistency(inc))
+	sort.SliceStable(incs, func(i, j int) bool {
+		if incs[i].TreeSize != incs[j].TreeSize {
+			return incs[i].TreeSize < incs[j].TreeSize
+		}
+		if c := bytes.Compare(incs[i].HashA, incs[j].HashA); c != 0 {
+			return c < 0
+		}
+		return bytes.Compare(incs[i].HashB, incs[j].HashB) < 0
+	})
+	put(t, t.s.incs, logID, incs)
+	return true, nil
+}
+
+func cloneInconsistency(inc storage.Inconsistency) storage.Inconsistency {
+	inc.HashA = bytes.Clone(inc.HashA)
+	inc.HashB = bytes.Clone(inc.HashB)
+	inc.CheckpointA = bytes.Clone(inc.CheckpointA)
+	inc.CheckpointB = bytes.Clone(inc.CheckpointB)
+	if inc.Proof != nil {
+		proof := make([][]byte, len(inc.Proof))
+		for i, h := range inc.Proof {
+			proof[i] = bytes.Clone(h)
+		}
+		inc.Proof = proof
+	}
+	return inc
+}
+
+// put sets m[k] = v, recording in the transaction how to revert the change.
+func put[K comparable, V any](t *tx, m map[K]V, k K, v V) {
+	old, existed := m[k]
+	t.undo = append(t.undo, func() {
+		if existed {
+			m[k] = old
+		} else {
+			delete(m, k)
+		}
+	})
+	m[k] = v
+}
+
+// del removes m[k], recording in the transaction how to revert the change.
+func del[K comparable, V any](t *tx, m map[K]V, k K) {
+	old, existed := m[k]
+	if !existed {
+		return
+	}
+	t.undo = append(t.undo, func() {
+		m[k] = old
+	})
+	delete(m, k)
+}
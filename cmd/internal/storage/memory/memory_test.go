@@ -0,0 +1,84 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/transparency-dev/distributor/cmd/internal/storage"
+	"github.com/transparency-dev/distributor/cmd/internal/storage/memory"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRollback(t *testing.T) {
+	ctx := context.Background()
+	s := memory.New()
+	ts := time.Unix(1700000000, 0)
+	if err := s.ReadWriteTransaction(ctx, func(ctx context.Context, tx storage.Tx) error {
+		if err := tx.PutWitnessCheckpoint(ctx, "FooLog", "Aardvark", 16, ts, []byte("16")); err != nil {
+			return err
+		}
+		return tx.PutMergedCheckpoint(ctx, "FooLog", 1, 16, []byte("16"))
+	}); err != nil {
+		t.Fatalf("ReadWriteTransaction(): %v", err)
+	}
+
+	wantErr := errors.New("boom")
+	err := s.ReadWriteTransaction(ctx, func(ctx context.Context, tx storage.Tx) error {
+		if err := tx.PutWitnessCheckpoint(ctx, "FooLog", "Aardvark", 18, ts.Add(time.Minute), []byte("18")); err != nil {
+			return err
+		}
+		if err := tx.PutWitnessCheckpoint(ctx, "FooLog", "Badger", 18, ts, []byte("18")); err != nil {
+			return err
+		}
+		if err := tx.PutMergedCheckpoint(ctx, "FooLog", 2, 18, []byte("18")); err != nil {
+			return err
+		}
+		if err := tx.DeleteMergedCheckpoint(ctx, "FooLog", 1); err != nil {
+			return err
+		}
+		return wantErr
+	})
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("ReadWriteTransaction(): got err %v, want %v", err, wantErr)
+	}
+
+	if err := s.ReadTransaction(ctx, func(ctx context.Context, tx storage.ReadTx) error {
+		cp, err := tx.GetWitnessCheckpoint(ctx, "FooLog", "Aardvark")
+		if err != nil {
+			return err
+		}
+		if got, want := cp, (storage.WitnessCheckpoint{WitID: "Aardvark", TreeSize: 16, Timestamp: ts, Checkpoint: []byte("16")}); !cmp.Equal(got, want) {
+			t.Errorf("got checkpoint %+v, want %+v", got, want)
+		}
+		if _, err := tx.GetWitnessCheckpoint(ctx, "FooLog", "Badger"); status.Code(err) != codes.NotFound {
+			t.Errorf("GetWitnessCheckpoint(Badger): got err %v, want NotFound", err)
+		}
+		if _, _, err := tx.GetMergedCheckpoint(ctx, "FooLog", 2); status.Code(err) != codes.NotFound {
+			t.Errorf("GetMergedCheckpoint(): got err %v, want NotFound", err)
+		}
+		if _, _, err := tx.GetMergedCheckpoint(ctx, "FooLog", 1); err != nil {
+			t.Errorf("GetMergedCheckpoint(1): %v", err)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("ReadTransaction(): %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mysql provides a MySQL implementation of the distributor storage.
+package mysql
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/transparency-dev/distributor/cmd/internal/storage/sqlstore"
+)
+
+// New returns a Storage backed by the MySQL database provided.
+// The schema is created if it does not already exist.
+func New(ctx context.Context, db *sql.DB) (*Storage, error) {
+	s, err := sqlstore.New(ctx, db, sqlstore.MySQL)
+	if err != nil {
+		return nil, err
+	}
+	return &Storage{Storage: s}, nil
+}
+
+// Storage is a MySQL implementation of storage.Storage.
+type Storage struct {
+	*sqlstore.Storage
+}
@@ -0,0 +1,74 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sqlite provides a SQLite implementation of the distributor storage.
+// This is intended for small, single-node deployments.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/transparency-dev/distributor/cmd/internal/storage/sqlstore"
+
+	_ "github.com/mattn/go-sqlite3" // Load drivers for sqlite3
+)
+
+// busyTimeout is how long a connection will wait for a lock on the database
+// to be released before giving up.
+const busyTimeout = 5 * time.Second
+
+// Open opens the SQLite database at the given path, creating it if needed.
+//
+// The database is put into WAL mode, and the returned pool is limited to a
+// single connection. SQLite only supports a single writer at a time, and so
+// this avoids transactions failing with SQLITE_BUSY under contention.
+func Open(path string) (*sql.DB, error) {
+	params := url.Values{}
+	params.Set("_journal_mode", "WAL")
+	params.Set("_busy_timeout", fmt.Sprintf("%d", busyTimeout.Milliseconds()))
+	params.Set("_txlock", "immediate")
+	// The path is escaped so that characters such as '?', '#' and '%' are taken
+	// as part of the file name rather than starting the URI query or fragment.
+	dsn := url.URL{
+		Scheme:   "file",
+		Opaque:   (&url.URL{Path: path}).EscapedPath(),
+		RawQuery: params.Encode(),
+	}
+	db, err := sql.Open("sqlite3", dsn.String())
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+// New returns a Storage backed by the SQLite database provided, which should
+// have been opened using Open.
+// The schema is created if it does not already exist.
+func New(ctx context.Context, db *sql.DB) (*Storage, error) {
+	s, err := sqlstore.New(ctx, db, sqlstore.SQLite)
+	if err != nil {
+		return nil, err
+	}
+	return &Storage{Storage: s}, nil
+}
+
+// Storage is a SQLite implementation of storage.Storage.
+type Storage struct {
+	*sqlstore.Storage
+}
@@ -0,0 +1,60 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/transparency-dev/distributor/cmd/internal/storage/sqlite"
+)
+
+func TestOpenPath(t *testing.T) {
+	for _, name := range []string{
+		"distributor.db",
+		"with space.db",
+		"with?query=1.db",
+		"with#fragment.db",
+		"with%41percent.db",
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			db, err := sqlite.Open(path)
+			if err != nil {
+				t.Fatalf("Open(): %v", err)
+			}
+			defer func() {
+				if err := db.Close(); err != nil {
+					t.Errorf("Close(): %v", err)
+				}
+			}()
+			if _, err := sqlite.New(context.Background(), db); err != nil {
+				t.Fatalf("New(): %v", err)
+			}
+			var mode string
+			if err := db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+				t.Fatalf("failed to read journal mode: %v", err)
+			}
+			if mode != "wal" {
+				t.Errorf("got journal mode %q, want wal", mode)
+			}
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("database not created at %q: %v", path, err)
+			}
+		})
+	}
+}
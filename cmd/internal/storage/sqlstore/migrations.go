@@ -0,0 +1,332 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/golang/glog"
+)
+
+// Migration is a single versioned change to the schema.
+type Migration struct {
+	// Version is the schema version after this migration has been applied.
+	Version int
+	// Description is a human readable summary of the change.
+	Description string
+	// AddColumns are the columns that the change adds to existing tables. Each
+	// column is only added if it does not already exist, so that re-applying a
+	// partially applied migration is safe.
+	AddColumns []Column
+	// Statements are the SQL statements that make the rest of the change. They
+	// are run after the columns have been added.
+	Statements []string
+}
+
+// Column is a column to be added to an existing table.
+type Column struct {
+	// Table is the name of the table.
+	Table string
+	// Name is the name of the column.
+	Name string
+	// Definition is the type of the column, along with any constraints.
+	Definition string
+}
+
+// Statement returns the SQL statement that adds the column to the table.
+func (c Column) Statement() string {
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.Table, c.Name, c.Definition)
+}
+
+// migration is the definition of a Migration, which may vary by dialect.
+type migration struct {
+	description string
+	addColumns  func(d Dialect) []Column
+	statements  func(d Dialect) []string
+}
+
+// migrations is the ordered list of all changes to the schema. The version of
+// each migration is its index in this list plus one.
+//
+// Existing entries must never be modified or reordered once released, as they
+// may already have been applied to databases in the wild. Changes to the schema
+// must be made by appending a new migration to the end of this list, and the
+// SQL must remain valid for all supported dialects. Statements must be safe to
+// run again, e.g. by using CREATE TABLE IF NOT EXISTS, and columns must be added
+// with addColumns rather than with ALTER TABLE statements.
+var migrations = []migration{
+	{
+		// This uses CREATE TABLE IF NOT EXISTS so that databases created before
+		// migrations were introduced are adopted as being at version 1.
+		description: "Create checkpoints_by_witness and merged_checkpoints tables",
+		statements: func(d Dialect) []string {
+			return []string{
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS checkpoints_by_witness (
+		logID VARCHAR(200) NOT NULL,
+		witID VARCHAR(200) NOT NULL,
+		treeSize BIGINT,
+		chkpt %s,
+		PRIMARY KEY (logID, witID)
+		)`, d.BlobType),
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS merged_checkpoints (
+		logID VARCHAR(200) NOT NULL,
+		sigCount INTEGER NOT NULL,
+		treeSize BIGINT,
+		chkpt %s,
+		PRIMARY KEY (logID, sigCount)
+		)`, d.BlobType),
+			}
+		},
+	},
+	{
+		// Tables created before migrations were introduced used INTEGER for tree
+		// sizes, which is only 32 bits in MySQL.
+		description: "Widen treeSize columns to BIGINT",
+		statements: func(d Dialect) []string {
+			if d.ModifyColumnFormat == "" {
+				return nil
+			}
+			return []string{
+				fmt.Sprintf(d.ModifyColumnFormat, "checkpoints_by_witness", "treeSize", "BIGINT"),
+				fmt.Sprintf(d.ModifyColumnFormat, "merged_checkpoints", "treeSize", "BIGINT"),
+			}
+		},
+	},
+	{
+		description: "Create checkpoint_history table",
+		statements: func(d Dialect) []string {
+			return []string{
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS checkpoint_history (
+		logID VARCHAR(200) NOT NULL,
+		witID VARCHAR(200) NOT NULL,
+		treeSize BIGINT NOT NULL,
+		witTimestamp BIGINT NOT NULL,
+		chkpt %s,
+		PRIMARY KEY (logID, witID, treeSize, witTimestamp)
+		)`, d.BlobType),
+			}
+		},
+	},
+	{
+		description: "Create inconsistencies table",
+		statements: func(d Dialect) []string {
+			return []string{
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS inconsistencies (
+		logID VARCHAR(200) NOT NULL,
+		treeSize BIGINT NOT NULL,
+		hashA VARCHAR(128) NOT NULL,
+		hashB VARCHAR(128) NOT NULL,
+		chkptA %s,
+		chkptB %s,
+		discovered BIGINT NOT NULL,
+		PRIMARY KEY (logID, treeSize, hashA, hashB)
+		)`, d.BlobType, d.BlobType),
+			}
+		},
+	},
+	{
+		description: "Record witness timestamps in checkpoints_by_witness",
+		addColumns: func(d Dialect) []Column {
+			return []Column{
+				{Table: "checkpoints_by_witness", Name: "witTimestamp", Definition: "BIGINT NOT NULL DEFAULT 0"},
+			}
+		},
+	},
+	{
+		// Inconsistencies found with consistency proofs are between checkpoints
+		// for different tree sizes. Rows from before this have treeSizeB = 0.
+		description: "Record inconsistencies across tree sizes",
+		addColumns: func(d Dialect) []Column {
+			return []Column{
+				{Table: "inconsistencies", Name: "treeSizeB", Definition: "BIGINT NOT NULL DEFAULT 0"},
+				{Table: "inconsistencies", Name: "proof", Definition: d.BlobType},
+			}
+		},
+	},
+}
+
+// Migrations returns all of the schema migrations for the dialect, in the
+// order in which they are applied.
+func Migrations(d Dialect) []Migration {
+	r := make([]Migration, 0, len(migrations))
+	for i, m := range migrations {
+		mig := Migration{
+			Version:     i + 1,
+			Description: m.description,
+		}
+		if m.addColumns != nil {
+			mig.AddColumns = m.addColumns(d)
+		}
+		if m.statements != nil {
+			mig.Statements = m.statements(d)
+		}
+		r = append(r, mig)
+	}
+	return r
+}
+
+// querier is implemented by *sql.DB, *sql.Conn and *sql.Tx.
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// SchemaVersion returns the version of the schema that the database is at.
+// A database to which no migrations have been applied, including one without
+// the schema_version table which tracks applied migrations, is at version 0.
+// The database is not modified.
+func SchemaVersion(ctx context.Context, db *sql.DB, d Dialect) (int, error) {
+	return schemaVersion(ctx, db, d)
+}
+
+func schemaVersion(ctx context.Context, q querier, d Dialect) (int, error) {
+	var n int
+	if err := q.QueryRowContext(ctx, d.rebind(d.TableExistsQuery), "schema_version").Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to check for schema_version table: %v", err)
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	var v sql.NullInt64
+	if err := q.QueryRowContext(ctx, "SELECT MAX(version) FROM schema_version").Scan(&v); err != nil {
+		return 0, fmt.Errorf("failed to query schema version: %v", err)
+	}
+	return int(v.Int64), nil
+}
+
+// PendingMigrations returns the migrations that have not yet been applied to
+// the database, in the order in which they will be applied. The database is
+// not modified.
+func PendingMigrations(ctx context.Context, db *sql.DB, d Dialect) ([]Migration, error) {
+	return pendingMigrations(ctx, db, d)
+}
+
+func pendingMigrations(ctx context.Context, q querier, d Dialect) ([]Migration, error) {
+	v, err := schemaVersion(ctx, q, d)
+	if err != nil {
+		return nil, err
+	}
+	all := Migrations(d)
+	if v > len(all) {
+		return nil, fmt.Errorf("database schema version %d is newer than the latest known version %d", v, len(all))
+	}
+	return all[v:], nil
+}
+
+// Migrate applies all pending migrations to the database, in order.
+//
+// Each migration is applied within its own transaction along with the update
+// to the schema version, so that a failure leaves the database at the last
+// successfully applied version. Note that MySQL implicitly commits DDL
+// statements, so a partially applied migration cannot be rolled back there.
+// Instead, migrations are written such that re-running them is safe: tables
+// are only created if they do not exist, and columns are only added if they
+// are not already present.
+//
+// Concurrent calls, e.g. from replicas starting at the same time, are serialized
+// with a database lock, so that each migration is only applied once.
+func Migrate(ctx context.Context, db *sql.DB, d Dialect) (err error) {
+	// The lock is held by a session, so everything is done on a single connection.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %v", err)
+	}
+	defer func() {
+		if cerr := conn.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("failed to close connection: %v", cerr)
+		}
+	}()
+	if d.MigrationLockQuery != "" {
+		var locked sql.NullInt64
+		if err := conn.QueryRowContext(ctx, d.MigrationLockQuery).Scan(&locked); err != nil {
+			return fmt.Errorf("failed to take migration lock: %v", err)
+		}
+		if locked.Int64 != 1 {
+			return fmt.Errorf("failed to take migration lock")
+		}
+		defer func() {
+			// The context may have been cancelled, but the lock must still be released.
+			if _, uerr := conn.ExecContext(context.Background(), d.MigrationUnlockStatement); uerr != nil && err == nil {
+				err = fmt.Errorf("failed to release migration lock: %v", uerr)
+			}
+		}()
+	}
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER NOT NULL,
+		description VARCHAR(200) NOT NULL,
+		PRIMARY KEY (version)
+		)`); err != nil {
+		return fmt.Errorf("failed to create schema_version table: %v", err)
+	}
+	pending, err := pendingMigrations(ctx, conn, d)
+	if err != nil {
+		return err
+	}
+	for _, m := range pending {
+		applied, err := applyMigration(ctx, conn, d, m)
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %d (%s): %v", m.Version, m.Description, err)
+		}
+		if applied {
+			glog.Infof("Applied schema migration %d: %s", m.Version, m.Description)
+		}
+	}
+	return nil
+}
+
+// applyMigration applies the migration, unless the schema version shows that it
+// has already been applied, and returns whether it was applied.
+func applyMigration(ctx context.Context, conn *sql.Conn, d Dialect, m Migration) (bool, error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// This is a no-op if the transaction has already been committed.
+		_ = tx.Rollback()
+	}()
+	// Databases without a migration lock rely on the transaction to serialize
+	// migrations, so the version is checked again within it.
+	v, err := schemaVersion(ctx, tx, d)
+	if err != nil {
+		return false, err
+	}
+	if v >= m.Version {
+		return false, nil
+	}
+	for _, c := range m.AddColumns {
+		var n int
+		if err := tx.QueryRowContext(ctx, d.rebind(d.ColumnExistsQuery), c.Table, c.Name).Scan(&n); err != nil {
+			return false, fmt.Errorf("failed to check for column %s.%s: %v", c.Table, c.Name, err)
+		}
+		if n > 0 {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, c.Statement()); err != nil {
+			return false, err
+		}
+	}
+	for _, stmt := range m.Statements {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return false, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, d.rebind("INSERT INTO schema_version (version, description) VALUES (?, ?)"), m.Version, m.Description); err != nil {
+		return false, fmt.Errorf("failed to update schema version: %v", err)
+	}
+	return true, tx.Commit()
+}
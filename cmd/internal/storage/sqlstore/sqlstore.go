@@ -0,0 +1,454 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sqlstore provides an implementation of the distributor storage on
+// top of database/sql. The SQL used is common to all of the supported databases
+// other than the differences captured by a Dialect; database specific setup is
+// handled by the packages that wrap this one.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/transparency-dev/distributor/cmd/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Dialect captures the differences in SQL syntax between the supported databases.
+type Dialect struct {
+	// BlobType is the column type used to store raw checkpoints.
+	BlobType string
+	// NumberedPlaceholders is true if statement arguments are referenced as
+	// $1, $2, etc. rather than with ?.
+	NumberedPlaceholders bool
+	// OnConflictUpsert is true if rows are upserted using INSERT ... ON CONFLICT,
+	// rather than REPLACE INTO.
+	OnConflictUpsert bool
+	// ModifyColumnFormat is a format string taking the table, column, and new
+	// type, which changes the type of an existing column. It is empty if column
+	// types never need to be changed, e.g. because they are dynamic.
+	ModifyColumnFormat string
+	// TableExistsQuery is a query taking a table name, which returns the number
+	// of tables in the current database with that name.
+	TableExistsQuery string
+	// ColumnExistsQuery is a query taking a table name and a column name, which
+	// returns the number of columns with that name in the table.
+	ColumnExistsQuery string
+	// MigrationLockQuery is a query that waits until the session holds the lock
+	// used to serialize schema migrations, and then returns 1. It is empty if
+	// transactions already serialize migrations.
+	MigrationLockQuery string
+	// MigrationUnlockStatement releases the lock taken by MigrationLockQuery.
+	MigrationUnlockStatement string
+}
+
+var (
+	// MySQL is the Dialect for MySQL databases.
+	MySQL = Dialect{
+		BlobType:                 "BLOB",
+		ModifyColumnFormat:       "ALTER TABLE %s MODIFY %s %s",
+		TableExistsQuery:         "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?",
+		ColumnExistsQuery:        "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?",
+		MigrationLockQuery:       "SELECT GET_LOCK('distributor_schema_migration', -1)",
+		MigrationUnlockStatement: "SELECT RELEASE_LOCK('distributor_schema_migration')",
+	}
+	// SQLite is the Dialect for SQLite databases.
+	SQLite = Dialect{
+		BlobType:          "BLOB",
+		TableExistsQuery:  "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?",
+		ColumnExistsQuery: "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?",
+	}
+	// Postgres is the Dialect for PostgreSQL databases.
+	Postgres = Dialect{
+		BlobType:             "BYTEA",
+		NumberedPlaceholders: true,
+		OnConflictUpsert:     true,
+		ModifyColumnFormat:   "ALTER TABLE %s ALTER COLUMN %s TYPE %s",
+		TableExistsQuery:     "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?",
+		// Unquoted identifiers are folded to lower case.
+		ColumnExistsQuery: "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = LOWER(?) AND column_name = LOWER(?)",
+		// pg_advisory_lock returns void, so the row is counted instead.
+		MigrationLockQuery:       "SELECT COUNT(*) FROM (SELECT pg_advisory_lock(hashtext('distributor_schema_migration'))) AS l",
+		MigrationUnlockStatement: "SELECT pg_advisory_unlock(hashtext('distributor_schema_migration'))",
+	}
+)
+
+// rebind rewrites a statement written with ? placeholders into the form
+// expected by the database.
+func (d Dialect) rebind(query string) string {
+	if !d.NumberedPlaceholders {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// upsert returns a statement that writes a row with the given columns into table,
+// replacing any existing row with the same primary key. The primary key columns
+// must be the first numKeys entries in cols.
+func (d Dialect) upsert(table string, cols []string, numKeys int) string {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", ")
+	if !d.OnConflictUpsert {
+		return d.rebind(fmt.Sprintf("REPLACE INTO %s (%s) VALUES (%s)", table, strings.Join(cols, ", "), placeholders))
+	}
+	updates := make([]string, 0, len(cols)-numKeys)
+	for _, c := range cols[numKeys:] {
+		updates = append(updates, fmt.Sprintf("%s = EXCLUDED.%s", c, c))
+	}
+	return d.rebind(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) DO UPDATE SET %s",
+		table, strings.Join(cols, ", "), placeholders, strings.Join(cols[:numKeys], ", "), strings.Join(updates, ", ")))
+}
+
+// New returns a Storage backed by the database provided, which uses the
+// given SQL dialect.
+// Any pending schema migrations are applied before returning.
+func New(ctx context.Context, db *sql.DB, dialect Dialect) (*Storage, error) {
+	if err := Migrate(ctx, db, dialect); err != nil {
+		return nil, fmt.Errorf("failed to migrate schema: %v", err)
+	}
+	return &Storage{db: db, dialect: dialect}, nil
+}
+
+// Storage is a database/sql implementation of storage.Storage.
+type Storage struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// ReadTransaction runs f within a read-only transaction.
+func (s *Storage) ReadTransaction(ctx context.Context, f func(context.Context, storage.ReadTx) error) error {
+	return s.transact(ctx, &sql.TxOptions{ReadOnly: true}, func(ctx context.Context, t *tx) error {
+		return f(ctx, t)
+	})
+}
+
+// ReadWriteTransaction runs f within a transaction that can modify state.
+func (s *Storage) ReadWriteTransaction(ctx context.Context, f func(context.Context, storage.Tx) error) error {
+	return s.transact(ctx, &sql.TxOptions{ReadOnly: false}, func(ctx context.Context, t *tx) error {
+		return f(ctx, t)
+	})
+}
+
+func (s *Storage) transact(ctx context.Context, opts *sql.TxOptions, f func(context.Context, *tx) error) error {
+	sqlTx, err := s.db.BeginTx(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	if err := f(ctx, &tx{tx: sqlTx, dialect: s.dialect}); err != nil {
+		if err := sqlTx.Rollback(); err != nil {
+			glog.Errorf("Rollback(): %v", err)
+		}
+		return err
+	}
+	return sqlTx.Commit()
+}
+
+type tx struct {
+	tx      *sql.Tx
+	dialect Dialect
+}
+
+func (t *tx) GetWitnessCheckpoint(ctx context.Context, logID, witID string) (storage.WitnessCheckpoint, error) {
+	row := t.tx.QueryRowContext(ctx, t.dialect.rebind("SELECT treeSize, witTimestamp, chkpt FROM checkpoints_by_witness WHERE logID = ? AND witID = ?"), logID, witID)
+	if err := row.Err(); err != nil {
+		return storage.WitnessCheckpoint{}, err
+	}
+	wcp := storage.WitnessCheckpoint{WitID: witID}
+	var ts int64
+	if err := row.Scan(&wcp.TreeSize, &ts, &wcp.Checkpoint); err != nil {
+		if err == sql.ErrNoRows {
+			return storage.WitnessCheckpoint{}, status.Errorf(codes.NotFound, "no checkpoint for log %q from witness %q", logID, witID)
+		}
+		return storage.WitnessCheckpoint{}, err
+	}
+	wcp.Timestamp = unixOrZero(ts)
+	return wcp, nil
+}
+
+func (t *tx) GetCheckpointsAtSize(ctx context.Context, logID string, treeSize uint64) ([]storage.WitnessCheckpoint, error) {
+	return t.queryWitnessCheckpoints(ctx, "SELECT witID, treeSize, witTimestamp, chkpt FROM checkpoints_by_witness WHERE logID = ? AND treeSize = ? ORDER BY witID ASC", logID, treeSize)
+}
+
+func (t *tx) GetWitnessCheckpoints(ctx context.Context, logID string) ([]storage.WitnessCheckpoint, error) {
+	return t.queryWitnessCheckpoints(ctx, "SELECT witID, treeSize, witTimestamp, chkpt FROM checkpoints_by_witness WHERE logID = ? ORDER BY treeSize DESC, witID ASC", logID)
+}
+
+// queryWitnessCheckpoints runs a query that selects the witID, treeSize, witTimestamp
+// and chkpt columns from checkpoints_by_witness, and returns the resulting rows.
+func (t *tx) queryWitnessCheckpoints(ctx context.Context, query string, args ...any) ([]storage.WitnessCheckpoint, error) {
+	rows, err := t.tx.QueryContext(ctx, t.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("QueryContext(): %v", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			glog.Errorf("rows.Close(): %v", err)
+		}
+	}()
+
+	var r []storage.WitnessCheckpoint
+	for rows.Next() {
+		var wcp storage.WitnessCheckpoint
+		var ts int64
+		if err := rows.Scan(&wcp.WitID, &wcp.TreeSize, &ts, &wcp.Checkpoint); err != nil {
+			return nil, fmt.Errorf("failed to scan rows: %v", err)
+		}
+		wcp.Timestamp = unixOrZero(ts)
+		r = append(r, wcp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err(): %v", err)
+	}
+	return r, nil
+}
+
+func (t *tx) GetMergedCheckpoint(ctx context.Context, logID string, sigCount uint32) (uint64, []byte, error) {
+	row := t.tx.QueryRowContext(ctx, t.dialect.rebind("SELECT treeSize, chkpt FROM merged_checkpoints WHERE logID = ? AND sigCount = ?"), logID, sigCount)
+	if err := row.Err(); err != nil {
+		return 0, nil, fmt.Errorf("QueryRowContext(): %v", err)
+	}
+	var treeSize uint64
+	var chkpt []byte
+	if err := row.Scan(&treeSize, &chkpt); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil, status.Errorf(codes.NotFound, "no checkpoint with %d signatures found", sigCount)
+		}
+		return 0, nil, fmt.Errorf("Scan(): %v", err)
+	}
+	return treeSize, chkpt, nil
+}
+
+func (t *tx) GetLatestMergedCheckpoint(ctx context.Context, logID string, minSigCount uint32) ([]byte, error) {
+	row := t.tx.QueryRowContext(ctx, t.dialect.rebind("SELECT chkpt FROM merged_checkpoints WHERE logID = ? AND sigCount >= ? ORDER BY treeSize DESC, sigCount DESC LIMIT 1"), logID, minSigCount)
+	if err := row.Err(); err != nil {
+		return nil, fmt.Errorf("QueryRowContext(): %v", err)
+	}
+	var chkpt []byte
+	if err := row.Scan(&chkpt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, status.Errorf(codes.NotFound, "no checkpoint with at least %d signatures found", minSigCount)
+		}
+		return nil, fmt.Errorf("Scan(): %v", err)
+	}
+	return chkpt, nil
+}
+
+func (t *tx) GetMergedCheckpoints(ctx context.Context, logID string) ([]storage.MergedCheckpoint, error) {
+	rows, err := t.tx.QueryContext(ctx, t.dialect.rebind("SELECT sigCount, treeSize, chkpt FROM merged_checkpoints WHERE logID = ? ORDER BY sigCount ASC"), logID)
+	if err != nil {
+		return nil, fmt.Errorf("QueryContext(): %v", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			glog.Errorf("rows.Close(): %v", err)
+		}
+	}()
+	var r []storage.MergedCheckpoint
+	for rows.Next() {
+		var mcp storage.MergedCheckpoint
+		if err := rows.Scan(&mcp.SigCount, &mcp.TreeSize, &mcp.Checkpoint); err != nil {
+			return nil, fmt.Errorf("failed to scan rows: %v", err)
+		}
+		r = append(r, mcp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err(): %v", err)
+	}
+	return r, nil
+}
+
+func (t *tx) PutWitnessCheckpoint(ctx context.Context, logID, witID string, treeSize uint64, timestamp time.Time, chkpt []byte) error {
+	if _, err := t.tx.ExecContext(ctx, t.dialect.upsert("checkpoints_by_witness", []string{"logID", "witID", "treeSize", "witTimestamp", "chkpt"}, 2), logID, witID, treeSize, timestamp.Unix(), chkpt); err != nil {
+		return fmt.Errorf("ExecContext(): %v", err)
+	}
+	return nil
+}
+
+func (t *tx) PutMergedCheckpoint(ctx context.Context, logID string, sigCount uint32, treeSize uint64, chkpt []byte) error {
+	if _, err := t.tx.ExecContext(ctx, t.dialect.upsert("merged_checkpoints", []string{"logID", "sigCount", "treeSize", "chkpt"}, 2), logID, sigCount, treeSize, chkpt); err != nil {
+		return fmt.Errorf("ExecContext(): %v", err)
+	}
+	return nil
+}
+
+func (t *tx) DeleteMergedCheckpoint(ctx context.Context, logID string, sigCount uint32) error {
+	if _, err := t.tx.ExecContext(ctx, t.dialect.rebind("DELETE FROM merged_checkpoints WHERE logID = ? AND sigCount = ?"), logID, sigCount); err != nil {
+		return fmt.Errorf("ExecContext(): %v", err)
+	}
+	return nil
+}
+
+func (t *tx) GetWitnessCheckpointHistory(ctx context.Context, logID, witID string, since, until time.Time) ([]storage.HistoricCheckpoint, error) {
+	rows, err := t.tx.QueryContext(ctx, t.dialect.rebind("SELECT treeSize, witTimestamp, chkpt FROM checkpoint_history WHERE logID = ? AND witID = ? AND witTimestamp >= ? AND witTimestamp < ? ORDER BY witTimestamp ASC, treeSize ASC"), logID, witID, since.Unix(), until.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("QueryContext(): %v", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			glog.Errorf("rows.Close(): %v", err)
+		}
+	}()
+
+	var r []storage.HistoricCheckpoint
+	for rows.Next() {
+		var hcp storage.HistoricCheckpoint
+		var ts int64
+		if err := rows.Scan(&hcp.TreeSize, &ts, &hcp.Checkpoint); err != nil {
+			return nil, fmt.Errorf("failed to scan rows: %v", err)
+		}
+		hcp.Timestamp = time.Unix(ts, 0)
+		r = append(r, hcp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err(): %v", err)
+	}
+	return r, nil
+}
+
+func (t *tx) AddWitnessCheckpointHistory(ctx context.Context, logID, witID string, treeSize uint64, timestamp time.Time, chkpt []byte) error {
+	if _, err := t.tx.ExecContext(ctx, t.dialect.upsert("checkpoint_history", []string{"logID", "witID", "treeSize", "witTimestamp", "chkpt"}, 4), logID, witID, treeSize, timestamp.Unix(), chkpt); err != nil {
+		return fmt.Errorf("ExecContext(): %v", err)
+	}
+	return nil
+}
+
+func (t *tx) PruneWitnessCheckpointHistory(ctx context.Context, logID, witID string, before time.Time) error {
+	if _, err := t.tx.ExecContext(ctx, t.dialect.rebind("DELETE FROM checkpoint_history WHERE logID = ? AND witID = ? AND witTimestamp < ?"), logID, witID, before.Unix()); err != nil {
+		return fmt.Errorf("ExecContext(): %v", err)
+	}
+	return nil
+}
+
+func (t *tx) PruneCheckpointHistory(ctx context.Context, before time.Time) error {
+	if _, err := t.tx.ExecContext(ctx, t.dialect.rebind("DELETE FROM checkpoint_history WHERE witTimestamp < ?"), before.Unix()); err != nil {
+		return fmt.Errorf("ExecContext(): %v", err)
+	}
+	return nil
+}
+
+func (t *tx) GetInconsistencies(ctx context.Context, logID string) ([]storage.Inconsistency, error) {
+	rows, err := t.tx.QueryContext(ctx, t.dialect.rebind("SELECT treeSize, treeSizeB, hashA, hashB, chkptA, chkptB, proof, discovered FROM inconsistencies WHERE logID = ? ORDER BY treeSize ASC, hashA ASC, hashB ASC"), logID)
+	if err != nil {
+		return nil, fmt.Errorf("QueryContext(): %v", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			glog.Errorf("rows.Close(): %v", err)
+		}
+	}()
+
+	var r []storage.Inconsistency
+	for rows.Next() {
+		var inc storage.Inconsistency
+		var hashA, hashB string
+		var proof []byte
+		var discovered int64
+		if err := rows.Scan(&inc.TreeSize, &inc.TreeSizeB, &hashA, &hashB, &inc.CheckpointA, &inc.CheckpointB, &proof, &discovered); err != nil {
+			return nil, fmt.Errorf("failed to scan rows: %v", err)
+		}
+		if inc.TreeSizeB == 0 {
+			inc.TreeSizeB = inc.TreeSize
+		}
+		if inc.Proof, err = decodeProof(proof); err != nil {
+			return nil, err
+		}
+		if inc.HashA, err = hex.DecodeString(hashA); err != nil {
+			return nil, fmt.Errorf("invalid hash %q: %v", hashA, err)
+		}
+		if inc.HashB, err = hex.DecodeString(hashB); err != nil {
+			return nil, fmt.Errorf("invalid hash %q: %v", hashB, err)
+		}
+		inc.Discovered = time.Unix(discovered, 0)
+		r = append(r, inc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err(): %v", err)
+	}
+	return r, nil
+}
+
+func (t *tx) AddInconsistency(ctx context.Context, logID string, inc storage.Inconsistency, limit int) (bool, error) {
+	hashA, hashB := hex.EncodeToString(inc.HashA), hex.EncodeToString(inc.HashB)
+	var existing int
+	if err := t.tx.QueryRowContext(ctx, t.dialect.rebind("SELECT COUNT(*) FROM inconsistencies WHERE logID = ? AND treeSize = ? AND hashA = ? AND hashB = ?"), logID, inc.TreeSize, hashA, hashB).Scan(&existing); err != nil {
+		return false, fmt.Errorf("failed to query for existing inconsistency: %v", err)
+	}
+	if existing > 0 {
+		return false, nil
+	}
+	var count int
+	if err := t.tx.QueryRowContext(ctx, t.dialect.rebind("SELECT COUNT(*) FROM inconsistencies WHERE logID = ?"), logID).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to count inconsistencies: %v", err)
+	}
+	if count >= limit {
+		return false, nil
+	}
+	if _, err := t.tx.ExecContext(ctx, t.dialect.rebind("INSERT INTO inconsistencies (logID, treeSize, treeSizeB, hashA, hashB, chkptA, chkptB, proof, discovered) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"), logID, inc.TreeSize, inc.TreeSizeB, hashA, hashB, inc.CheckpointA, inc.CheckpointB, encodeProof(inc.Proof), inc.Discovered.Unix()); err != nil {
+		return false, fmt.Errorf("ExecContext(): %v", err)
+	}
+	return true, nil
+}
+
+// encodeProof encodes the hashes of a proof as lines of base64, so that hashes
+// of any length can be stored.
+func encodeProof(proof [][]byte) []byte {
+	var b []byte
+	for _, h := range proof {
+		b = base64.StdEncoding.AppendEncode(b, h)
+		b = append(b, '\n')
+	}
+	return b
+}
+
+// decodeProof is the inverse of encodeProof.
+func decodeProof(b []byte) ([][]byte, error) {
+	var proof [][]byte
+	for _, l := range strings.Split(strings.TrimSuffix(string(b), "\n"), "\n") {
+		if l == "" {
+			continue
+		}
+		h, err := base64.StdEncoding.DecodeString(l)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proof hash %q: %v", l, err)
+		}
+		proof = append(proof, h)
+	}
+	return proof, nil
+}
+
+// unixOrZero returns the time for the unix timestamp, or the zero time if the
+// timestamp is 0, which is used for rows stored before timestamps were recorded.
+func unixOrZero(ts int64) time.Time {
+	if ts == 0 {
+		return time.Time{}
+	}
+	return time.Unix(ts, 0)
+}
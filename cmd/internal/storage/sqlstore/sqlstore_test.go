@@ -0,0 +1,235 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlstore
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	_ "github.com/mattn/go-sqlite3" // Load drivers for sqlite3
+)
+
+func TestUpsert(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		dialect Dialect
+		want    string
+	}{
+		{
+			desc:    "mysql",
+			dialect: MySQL,
+			want:    "REPLACE INTO merged_checkpoints (logID, sigCount, treeSize, chkpt) VALUES (?, ?, ?, ?)",
+		},
+		{
+			desc:    "sqlite",
+			dialect: SQLite,
+			want:    "REPLACE INTO merged_checkpoints (logID, sigCount, treeSize, chkpt) VALUES (?, ?, ?, ?)",
+		},
+		{
+			desc:    "postgres",
+			dialect: Postgres,
+			want:    "INSERT INTO merged_checkpoints (logID, sigCount, treeSize, chkpt) VALUES ($1, $2, $3, $4) ON CONFLICT (logID, sigCount) DO UPDATE SET treeSize = EXCLUDED.treeSize, chkpt = EXCLUDED.chkpt",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got := tC.dialect.upsert("merged_checkpoints", []string{"logID", "sigCount", "treeSize", "chkpt"}, 2)
+			if got != tC.want {
+				t.Errorf("got %q, want %q", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestRebind(t *testing.T) {
+	q := "SELECT chkpt FROM checkpoints_by_witness WHERE logID = ? AND witID = ?"
+	if got, want := MySQL.rebind(q), q; got != want {
+		t.Errorf("MySQL: got %q, want %q", got, want)
+	}
+	if got, want := Postgres.rebind(q), "SELECT chkpt FROM checkpoints_by_witness WHERE logID = $1 AND witID = $2"; got != want {
+		t.Errorf("Postgres: got %q, want %q", got, want)
+	}
+}
+
+func TestEncodeProof(t *testing.T) {
+	for _, proof := range [][][]byte{
+		nil,
+		{[]byte("short")},
+		{bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32), {}},
+	} {
+		got, err := decodeProof(encodeProof(proof))
+		if err != nil {
+			t.Fatalf("decodeProof(): %v", err)
+		}
+		// Empty hashes cannot be represented, and are dropped.
+		var want [][]byte
+		for _, h := range proof {
+			if len(h) > 0 {
+				want = append(want, h)
+			}
+		}
+		if !cmp.Equal(got, want) {
+			t.Errorf("got %x, want %x", got, want)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "migrate.db"))
+	if err != nil {
+		t.Fatalf("sql.Open(): %v", err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("db.Close(): %v", err)
+		}
+	}()
+
+	// Create the tables as they were before migrations were introduced.
+	for _, stmt := range []string{
+		`CREATE TABLE checkpoints_by_witness (logID VARCHAR(200), witID VARCHAR(200), treeSize INTEGER, chkpt BLOB, PRIMARY KEY (logID, witID))`,
+		`CREATE TABLE merged_checkpoints (logID VARCHAR(200), sigCount INTEGER, treeSize INTEGER, chkpt BLOB, PRIMARY KEY (logID, sigCount))`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("ExecContext(): %v", err)
+		}
+	}
+
+	pending, err := PendingMigrations(ctx, db, SQLite)
+	if err != nil {
+		t.Fatalf("PendingMigrations(): %v", err)
+	}
+	if got, want := len(pending), len(migrations); got != want {
+		t.Errorf("got %d pending migrations, want %d", got, want)
+	}
+	// Finding the pending migrations must not modify the database.
+	var n int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE name = 'schema_version'").Scan(&n); err != nil {
+		t.Fatalf("QueryRowContext(): %v", err)
+	}
+	if n != 0 {
+		t.Errorf("schema_version table created by PendingMigrations")
+	}
+	for i, m := range pending {
+		if got, want := m.Version, i+1; got != want {
+			t.Errorf("pending[%d] has version %d, want %d", i, got, want)
+		}
+	}
+
+	// Migrate twice to ensure that it is idempotent.
+	for i := 0; i < 2; i++ {
+		if err := Migrate(ctx, db, SQLite); err != nil {
+			t.Fatalf("Migrate() %d: %v", i, err)
+		}
+		v, err := SchemaVersion(ctx, db, SQLite)
+		if err != nil {
+			t.Fatalf("SchemaVersion(): %v", err)
+		}
+		if got, want := v, len(migrations); got != want {
+			t.Errorf("got schema version %d, want %d", got, want)
+		}
+	}
+	pending, err = PendingMigrations(ctx, db, SQLite)
+	if err != nil {
+		t.Fatalf("PendingMigrations(): %v", err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("got %d pending migrations after Migrate, want 0", len(pending))
+	}
+}
+
+func TestMigrateAfterPartialMigration(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "migrate.db"))
+	if err != nil {
+		t.Fatalf("sql.Open(): %v", err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("db.Close(): %v", err)
+		}
+	}()
+	if err := Migrate(ctx, db, SQLite); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
+	// Forget every migration that adds columns, as if the columns had been added
+	// but the schema version had not been updated, as can happen on MySQL.
+	for _, m := range Migrations(SQLite) {
+		if len(m.AddColumns) == 0 {
+			continue
+		}
+		if _, err := db.ExecContext(ctx, "DELETE FROM schema_version WHERE version = ?", m.Version); err != nil {
+			t.Fatalf("ExecContext(): %v", err)
+		}
+	}
+	if err := Migrate(ctx, db, SQLite); err != nil {
+		t.Fatalf("Migrate() after partial migration: %v", err)
+	}
+	v, err := SchemaVersion(ctx, db, SQLite)
+	if err != nil {
+		t.Fatalf("SchemaVersion(): %v", err)
+	}
+	if got, want := v, len(migrations); got != want {
+		t.Errorf("got schema version %d, want %d", got, want)
+	}
+}
+
+func TestMigrateConcurrently(t *testing.T) {
+	ctx := context.Background()
+	// Each replica has its own pool, as if it were a separate process.
+	dsn := "file:" + filepath.Join(t.TempDir(), "migrate.db") + "?_txlock=immediate&_busy_timeout=5000"
+	const replicas = 4
+	errs := make(chan error, replicas)
+	for i := 0; i < replicas; i++ {
+		go func() {
+			db, err := sql.Open("sqlite3", dsn)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer func() {
+				_ = db.Close()
+			}()
+			errs <- Migrate(ctx, db, SQLite)
+		}()
+	}
+	for i := 0; i < replicas; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Migrate(): %v", err)
+		}
+	}
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatalf("sql.Open(): %v", err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("db.Close(): %v", err)
+		}
+	}()
+	var n int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_version").Scan(&n); err != nil {
+		t.Fatalf("QueryRowContext(): %v", err)
+	}
+	if got, want := n, len(migrations); got != want {
+		t.Errorf("got %d schema versions, want %d", got, want)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package storage defines the persistence layer used by the distributor.
+// Implementations live in subpackages of this package.
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// Storage persists witnessed checkpoints on behalf of the distributor.
+// All access to the stored data happens within a transaction.
+type Storage interface {
+	// ReadTransaction runs f within a read-only transaction.
+	// The transaction is always closed when f returns; any error returned by
+	// f is returned to the caller.
+	ReadTransaction(ctx context.Context, f func(context.Context, ReadTx) error) error
+	// ReadWriteTransaction runs f within a transaction that can modify state.
+	// The transaction is committed only if f returns nil, otherwise it is
+	// rolled back and the error from f is returned.
+	ReadWriteTransaction(ctx context.Context, f func(context.Context, Tx) error) error
+}
+
+// ReadTx provides read access to the stored checkpoints.
+type ReadTx interface {
+	// GetWitnessCheckpoint returns the latest checkpoint for the given log and witness pair.
+	// If no checkpoint is found then an error with status `codes.NotFound` will be returned,
+	// which allows callers to handle this case separately if needed.
+	GetWitnessCheckpoint(ctx context.Context, logID, witID string) (WitnessCheckpoint, error)
+	// GetCheckpointsAtSize returns all of the latest per-witness checkpoints for the
+	// given log that are for the tree size provided, ordered by witness ID.
+	GetCheckpointsAtSize(ctx context.Context, logID string, treeSize uint64) ([]WitnessCheckpoint, error)
+	// GetWitnessCheckpoints returns all of the latest per-witness checkpoints for the
+	// given log, ordered by tree size (largest first), then witness ID.
+	GetWitnessCheckpoints(ctx context.Context, logID string) ([]WitnessCheckpoint, error)
+	// GetMergedCheckpoint returns the merged checkpoint for the given log with
+	// sigCount signatures, along with the tree size it commits to.
+	// If no checkpoint is found then an error with status `codes.NotFound` will be returned.
+	GetMergedCheckpoint(ctx context.Context, logID string, sigCount uint32) (uint64, []byte, error)
+	// GetLatestMergedCheckpoint returns the merged checkpoint for the given log that has
+	// the largest tree size among those with at least minSigCount signatures. If there are
+	// several such checkpoints then the one with the most signatures is returned.
+	// If no checkpoint is found then an error with status `codes.NotFound` will be returned.
+	GetLatestMergedCheckpoint(ctx context.Context, logID string, minSigCount uint32) ([]byte, error)
+	// GetMergedCheckpoints returns all of the merged checkpoints for the given log,
+	// ordered by signature count.
+	GetMergedCheckpoints(ctx context.Context, logID string) ([]MergedCheckpoint, error)
+	// GetWitnessCheckpointHistory returns the checkpoints accepted from the given witness
+	// for the log whose witness timestamp is within [since, until), ordered by timestamp.
+	GetWitnessCheckpointHistory(ctx context.Context, logID, witID string, since, until time.Time) ([]HistoricCheckpoint, error)
+	// GetInconsistencies returns all of the evidence of inconsistency stored for the log,
+	// ordered by tree size.
+	GetInconsistencies(ctx context.Context, logID string) ([]Inconsistency, error)
+}
+
+// Tx provides read and write access to the stored checkpoints.
+type Tx interface {
+	ReadTx
+	// PutWitnessCheckpoint sets the latest checkpoint for the given log and witness
+	// pair, replacing any previous value. The timestamp is the time at which the
+	// witness cosigned the checkpoint.
+	PutWitnessCheckpoint(ctx context.Context, logID, witID string, treeSize uint64, timestamp time.Time, chkpt []byte) error
+	// PutMergedCheckpoint sets the merged checkpoint for the given log with sigCount
+	// signatures, replacing any previous value.
+	PutMergedCheckpoint(ctx context.Context, logID string, sigCount uint32, treeSize uint64, chkpt []byte) error
+	// DeleteMergedCheckpoint removes the merged checkpoint for the given log with sigCount
+	// signatures, if there is one.
+	DeleteMergedCheckpoint(ctx context.Context, logID string, sigCount uint32) error
+	// AddWitnessCheckpointHistory appends a checkpoint accepted from the witness to the
+	// history for the log. Adding an entry for the same tree size and timestamp as an
+	// existing entry replaces it.
+	AddWitnessCheckpointHistory(ctx context.Context, logID, witID string, treeSize uint64, timestamp time.Time, chkpt []byte) error
+	// PruneWitnessCheckpointHistory removes all entries from the history of the given
+	// log and witness pair with a witness timestamp before the one provided.
+	PruneWitnessCheckpointHistory(ctx context.Context, logID, witID string, before time.Time) error
+	// PruneCheckpointHistory removes all entries from the history of every log and
+	// witness pair with a witness timestamp before the one provided.
+	PruneCheckpointHistory(ctx context.Context, before time.Time) error
+	// AddInconsistency stores evidence of an inconsistency for the log. Evidence is
+	// deduplicated by tree size and the pair of hashes. If the evidence is a duplicate,
+	// or there are already limit entries for the log, then it is not stored and false
+	// is returned.
+	AddInconsistency(ctx context.Context, logID string, inc Inconsistency, limit int) (bool, error)
+}
+
+// WitnessCheckpoint is a checkpoint for a log as submitted by a single witness.
+type WitnessCheckpoint struct {
+	// WitID is the ID of the witness that submitted the checkpoint.
+	WitID string
+	// TreeSize is the size of the log tree committed to by the checkpoint.
+	TreeSize uint64
+	// Timestamp is the time at which the witness signed the checkpoint. This is
+	// the zero time for checkpoints stored before timestamps were recorded.
+	Timestamp time.Time
+	// Checkpoint is the raw checkpoint, signed by the log and the witness.
+	Checkpoint []byte
+}
+
+// MergedCheckpoint is a checkpoint for a log combining the signatures of several witnesses.
+type MergedCheckpoint struct {
+	// SigCount is the number of witness signatures on the checkpoint.
+	SigCount uint32
+	// TreeSize is the size of the log tree committed to by the checkpoint.
+	TreeSize uint64
+	// Checkpoint is the raw checkpoint, signed by the log and the witnesses.
+	Checkpoint []byte
+}
+
+// HistoricCheckpoint is a checkpoint that was accepted from a witness at some point.
+type HistoricCheckpoint struct {
+	// TreeSize is the size of the log tree committed to by the checkpoint.
+	TreeSize uint64
+	// Timestamp is the time at which the witness signed the checkpoint.
+	Timestamp time.Time
+	// Checkpoint is the raw checkpoint, signed by the log and the witness.
+	Checkpoint []byte
+}
+
+// Inconsistency is evidence that two checkpoints for the same log are not consistent with each other.
+// If both checkpoints are for the same tree size, they have different root hashes, and are ordered
+// such that HashA is lexicographically less than HashB. Otherwise, CheckpointA is for the smaller
+// tree, and Proof is the consistency proof between them that failed to verify.
+type Inconsistency struct {
+	// TreeSize is the size of the log tree that CheckpointA commits to.
+	TreeSize uint64
+	// TreeSizeB is the size of the log tree that CheckpointB commits to.
+	TreeSizeB uint64
+	// HashA and HashB are the root hashes of CheckpointA and CheckpointB respectively.
+	HashA, HashB []byte
+	// CheckpointA and CheckpointB are the raw conflicting checkpoints.
+	CheckpointA, CheckpointB []byte
+	// Proof is the consistency proof from CheckpointA to CheckpointB, if they are for
+	// different tree sizes.
+	Proof [][]byte
+	// Discovered is the time at which the inconsistency was first found.
+	Discovered time.Time
+}
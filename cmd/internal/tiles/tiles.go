@@ -0,0 +1,181 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tiles provides consistency proofs for logs which serve their Merkle
+// tree as tiles, following https://c2sp.org/tlog-tiles.
+package tiles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// tileHeight is the height of the tiles, which is fixed by the tlog-tiles spec.
+const tileHeight = 8
+
+// errNotFound is returned when a tile does not exist.
+var errNotFound = errors.New("tile not found")
+
+// ProofSource computes consistency proofs from the tiles served by logs.
+// It implements distributor.ProofSource.
+type ProofSource struct {
+	urls   map[string]string
+	client *http.Client
+}
+
+// NewProofSource returns a ProofSource which fetches the tiles for each log from
+// the URL prefix given for its log ID in urls.
+func NewProofSource(urls map[string]string, client *http.Client) *ProofSource {
+	return &ProofSource{
+		urls:   urls,
+		client: client,
+	}
+}
+
+// ConsistencyProof returns the hashes of the consistency proof from the tree of size `from`
+// to the tree of size `to`, computed from the tiles of the log with the given ID.
+func (s *ProofSource) ConsistencyProof(ctx context.Context, logID string, from, to uint64) ([][]byte, error) {
+	prefix, ok := s.urls[logID]
+	if !ok {
+		return nil, fmt.Errorf("no tiles URL for log %q", logID)
+	}
+	if from == 0 || from > to {
+		return nil, fmt.Errorf("invalid sizes for consistency proof: %d to %d", from, to)
+	}
+	r := &hashReader{
+		ctx:    ctx,
+		prefix: strings.TrimSuffix(prefix, "/"),
+		size:   int64(to),
+		client: s.client,
+		tiles:  make(map[tlog.Tile][]byte),
+	}
+	p, err := tlog.ProveTree(int64(to), int64(from), r)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([][]byte, 0, len(p))
+	for _, h := range p {
+		hashes = append(hashes, h[:])
+	}
+	return hashes, nil
+}
+
+// hashReader reads the hashes of the tree of the given size from tiles, caching
+// the tiles read so that each is only fetched once.
+type hashReader struct {
+	ctx    context.Context
+	prefix string
+	size   int64
+	client *http.Client
+	tiles  map[tlog.Tile][]byte
+}
+
+// ReadHashes implements tlog.HashReader.
+func (r *hashReader) ReadHashes(indexes []int64) ([]tlog.Hash, error) {
+	hs := make([]tlog.Hash, 0, len(indexes))
+	for _, i := range indexes {
+		t := r.tileFor(i)
+		data, err := r.readTile(t)
+		if err != nil {
+			return nil, err
+		}
+		h, err := tlog.HashFromTile(t, data, i)
+		if err != nil {
+			return nil, err
+		}
+		hs = append(hs, h)
+	}
+	return hs, nil
+}
+
+// tileFor returns the tile which holds the hash with the given storage index, with
+// the width that the tile has in the tree of size r.size.
+func (r *hashReader) tileFor(index int64) tlog.Tile {
+	t := tlog.TileForIndex(tileHeight, index)
+	w := (r.size >> (t.L * tileHeight)) - t.N<<tileHeight
+	t.W = int(min(w, 1<<tileHeight))
+	return t
+}
+
+// readTile returns the hashes in the tile. Partial tiles may be removed once the
+// full tile exists, so a partial tile which is not found is read from the full tile.
+func (r *hashReader) readTile(t tlog.Tile) ([]byte, error) {
+	if data, ok := r.tiles[t]; ok {
+		return data, nil
+	}
+	data, err := r.fetch(t)
+	if errors.Is(err, errNotFound) && t.W < 1<<tileHeight {
+		full := t
+		full.W = 1 << tileHeight
+		if data, err = r.fetch(full); err == nil {
+			data = data[:t.W*tlog.HashSize]
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.tiles[t] = data
+	return data, nil
+}
+
+// fetch fetches the tile from the log.
+func (r *hashReader) fetch(t tlog.Tile) ([]byte, error) {
+	u := r.prefix + "/" + tilePath(t)
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %q: %v", u, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %q", errNotFound, u)
+	default:
+		return nil, fmt.Errorf("failed to get %q: %s", u, resp.Status)
+	}
+	want := t.W * tlog.HashSize
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(want)+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %q: %v", u, err)
+	}
+	if len(data) != want {
+		return nil, fmt.Errorf("tile %q is %d bytes, want %d", u, len(data), want)
+	}
+	return data, nil
+}
+
+// tilePath returns the path of the tile, relative to the log's URL prefix.
+func tilePath(t tlog.Tile) string {
+	n := fmt.Sprintf("%03d", t.N%1000)
+	for x := t.N / 1000; x > 0; x /= 1000 {
+		n = fmt.Sprintf("x%03d/%s", x%1000, n)
+	}
+	p := fmt.Sprintf("tile/%d/%s", t.L, n)
+	if t.W < 1<<tileHeight {
+		p += fmt.Sprintf(".p/%d", t.W)
+	}
+	return p
+}
@@ -0,0 +1,135 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tiles
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/merkle/testonly"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// newTileServer returns a server for the tiles of a tree with the given number of
+// leaves, along with the same tree for computing expected proofs. Only the partial
+// tiles at the right edge of the tree are served, as a log would.
+func newTileServer(t *testing.T, size int64) (*httptest.Server, *testonly.Tree) {
+	t.Helper()
+	tree := testonly.New(rfc6962.DefaultHasher)
+	var stored []tlog.Hash
+	hr := tlog.HashReaderFunc(func(indexes []int64) ([]tlog.Hash, error) {
+		hs := make([]tlog.Hash, 0, len(indexes))
+		for _, i := range indexes {
+			hs = append(hs, stored[i])
+		}
+		return hs, nil
+	})
+	for i := int64(0); i < size; i++ {
+		leaf := []byte(fmt.Sprintf("leaf %d", i))
+		tree.AppendData(leaf)
+		hs, err := tlog.StoredHashes(i, leaf, hr)
+		if err != nil {
+			t.Fatalf("StoredHashes(): %v", err)
+		}
+		stored = append(stored, hs...)
+	}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// tlog paths include the tile height, which is fixed in tlog-tiles paths.
+		p, ok := strings.CutPrefix(r.URL.Path, "/log/tile/")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		tile, err := tlog.ParseTilePath(fmt.Sprintf("tile/%d/%s", tileHeight, p))
+		if err != nil || tile.L < 0 {
+			http.NotFound(w, r)
+			return
+		}
+		if n := (size >> (tile.L * tileHeight)) - tile.N<<tileHeight; n < int64(tile.W) || (tile.W < 1<<tileHeight && n != int64(tile.W)) {
+			http.NotFound(w, r)
+			return
+		}
+		data, err := tlog.ReadTileData(tile, hr)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	return s, tree
+}
+
+func TestConsistencyProof(t *testing.T) {
+	const size = 700
+	s, tree := newTileServer(t, size)
+	defer s.Close()
+	ps := NewProofSource(map[string]string{"FooLog": s.URL + "/log/"}, s.Client())
+
+	for _, tC := range []struct {
+		from, to uint64
+	}{
+		{from: 1, to: 2},
+		{from: 10, to: 20},
+		{from: 255, to: 256},
+		{from: 256, to: 257},
+		{from: 100, to: 300},
+		{from: 300, to: size},
+		{from: 513, to: size},
+		{from: size, to: size},
+	} {
+		t.Run(fmt.Sprintf("%d to %d", tC.from, tC.to), func(t *testing.T) {
+			got, err := ps.ConsistencyProof(context.Background(), "FooLog", tC.from, tC.to)
+			if err != nil {
+				t.Fatalf("ConsistencyProof(): %v", err)
+			}
+			want, err := tree.ConsistencyProof(tC.from, tC.to)
+			if err != nil {
+				t.Fatalf("tree.ConsistencyProof(): %v", err)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("unexpected proof (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestConsistencyProofErrors(t *testing.T) {
+	s, _ := newTileServer(t, 20)
+	defer s.Close()
+	ps := NewProofSource(map[string]string{"FooLog": s.URL + "/log"}, s.Client())
+
+	for _, tC := range []struct {
+		desc     string
+		logID    string
+		from, to uint64
+	}{
+		{desc: "unknown log", logID: "BarLog", from: 10, to: 20},
+		{desc: "from zero", logID: "FooLog", from: 0, to: 20},
+		{desc: "from larger than to", logID: "FooLog", from: 20, to: 10},
+		{desc: "larger than the log", logID: "FooLog", from: 10, to: 30},
+	} {
+		t.Run(tC.desc, func(t *testing.T) {
+			if _, err := ps.ConsistencyProof(context.Background(), tC.logID, tC.from, tC.to); err == nil {
+				t.Error("ConsistencyProof(): got nil error")
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/transparency-dev/distributor/config"
+	"github.com/transparency-dev/formats/log"
+)
+
+const (
+	sumDBKey  = "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8"
+	armoryKey = "armory-drive-log+16541b8f+AYDPmG5pQp4Bgu0a1mr5uDZ196+t8lIVIfWQSPWmP+Jv"
+)
+
+func TestParseLogKey(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		key        string
+		wantOrigin string
+		wantVKey   string
+		wantErr    bool
+	}{
+		{
+			desc:       "origin and key",
+			key:        "go.sum database tree=" + sumDBKey,
+			wantOrigin: "go.sum database tree",
+			wantVKey:   sumDBKey,
+		},
+		{
+			desc:       "key only",
+			key:        sumDBKey,
+			wantOrigin: "sum.golang.org",
+			wantVKey:   sumDBKey,
+		},
+		{
+			desc:       "padding in key is not a separator",
+			key:        "example.com/log+12345678+AAAA=",
+			wantOrigin: "example.com/log",
+			wantVKey:   "example.com/log+12345678+AAAA=",
+		},
+		{
+			desc:    "empty origin",
+			key:     "=" + sumDBKey,
+			wantErr: true,
+		},
+		{
+			desc:    "empty key name",
+			key:     "+033de0ae+Ac4zctda0e5eza",
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			origin, vkey, err := parseLogKey(tC.key)
+			if gotErr := err != nil; gotErr != tC.wantErr {
+				t.Fatalf("parseLogKey(): got err %v, want err %t", err, tC.wantErr)
+			}
+			if origin != tC.wantOrigin || vkey != tC.wantVKey {
+				t.Errorf("parseLogKey() = (%q, %q), want (%q, %q)", origin, vkey, tC.wantOrigin, tC.wantVKey)
+			}
+		})
+	}
+}
+
+func TestParseLogTiles(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		vs      []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			desc: "origins with spaces and slashes",
+			vs:   []string{"go.sum database tree=https://sum.golang.org/", "example.com/log=https://example.com/log/"},
+			want: map[string]string{
+				log.ID("go.sum database tree"): "https://sum.golang.org/",
+				log.ID("example.com/log"):      "https://example.com/log/",
+			},
+		},
+		{
+			desc:    "missing URL",
+			vs:      []string{"example.com/log"},
+			wantErr: true,
+		},
+		{
+			desc:    "empty origin",
+			vs:      []string{"=https://example.com/log/"},
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := parseLogTiles(tC.vs)
+			if gotErr := err != nil; gotErr != tC.wantErr {
+				t.Fatalf("parseLogTiles(): got err %v, want err %t", err, tC.wantErr)
+			}
+			if tC.wantErr {
+				return
+			}
+			if diff := cmp.Diff(tC.want, got); diff != "" {
+				t.Errorf("unexpected URLs (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLoadLogs(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "logs.yaml")
+	if err := os.WriteFile(configFile, []byte("Logs:\n  - Origin: Armory Drive Prod 2\n    PublicKey: "+armoryKey+"\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile(): %v", err)
+	}
+	builtIn, err := config.ParseLogConfig(config.LogsYAML)
+	if err != nil {
+		t.Fatalf("ParseLogConfig(): %v", err)
+	}
+	var builtInOrigins []string
+	for _, l := range builtIn {
+		builtInOrigins = append(builtInOrigins, l.Origin)
+	}
+	sort.Strings(builtInOrigins)
+
+	testCases := []struct {
+		desc        string
+		configFile  string
+		keys        []string
+		wantOrigins []string
+		wantErr     bool
+	}{
+		{
+			desc:        "built-in",
+			wantOrigins: builtInOrigins,
+		},
+		{
+			desc:        "config file",
+			configFile:  configFile,
+			wantOrigins: []string{"Armory Drive Prod 2"},
+		},
+		{
+			desc:        "keys",
+			keys:        []string{"go.sum database tree=" + sumDBKey, armoryKey},
+			wantOrigins: []string{"armory-drive-log", "go.sum database tree"},
+		},
+		{
+			desc:       "config file and keys",
+			configFile: configFile,
+			keys:       []string{sumDBKey},
+			wantErr:    true,
+		},
+		{
+			desc:       "missing config file",
+			configFile: filepath.Join(t.TempDir(), "missing.yaml"),
+			wantErr:    true,
+		},
+		{
+			desc:    "empty origin",
+			keys:    []string{"=" + sumDBKey},
+			wantErr: true,
+		},
+		{
+			desc:    "bad key",
+			keys:    []string{"go.sum database tree=sum.golang.org+033de0ae+notakey"},
+			wantErr: true,
+		},
+		{
+			desc:    "key without separator or name",
+			keys:    []string{"notakey"},
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			ls, err := loadLogs(tC.configFile, tC.keys)
+			if gotErr := err != nil; gotErr != tC.wantErr {
+				t.Fatalf("loadLogs(): got err %v, want err %t", err, tC.wantErr)
+			}
+			if tC.wantErr {
+				return
+			}
+			var origins []string
+			for _, l := range ls {
+				origins = append(origins, l.Origin)
+			}
+			sort.Strings(origins)
+			if diff := cmp.Diff(tC.wantOrigins, origins); diff != "" {
+				t.Errorf("unexpected origins (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -17,8 +17,11 @@
 package config
 
 import (
+	"crypto/sha256"
 	_ "embed"
+	"encoding/hex"
 	"fmt"
+	"strings"
 
 	"github.com/transparency-dev/formats/log"
 	f_note "github.com/transparency-dev/formats/note"
@@ -42,14 +45,34 @@ func DefaultLogs() (map[string]LogInfo, error) {
 type LogInfo struct {
 	Origin   string
 	Verifier note.Verifier
+	// AllowedWitnesses optionally restricts the witnesses that may cosign
+	// checkpoints for this log. Each entry is either the name of a witness key,
+	// or its key hash as 8 hex digits. If empty, all witnesses are allowed.
+	AllowedWitnesses []string
+}
+
+// WitnessAllowed returns true if the witness with the given verifier is
+// permitted to cosign checkpoints for this log.
+func (l LogInfo) WitnessAllowed(v note.Verifier) bool {
+	if len(l.AllowedWitnesses) == 0 {
+		return true
+	}
+	hash := fmt.Sprintf("%08x", v.KeyHash())
+	for _, w := range l.AllowedWitnesses {
+		if w == v.Name() || w == hash {
+			return true
+		}
+	}
+	return false
 }
 
 // ParseLogConfig parses the passed in log config, and returns a map keyed by LogID.
 func ParseLogConfig(y []byte) (map[string]LogInfo, error) {
 	logsCfg := struct {
 		Logs []struct {
-			Origin    string `yaml:"Origin"`
-			PublicKey string `yaml:"PublicKey"`
+			Origin           string   `yaml:"Origin"`
+			PublicKey        string   `yaml:"PublicKey"`
+			AllowedWitnesses []string `yaml:"AllowedWitnesses"`
 		} `yaml:"Logs"`
 	}{}
 
@@ -62,30 +85,97 @@ func ParseLogConfig(y []byte) (map[string]LogInfo, error) {
 		if err != nil {
 			return nil, fmt.Errorf("invalid log public key: %v", err)
 		}
+		for _, w := range l.AllowedWitnesses {
+			if w == "" {
+				return nil, fmt.Errorf("empty allowed witness for log %q", l.Origin)
+			}
+		}
 		ls[log.ID(l.Origin)] = LogInfo{
-			Origin:   l.Origin,
-			Verifier: lSigV,
+			Origin:           l.Origin,
+			Verifier:         lSigV,
+			AllowedWitnesses: l.AllowedWitnesses,
 		}
 	}
 	return ls, nil
 }
 
-// ParseWitnessesConfig parses the passed in witnesses config, and returns a map keyed
-// by the raw verifier key string.
-func ParseWitnessesConfig(y []byte) (map[string]note.Verifier, error) {
+// WitnessAuth configures how submissions of checkpoints from a witness are authenticated.
+type WitnessAuth struct {
+	// ClientCertSHA256 are the SHA-256 fingerprints of the TLS client certificates that
+	// the witness may present, as lowercase hex. If empty, submissions from the witness
+	// are not authenticated beyond checking its signature on the checkpoint.
+	ClientCertSHA256 []string
+}
+
+// witnessEntry is an entry in the Witnesses list of a witness config. This is either
+// the public key of the witness, or a mapping containing the key and the settings for
+// authenticating the witness.
+type witnessEntry struct {
+	PublicKey        string   `yaml:"PublicKey"`
+	ClientCertSHA256 []string `yaml:"ClientCertSHA256"`
+}
+
+func (e *witnessEntry) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		return n.Decode(&e.PublicKey)
+	}
+	type plain witnessEntry
+	return n.Decode((*plain)(e))
+}
+
+// parseWitnessEntries parses the Witnesses list of the passed in witnesses config.
+func parseWitnessEntries(y []byte) ([]witnessEntry, error) {
 	witCfg := struct {
-		Witnesses []string `yaml:"Witnesses"`
+		Witnesses []witnessEntry `yaml:"Witnesses"`
 	}{}
 	if err := yaml.Unmarshal(y, &witCfg); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal witness config: %v", err)
 	}
+	return witCfg.Witnesses, nil
+}
+
+// ParseWitnessesConfig parses the passed in witnesses config, and returns a map keyed
+// by the raw verifier key string.
+func ParseWitnessesConfig(y []byte) (map[string]note.Verifier, error) {
+	entries, err := parseWitnessEntries(y)
+	if err != nil {
+		return nil, err
+	}
 	ws := make(map[string]note.Verifier)
-	for _, w := range witCfg.Witnesses {
-		wSigV, err := f_note.NewVerifierForCosignatureV1(w)
+	for _, w := range entries {
+		wSigV, err := f_note.NewVerifierForCosignatureV1(w.PublicKey)
 		if err != nil {
 			return nil, fmt.Errorf("invalid witness public key: %v", err)
 		}
-		ws[w] = wSigV
+		ws[w.PublicKey] = wSigV
 	}
 	return ws, nil
 }
+
+// ParseWitnessAuthConfig parses the authentication settings from the passed in witnesses
+// config, and returns a map keyed by witness name. Witnesses without any authentication
+// settings are omitted.
+func ParseWitnessAuthConfig(y []byte) (map[string]WitnessAuth, error) {
+	entries, err := parseWitnessEntries(y)
+	if err != nil {
+		return nil, err
+	}
+	as := make(map[string]WitnessAuth)
+	for _, w := range entries {
+		if len(w.ClientCertSHA256) == 0 {
+			continue
+		}
+		name, _, _ := strings.Cut(w.PublicKey, "+")
+		fps := make([]string, 0, len(w.ClientCertSHA256))
+		for _, fp := range w.ClientCertSHA256 {
+			// Fingerprints are commonly displayed with colons between the bytes.
+			fp = strings.ToLower(strings.ReplaceAll(fp, ":", ""))
+			if b, err := hex.DecodeString(fp); err != nil || len(b) != sha256.Size {
+				return nil, fmt.Errorf("invalid client certificate fingerprint %q for witness %q", fp, name)
+			}
+			fps = append(fps, fp)
+		}
+		as[name] = WitnessAuth{ClientCertSHA256: fps}
+	}
+	return as, nil
+}
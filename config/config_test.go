@@ -0,0 +1,90 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/transparency-dev/distributor/config"
+)
+
+func TestParseWitnessesConfig(t *testing.T) {
+	fp := strings.Repeat("ab", 32)
+	testCases := []struct {
+		desc     string
+		yaml     string
+		wantKeys []string
+		wantAuth map[string]config.WitnessAuth
+		wantErr  bool
+	}{
+		{
+			desc:     "keys only",
+			yaml:     fmt.Sprintf("Witnesses:\n  - %s\n  - %s\n", witA1, witA2),
+			wantKeys: []string{witA1, witA2},
+			wantAuth: map[string]config.WitnessAuth{},
+		},
+		{
+			desc:     "client certs",
+			yaml:     fmt.Sprintf("Witnesses:\n  - %s\n  - PublicKey: %s\n    ClientCertSHA256:\n      - %s\n      - %s\n", witA1, witB1, fp, strings.ToUpper(fp[:2])+":"+fp[2:]),
+			wantKeys: []string{witA1, witB1},
+			wantAuth: map[string]config.WitnessAuth{
+				"DEV:ArmoredWitness-proud-morning": {ClientCertSHA256: []string{fp, fp}},
+			},
+		},
+		{
+			desc:    "invalid fingerprint",
+			yaml:    fmt.Sprintf("Witnesses:\n  - PublicKey: %s\n    ClientCertSHA256:\n      - abcd\n", witA1),
+			wantErr: true,
+		},
+		{
+			desc:    "invalid key",
+			yaml:    "Witnesses:\n  - PublicKey: not a key\n",
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			ws, err := config.ParseWitnessesConfig([]byte(tC.yaml))
+			if err != nil {
+				if !tC.wantErr {
+					t.Fatalf("ParseWitnessesConfig(): %v", err)
+				}
+				return
+			}
+			auth, err := config.ParseWitnessAuthConfig([]byte(tC.yaml))
+			if gotErr := err != nil; gotErr != tC.wantErr {
+				t.Fatalf("ParseWitnessAuthConfig(): got err %v, want err %t", err, tC.wantErr)
+			}
+			if tC.wantErr {
+				return
+			}
+			var gotKeys []string
+			for _, k := range tC.wantKeys {
+				if _, ok := ws[k]; ok {
+					gotKeys = append(gotKeys, k)
+				}
+			}
+			if len(ws) != len(tC.wantKeys) || len(gotKeys) != len(tC.wantKeys) {
+				t.Errorf("got witnesses %v, want %v", ws, tC.wantKeys)
+			}
+			if diff := cmp.Diff(tC.wantAuth, auth); diff != "" {
+				t.Errorf("unexpected auth config (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
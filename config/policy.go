@@ -0,0 +1,164 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"slices"
+
+	f_note "github.com/transparency-dev/formats/note"
+	"golang.org/x/mod/sumdb/note"
+	"gopkg.in/yaml.v3"
+)
+
+// Policy is a k-of-n threshold over a group of members, where each member is
+// either a witness, or another policy. A policy is satisfied when at least
+// Threshold of its members are satisfied; a witness member is satisfied when
+// it has signed the checkpoint.
+type Policy struct {
+	// Name identifies the policy.
+	Name string
+	// Threshold is the number of members that must be satisfied.
+	Threshold int
+	// Witnesses are the witnesses that are direct members of this policy.
+	Witnesses []note.Verifier
+	// Policies are the nested policies that are members of this policy.
+	Policies []*Policy
+}
+
+// SatisfiedBy returns true if the policy is satisfied by signatures from the
+// witnesses provided.
+func (p *Policy) SatisfiedBy(ws []note.Verifier) bool {
+	n := 0
+	for _, w := range p.Witnesses {
+		for _, s := range ws {
+			if s.Name() == w.Name() && s.KeyHash() == w.KeyHash() {
+				n++
+				break
+			}
+		}
+	}
+	for _, c := range p.Policies {
+		if c.SatisfiedBy(ws) {
+			n++
+		}
+	}
+	return n >= p.Threshold
+}
+
+// ParsePolicyConfig parses the passed in policy config, and returns a map keyed
+// by policy name. The config is of the form:
+//
+//	Policies:
+//	  - Name: groupA
+//	    Threshold: 2
+//	    Witnesses:
+//	      - <witness vkey>
+//	      - <witness vkey>
+//	      - <witness vkey>
+//	  - Name: groupB
+//	    Threshold: 1
+//	    Witnesses:
+//	      - <witness vkey>
+//	      - <witness vkey>
+//	  - Name: strict
+//	    Threshold: 2
+//	    Policies:
+//	      - groupA
+//	      - groupB
+//
+// Policies may refer to other policies defined anywhere in the config, but
+// references must not form a cycle. A policy must not list the same witness, or
+// the same policy, more than once.
+func ParsePolicyConfig(y []byte) (map[string]*Policy, error) {
+	policyCfg := struct {
+		Policies []struct {
+			Name      string   `yaml:"Name"`
+			Threshold int      `yaml:"Threshold"`
+			Witnesses []string `yaml:"Witnesses"`
+			Policies  []string `yaml:"Policies"`
+		} `yaml:"Policies"`
+	}{}
+	if err := yaml.Unmarshal(y, &policyCfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal policy config: %v", err)
+	}
+
+	ps := make(map[string]*Policy, len(policyCfg.Policies))
+	for _, p := range policyCfg.Policies {
+		if p.Name == "" {
+			return nil, fmt.Errorf("policy with no name")
+		}
+		if _, ok := ps[p.Name]; ok {
+			return nil, fmt.Errorf("duplicate policy %q", p.Name)
+		}
+		if members := len(p.Witnesses) + len(p.Policies); p.Threshold < 1 || p.Threshold > members {
+			return nil, fmt.Errorf("policy %q has threshold %d, which must be between 1 and its %d members", p.Name, p.Threshold, members)
+		}
+		policy := &Policy{
+			Name:      p.Name,
+			Threshold: p.Threshold,
+		}
+		for _, w := range p.Witnesses {
+			wSigV, err := f_note.NewVerifierForCosignatureV1(w)
+			if err != nil {
+				return nil, fmt.Errorf("invalid witness public key in policy %q: %v", p.Name, err)
+			}
+			// Each member counts once towards the threshold, so a witness listed twice
+			// would let it satisfy more of the threshold than intended.
+			for _, o := range policy.Witnesses {
+				if o.Name() == wSigV.Name() && o.KeyHash() == wSigV.KeyHash() {
+					return nil, fmt.Errorf("policy %q lists witness %q more than once", p.Name, wSigV.Name())
+				}
+			}
+			policy.Witnesses = append(policy.Witnesses, wSigV)
+		}
+		ps[p.Name] = policy
+	}
+	// Now that all of the policies are known, resolve the references between them.
+	for _, p := range policyCfg.Policies {
+		for i, name := range p.Policies {
+			c, ok := ps[name]
+			if !ok {
+				return nil, fmt.Errorf("policy %q refers to unknown policy %q", p.Name, name)
+			}
+			if slices.Contains(p.Policies[:i], name) {
+				return nil, fmt.Errorf("policy %q lists policy %q more than once", p.Name, name)
+			}
+			ps[p.Name].Policies = append(ps[p.Name].Policies, c)
+		}
+	}
+	for _, p := range ps {
+		if err := checkAcyclic(p, map[*Policy]bool{}); err != nil {
+			return nil, err
+		}
+	}
+	return ps, nil
+}
+
+// checkAcyclic returns an error if p, or any policy it refers to, refers back to
+// a policy in path.
+func checkAcyclic(p *Policy, path map[*Policy]bool) error {
+	if path[p] {
+		return fmt.Errorf("policy %q refers to itself", p.Name)
+	}
+	path[p] = true
+	defer delete(path, p)
+	for _, c := range p.Policies {
+		if err := checkAcyclic(c, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
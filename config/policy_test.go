@@ -0,0 +1,217 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/transparency-dev/distributor/config"
+	f_note "github.com/transparency-dev/formats/note"
+	"golang.org/x/mod/sumdb/note"
+)
+
+const (
+	witA1 = "mhutchinson.witness+384b3dbc+AfWg+7+qmcFoMuIM0ZGe4ZsIuc6gEg3EL0cKkNVolCA+"
+	witA2 = "wolsey-bank-alfred+0336ecb0+AVcofP6JyFkxhQ+/FK7omBtGLVS22tGC6fH+zvK5WrIx"
+	witA3 = "JKU-INS+814e35bf+AdYBKkmgKGzao81EKOSxkphZLDtgBf72VXHFOIhMmqvO"
+	witB1 = "DEV:ArmoredWitness-proud-morning+2bcc99d0+AdKSl/Ln2/kjMaO+D1aSk7zopBJ9SxzpoHWpaMbSgESc"
+	witB2 = "DEV:ArmoredWitness-quiet-night+3412fa83+ASZ2S7C1mkQmKiNFIGa20vuPLhaBNaxgXX+RBq1LjKHU"
+)
+
+var policyYAML = fmt.Sprintf(`
+Policies:
+  - Name: groupA
+    Threshold: 2
+    Witnesses:
+      - %s
+      - %s
+      - %s
+  - Name: strict
+    Threshold: 2
+    Policies:
+      - groupA
+      - groupB
+  - Name: groupB
+    Threshold: 1
+    Witnesses:
+      - %s
+      - %s
+`, witA1, witA2, witA3, witB1, witB2)
+
+func TestParsePolicyConfig(t *testing.T) {
+	for _, test := range []struct {
+		desc    string
+		yaml    string
+		wantErr bool
+	}{
+		{
+			desc: "valid",
+			yaml: policyYAML,
+		},
+		{
+			desc: "unknown reference",
+			yaml: `
+Policies:
+  - Name: a
+    Threshold: 1
+    Policies: [b]
+`,
+			wantErr: true,
+		},
+		{
+			desc: "cycle",
+			yaml: `
+Policies:
+  - Name: a
+    Threshold: 1
+    Policies: [b]
+  - Name: b
+    Threshold: 1
+    Policies: [a]
+`,
+			wantErr: true,
+		},
+		{
+			desc: "threshold too high",
+			yaml: fmt.Sprintf(`
+Policies:
+  - Name: a
+    Threshold: 2
+    Witnesses: [%s]
+`, witA1),
+			wantErr: true,
+		},
+		{
+			desc: "zero threshold",
+			yaml: fmt.Sprintf(`
+Policies:
+  - Name: a
+    Witnesses: [%s]
+`, witA1),
+			wantErr: true,
+		},
+		{
+			desc: "duplicate name",
+			yaml: fmt.Sprintf(`
+Policies:
+  - Name: a
+    Threshold: 1
+    Witnesses: [%s]
+  - Name: a
+    Threshold: 1
+    Witnesses: [%s]
+`, witA1, witA2),
+			wantErr: true,
+		},
+		{
+			desc: "duplicate witness",
+			yaml: fmt.Sprintf(`
+Policies:
+  - Name: a
+    Threshold: 2
+    Witnesses: [%s, %s]
+`, witA1, witA1),
+			wantErr: true,
+		},
+		{
+			desc: "duplicate policy",
+			yaml: fmt.Sprintf(`
+Policies:
+  - Name: a
+    Threshold: 1
+    Witnesses: [%s]
+  - Name: b
+    Threshold: 2
+    Policies: [a, a]
+`, witA1),
+			wantErr: true,
+		},
+		{
+			desc: "invalid key",
+			yaml: `
+Policies:
+  - Name: a
+    Threshold: 1
+    Witnesses: [notakey]
+`,
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := config.ParsePolicyConfig([]byte(test.yaml))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Errorf("ParsePolicyConfig(): got err %v, want err %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicySatisfiedBy(t *testing.T) {
+	ps, err := config.ParsePolicyConfig([]byte(policyYAML))
+	if err != nil {
+		t.Fatalf("ParsePolicyConfig(): %v", err)
+	}
+	for _, test := range []struct {
+		desc   string
+		policy string
+		wits   []string
+		want   bool
+	}{
+		{
+			desc:   "no witnesses",
+			policy: "groupA",
+			want:   false,
+		},
+		{
+			desc:   "below threshold",
+			policy: "groupA",
+			wits:   []string{witA1, witB1},
+			want:   false,
+		},
+		{
+			desc:   "meets threshold",
+			policy: "groupA",
+			wits:   []string{witA1, witA3},
+			want:   true,
+		},
+		{
+			desc:   "nested groups satisfied",
+			policy: "strict",
+			wits:   []string{witA1, witA2, witB2},
+			want:   true,
+		},
+		{
+			desc:   "one nested group unsatisfied",
+			policy: "strict",
+			wits:   []string{witA1, witA2, witA3},
+			want:   false,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			var ws []note.Verifier
+			for _, k := range test.wits {
+				v, err := f_note.NewVerifierForCosignatureV1(k)
+				if err != nil {
+					t.Fatalf("NewVerifierForCosignatureV1(): %v", err)
+				}
+				ws = append(ws, v)
+			}
+			if got := ps[test.policy].SatisfiedBy(ws); got != test.want {
+				t.Errorf("SatisfiedBy(): got %t, want %t", got, test.want)
+			}
+		})
+	}
+}
@@ -41,16 +41,22 @@ func ConfigureHost(config *dck.HostConfig) {
 	}
 }
 
-// GetAddress returns the server address for the resource.
+// GetAddress returns the server address for the MySQL resource.
 func GetAddress(r *dockertest.Resource) string {
+	return GetAddressForPort(r, "3306")
+}
+
+// GetAddressForPort returns the server address for the resource, which
+// listens on the given TCP port inside the container.
+func GetAddressForPort(r *dockertest.Resource, port string) string {
 	if env, ok := os.LookupEnv(goTestDockerIntegration); ok {
 		switch env {
 		case "cloudbuild":
 			n := r.Container.NetworkSettings.Networks["cloudbuild"]
-			return net.JoinHostPort(n.IPAddress, "3306")
+			return net.JoinHostPort(n.IPAddress, port)
 		default:
 			panic(fmt.Sprintf("Unsupported option for GO_TEST_DOCKER_INTEGRATION: %q", env))
 		}
 	}
-	return net.JoinHostPort("localhost", r.GetPort("3306/tcp"))
+	return net.JoinHostPort("localhost", r.GetPort(port+"/tcp"))
 }